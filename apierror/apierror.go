@@ -0,0 +1,134 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/haithamswe/multi-protocol-upload-api/logging"
+	"github.com/haithamswe/multi-protocol-upload-api/requestid"
+)
+
+const ContentType = "application/problem+json"
+
+type Kind string
+
+const (
+	KindValidation           Kind = "validation"
+	KindBadDigest            Kind = "bad_digest"
+	KindNotFound             Kind = "not_found"
+	KindForbidden            Kind = "forbidden"
+	KindConflict             Kind = "conflict"
+	KindMethodNotAllowed     Kind = "method_not_allowed"
+	KindTooLarge             Kind = "too_large"
+	KindUnsupportedMediaType Kind = "unsupported_media_type"
+	KindUnprocessable        Kind = "unprocessable"
+	KindTooManyRequests      Kind = "rate_limited"
+	KindUpstream             Kind = "upstream_error"
+	KindUpstreamUnavailable  Kind = "upstream_unavailable"
+	KindUpstreamTimeout      Kind = "upstream_timeout"
+	KindCanceled             Kind = "canceled"
+	KindInsufficientStorage  Kind = "insufficient_storage"
+	KindInternal             Kind = "internal"
+)
+
+// StatusClientClosedRequest is the non-standard status (popularised by nginx) recorded when the
+// client disconnects before a response could be produced.
+const StatusClientClosedRequest = 499
+
+var statuses = map[Kind]int{
+	KindValidation:           http.StatusBadRequest,
+	KindBadDigest:            http.StatusBadRequest,
+	KindNotFound:             http.StatusNotFound,
+	KindForbidden:            http.StatusForbidden,
+	KindConflict:             http.StatusConflict,
+	KindMethodNotAllowed:     http.StatusMethodNotAllowed,
+	KindTooLarge:             http.StatusRequestEntityTooLarge,
+	KindUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	KindUnprocessable:        http.StatusUnprocessableEntity,
+	KindTooManyRequests:      http.StatusTooManyRequests,
+	KindUpstream:             http.StatusBadGateway,
+	KindUpstreamUnavailable:  http.StatusServiceUnavailable,
+	KindUpstreamTimeout:      http.StatusGatewayTimeout,
+	KindCanceled:             StatusClientClosedRequest,
+	KindInsufficientStorage:  http.StatusInsufficientStorage,
+	KindInternal:             http.StatusInternalServerError,
+}
+
+// Error is an error that is safe to show to clients. Message is returned as the problem detail;
+// the wrapped Err is kept for logging and errors.Is/As but never serialised.
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Kind]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+func New(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func Wrap(kind Kind, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+// Problem is an RFC 9457 problem details document.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      Kind   `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Write renders err as a problem details response. Errors that are not an *Error are reported as
+// internal errors without exposing their message.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = Wrap(KindInternal, "internal server error", err)
+	}
+
+	// The wrapped cause only ever reaches the access log, never the client.
+	logging.AddAttrs(r.Context(), slog.String("error_code", string(apiErr.Kind)), slog.Any("error", err))
+
+	status := apiErr.Status()
+	title := http.StatusText(status)
+	if status == StatusClientClosedRequest {
+		title = "Client Closed Request"
+	}
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     title,
+		Status:    status,
+		Detail:    apiErr.Message,
+		Instance:  r.URL.Path,
+		Code:      apiErr.Kind,
+		RequestID: requestid.FromContext(r.Context()),
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem)
+}
@@ -0,0 +1,64 @@
+package apierror_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/apierror"
+	"github.com/haithamswe/multi-protocol-upload-api/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	cause := errors.New("dial tcp: connection refused")
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   apierror.Kind
+		expectedDetail string
+	}{
+		{name: "Validation", err: apierror.New(apierror.KindValidation, "Missing objectKey parameter"), expectedStatus: http.StatusBadRequest, expectedCode: apierror.KindValidation, expectedDetail: "Missing objectKey parameter"},
+		{name: "Bad digest", err: apierror.New(apierror.KindBadDigest, "checksum mismatch"), expectedStatus: http.StatusBadRequest, expectedCode: apierror.KindBadDigest, expectedDetail: "checksum mismatch"},
+		{name: "Not found", err: apierror.New(apierror.KindNotFound, "object not found"), expectedStatus: http.StatusNotFound, expectedCode: apierror.KindNotFound, expectedDetail: "object not found"},
+		{name: "Too large", err: apierror.New(apierror.KindTooLarge, "too big"), expectedStatus: http.StatusRequestEntityTooLarge, expectedCode: apierror.KindTooLarge, expectedDetail: "too big"},
+		{name: "Rate limited", err: apierror.New(apierror.KindTooManyRequests, "slow down"), expectedStatus: http.StatusTooManyRequests, expectedCode: apierror.KindTooManyRequests, expectedDetail: "slow down"},
+		{name: "Wrapped upstream error hides cause", err: fmt.Errorf("upload: %w", apierror.Wrap(apierror.KindUpstreamUnavailable, "storage is unavailable", cause)), expectedStatus: http.StatusServiceUnavailable, expectedCode: apierror.KindUpstreamUnavailable, expectedDetail: "storage is unavailable"},
+		{name: "Unknown error", err: cause, expectedStatus: http.StatusInternalServerError, expectedCode: apierror.KindInternal, expectedDetail: "internal server error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/upload-to-s3", nil)
+			req = req.WithContext(requestid.NewContext(req.Context(), "req-123"))
+			rec := httptest.NewRecorder()
+
+			apierror.Write(rec, req, tt.err)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.Equal(t, apierror.ContentType, rec.Header().Get("Content-Type"))
+
+			var problem apierror.Problem
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+			assert.Equal(t, tt.expectedStatus, problem.Status)
+			assert.Equal(t, http.StatusText(tt.expectedStatus), problem.Title)
+			assert.Equal(t, tt.expectedCode, problem.Code)
+			assert.Equal(t, tt.expectedDetail, problem.Detail)
+			assert.Equal(t, "/upload-to-s3", problem.Instance)
+			assert.Equal(t, "req-123", problem.RequestID)
+			assert.NotContains(t, rec.Body.String(), "connection refused")
+		})
+	}
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	cause := errors.New("cause")
+	err := apierror.Wrap(apierror.KindInternal, "failed", cause)
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, "failed: cause", err.Error())
+}
@@ -0,0 +1,229 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+type Format string
+
+const (
+	Zip     Format = "zip"
+	Tar     Format = "tar"
+	TarGzip Format = "tar.gz"
+)
+
+var (
+	ErrUnsupported    = errors.New("not a zip or tar archive")
+	ErrInvalid        = errors.New("invalid archive")
+	ErrUnsafePath     = errors.New("unsafe path in archive")
+	ErrTooManyEntries = errors.New("archive has too many entries")
+	ErrTooLarge       = errors.New("archive expands to too many bytes")
+	ErrRatio          = errors.New("archive compression ratio is too high")
+)
+
+// Limits bound what an archive may expand to, so small uploads cannot turn into huge amounts of
+// data. Zero values fall back to DefaultLimits.
+type Limits struct {
+	MaxEntries int
+	// MaxBytes bounds the total size of the extracted files.
+	MaxBytes int64
+	// MaxRatio bounds the extracted size divided by the archive size. It is only enforced once
+	// ratioThreshold bytes have been extracted, since small files compress well.
+	MaxRatio float64
+}
+
+var DefaultLimits = Limits{
+	MaxEntries: 1000,
+	MaxBytes:   256 << 20,
+	MaxRatio:   100,
+}
+
+const (
+	ratioThreshold = 1 << 20
+	// readChunk bounds how far a read can overshoot the limits before it is stopped.
+	readChunk = 32 << 10
+)
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = DefaultLimits.MaxEntries
+	}
+	if l.MaxBytes <= 0 {
+		l.MaxBytes = DefaultLimits.MaxBytes
+	}
+	if l.MaxRatio <= 0 {
+		l.MaxRatio = DefaultLimits.MaxRatio
+	}
+	return l
+}
+
+// Detect identifies an archive from its magic bytes. Gzip streams are assumed to contain a tar.
+func Detect(data []byte) (Format, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return Zip, true
+	case bytes.HasPrefix(data, []byte("\x1f\x8b")):
+		return TarGzip, true
+	case len(data) >= 262 && string(data[257:262]) == "ustar":
+		return Tar, true
+	}
+	return "", false
+}
+
+type Entry struct {
+	// Name is the cleaned, slash separated path of the file within the archive.
+	Name string
+	Data []byte
+}
+
+// Walk calls fn with every regular file in an archive, in archive order. Directories, links and
+// other special entries are skipped, but count towards MaxEntries. Walk stops at the first error,
+// including ones returned by fn.
+func Walk(data []byte, format Format, limits Limits, fn func(Entry) error) error {
+	w := &walker{limits: limits.withDefaults(), archiveSize: int64(len(data)), seen: map[string]bool{}, fn: fn}
+	switch format {
+	case Zip:
+		return w.zip(data)
+	case Tar:
+		return w.tar(bytes.NewReader(data))
+	case TarGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		defer zr.Close()
+		return w.tar(zr)
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupported, format)
+}
+
+type walker struct {
+	limits      Limits
+	archiveSize int64
+	entries     int
+	expanded    int64
+	seen        map[string]bool
+	fn          func(Entry) error
+}
+
+func (w *walker) zip(data []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	// The central directory lists every entry, so a bomb made of many entries fails before any
+	// of them is read.
+	if len(zr.File) > w.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d", ErrTooManyEntries, w.limits.MaxEntries)
+	}
+	for _, f := range zr.File {
+		if err := w.count(); err != nil {
+			return err
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalid, f.Name, err)
+		}
+		err = w.entry(f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *walker) tar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if err := w.count(); err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := w.entry(header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *walker) count() error {
+	w.entries++
+	if w.entries > w.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d", ErrTooManyEntries, w.limits.MaxEntries)
+	}
+	return nil
+}
+
+func (w *walker) entry(name string, r io.Reader) error {
+	clean, err := CleanName(name)
+	if err != nil {
+		return err
+	}
+	if w.seen[clean] {
+		return fmt.Errorf("%w: %s appears more than once", ErrInvalid, clean)
+	}
+	w.seen[clean] = true
+	data, err := io.ReadAll(&meter{r: r, w: w})
+	if err != nil {
+		if errors.Is(err, ErrTooLarge) || errors.Is(err, ErrRatio) {
+			return err
+		}
+		return fmt.Errorf("%w: %s: %v", ErrInvalid, clean, err)
+	}
+	return w.fn(Entry{Name: clean, Data: data})
+}
+
+// meter counts the bytes extracted from an archive and fails as soon as they exceed the limits,
+// whatever the entry headers claim.
+type meter struct {
+	r io.Reader
+	w *walker
+}
+
+func (m *meter) Read(p []byte) (int, error) {
+	if len(p) > readChunk {
+		p = p[:readChunk]
+	}
+	n, err := m.r.Read(p)
+	m.w.expanded += int64(n)
+	if m.w.expanded > m.w.limits.MaxBytes {
+		return n, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, m.w.limits.MaxBytes)
+	}
+	if m.w.expanded > ratioThreshold && float64(m.w.expanded) > m.w.limits.MaxRatio*float64(m.w.archiveSize) {
+		return n, fmt.Errorf("%w: more than %g", ErrRatio, m.w.limits.MaxRatio)
+	}
+	return n, err
+}
+
+// CleanName cleans a slash separated path, and rejects ones that are absolute or escape the
+// directory they are extracted to.
+func CleanName(name string) (string, error) {
+	if name == "" || path.IsAbs(name) || strings.ContainsAny(name, "\\\x00") {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	clean := path.Clean(name)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	return clean, nil
+}
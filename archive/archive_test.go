@@ -0,0 +1,132 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/archive"
+	"github.com/stretchr/testify/assert"
+)
+
+type file struct {
+	name string
+	body string
+}
+
+func newZip(t *testing.T, files ...file) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(f.body))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func newTar(t *testing.T, files ...file) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "docs/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}))
+	for _, f := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(f.body))}))
+		_, err := tw.Write([]byte(f.body))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func walk(data []byte, format archive.Format, limits archive.Limits) ([]archive.Entry, error) {
+	var entries []archive.Entry
+	err := archive.Walk(data, format, limits, func(e archive.Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+func TestWalk(t *testing.T) {
+	files := []file{{"docs/readme.txt", "hello"}, {"./img/../logo.svg", "<svg/>"}}
+	expected := []archive.Entry{{Name: "docs/readme.txt", Data: []byte("hello")}, {Name: "logo.svg", Data: []byte("<svg/>")}}
+	tests := []struct {
+		name   string
+		data   []byte
+		format archive.Format
+	}{
+		{name: "Zip", data: newZip(t, files...), format: archive.Zip},
+		{name: "Tar", data: newTar(t, files...), format: archive.Tar},
+		{name: "Gzipped tar", data: gzipped(t, newTar(t, files...)), format: archive.TarGzip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, ok := archive.Detect(tt.data)
+			assert.True(t, ok)
+			assert.Equal(t, tt.format, format)
+
+			entries, err := walk(tt.data, format, archive.Limits{})
+
+			assert.NoError(t, err)
+			assert.Equal(t, expected, entries)
+		})
+	}
+
+	_, ok := archive.Detect([]byte("plain text"))
+	assert.False(t, ok)
+}
+
+func TestWalk_Limits(t *testing.T) {
+	many := make([]file, 11)
+	for i := range many {
+		many[i] = file{name: strings.Repeat("a", i+1), body: "x"}
+	}
+	bomb := newZip(t, file{"zeros", strings.Repeat("\x00", 4<<20)})
+	tests := []struct {
+		name     string
+		data     []byte
+		format   archive.Format
+		limits   archive.Limits
+		expected error
+	}{
+		{name: "Parent directory", data: newZip(t, file{"docs/../../etc/passwd", "x"}), format: archive.Zip, expected: archive.ErrUnsafePath},
+		{name: "Absolute path", data: newTar(t, file{"/etc/passwd", "x"}), format: archive.Tar, expected: archive.ErrUnsafePath},
+		{name: "Backslashes", data: newZip(t, file{`..\windows\system.ini`, "x"}), format: archive.Zip, expected: archive.ErrUnsafePath},
+		{name: "Duplicate names", data: newTar(t, file{"a", "1"}, file{"./a", "2"}), format: archive.Tar, expected: archive.ErrInvalid},
+		{name: "Too many zip entries", data: newZip(t, many...), format: archive.Zip, limits: archive.Limits{MaxEntries: 10}, expected: archive.ErrTooManyEntries},
+		{name: "Too many tar entries", data: newTar(t, many[:9]...), format: archive.Tar, limits: archive.Limits{MaxEntries: 10}, expected: archive.ErrTooManyEntries},
+		{name: "Too large", data: newTar(t, file{"a", "123456"}, file{"b", "123456"}), format: archive.Tar, limits: archive.Limits{MaxBytes: 10}, expected: archive.ErrTooLarge},
+		{name: "Compression ratio", data: bomb, format: archive.Zip, expected: archive.ErrRatio},
+		{name: "Corrupt gzip", data: []byte("\x1f\x8bjunk"), format: archive.TarGzip, expected: archive.ErrInvalid},
+		{name: "Gzip without a tar", data: gzipped(t, []byte(strings.Repeat("not a tar ", 100))), format: archive.TarGzip, expected: archive.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := walk(tt.data, tt.format, tt.limits)
+
+			assert.ErrorIs(t, err, tt.expected)
+		})
+	}
+
+	// The ratio limit can be raised for archives of highly compressible data.
+	entries, err := walk(bomb, archive.Zip, archive.Limits{MaxRatio: 1e6})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,602 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/utils/timeutil"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+
+	DefaultPageSize = 50
+	MaxPageSize     = 1000
+)
+
+var (
+	ErrNotFound      = errors.New("catalog: record not found")
+	ErrInvalidCursor = errors.New("catalog: invalid cursor")
+)
+
+// Record describes one stored upload.
+type Record struct {
+	Key              string            `json:"objectKey"`
+	OriginalFileName string            `json:"originalFileName,omitempty"`
+	Size             int64             `json:"size"`
+	ContentType      string            `json:"contentType,omitempty"`
+	Checksum         string            `json:"checksum,omitempty"`
+	Uploader         string            `json:"uploader,omitempty"`
+	Tenant           string            `json:"tenant,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	UpdatedAt        time.Time         `json:"updatedAt"`
+}
+
+// Query filters a listing. Records are always scoped to Tenant; the other fields are optional.
+type Query struct {
+	Tenant string
+	// Search matches a case-insensitive substring of the key or the original filename.
+	Search      string
+	Prefix      string
+	ContentType string
+	Uploader    string
+	// Tags must all be present; an empty value matches any value.
+	Tags          map[string]string
+	MinSize       int64
+	MaxSize       int64
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Limit         int
+	Cursor        string
+}
+
+type Page struct {
+	Records []Record `json:"files"`
+	// NextCursor is empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type Catalog interface {
+	// Put records an upload, replacing the tenant's existing record for the same key.
+	Put(ctx context.Context, record Record) error
+	Get(ctx context.Context, tenant, objectKey string) (Record, error)
+	Delete(ctx context.Context, tenant, objectKey string) error
+	// List returns records newest first.
+	List(ctx context.Context, query Query) (Page, error)
+	// PutUsage records the stored size of an object for quota accounting, replacing the entry for
+	// the same key whichever tenant it was recorded for.
+	PutUsage(ctx context.Context, objectKey, tenant string, size int64) error
+	DeleteUsage(ctx context.Context, objectKey string) error
+	// TenantUsage returns the bytes and objects recorded for tenant.
+	TenantUsage(ctx context.Context, tenant string) (bytes, objects int64, err error)
+	UsageKeys(ctx context.Context) ([]string, error)
+	Close() error
+}
+
+type catalog struct {
+	db       *sql.DB
+	postgres bool
+	timeUtil timeutil.TimeUtil
+}
+
+// migrations upgrade the schema one version at a time, and the version reached is recorded in
+// schema_version. Databases created before schema_version existed start from version 0 like new
+// ones do, and the IF NOT EXISTS clauses of the first migration leave their tables as they are.
+var migrations = [][]string{
+	{
+		`CREATE TABLE IF NOT EXISTS uploads (
+			object_key TEXT PRIMARY KEY,
+			original_filename TEXT NOT NULL,
+			size BIGINT NOT NULL,
+			content_type TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			uploader TEXT NOT NULL,
+			tenant TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS uploads_tenant_created ON uploads (tenant, created_at, object_key)`,
+		`CREATE TABLE IF NOT EXISTS upload_tags (
+			object_key TEXT NOT NULL REFERENCES uploads (object_key) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (object_key, name)
+		)`,
+		`CREATE INDEX IF NOT EXISTS upload_tags_name_value ON upload_tags (name, value)`,
+	},
+	// Records are keyed by tenant as well as object key, and blob references are tracked for
+	// deduplicated uploads.
+	{
+		`CREATE TABLE uploads_by_tenant (
+			tenant TEXT NOT NULL,
+			object_key TEXT NOT NULL,
+			original_filename TEXT NOT NULL,
+			size BIGINT NOT NULL,
+			content_type TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			uploader TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL,
+			PRIMARY KEY (tenant, object_key)
+		)`,
+		`INSERT INTO uploads_by_tenant (` + columns + `)
+			SELECT ` + columns + ` FROM uploads`,
+		`CREATE TABLE upload_tags_by_tenant (
+			tenant TEXT NOT NULL,
+			object_key TEXT NOT NULL,
+			name TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (tenant, object_key, name)
+		)`,
+		`INSERT INTO upload_tags_by_tenant (tenant, object_key, name, value)
+			SELECT u.tenant, t.object_key, t.name, t.value FROM upload_tags t JOIN uploads u ON u.object_key = t.object_key`,
+		`DROP TABLE upload_tags`,
+		`DROP TABLE uploads`,
+		`ALTER TABLE uploads_by_tenant RENAME TO uploads`,
+		`ALTER TABLE upload_tags_by_tenant RENAME TO upload_tags`,
+		`CREATE INDEX uploads_tenant_created ON uploads (tenant, created_at, object_key)`,
+		`CREATE INDEX upload_tags_name_value ON upload_tags (name, value)`,
+		`CREATE TABLE object_references (
+			object_key TEXT NOT NULL,
+			owner TEXT NOT NULL,
+			PRIMARY KEY (object_key, owner)
+		)`,
+	},
+	// Quota usage is kept per object, with running totals per tenant.
+	{
+		`CREATE TABLE object_usage (
+			object_key TEXT PRIMARY KEY,
+			tenant TEXT NOT NULL,
+			size BIGINT NOT NULL
+		)`,
+		`CREATE TABLE tenant_usage (
+			tenant TEXT PRIMARY KEY,
+			bytes BIGINT NOT NULL,
+			objects BIGINT NOT NULL
+		)`,
+	},
+	// Deduplicated blobs have a single owner, named in their key, so references are not tracked.
+	{
+		`DROP TABLE object_references`,
+	},
+}
+
+// migrate brings the schema up to date in a single transaction. On Postgres, instances starting
+// together take turns, and later ones find the work done.
+func (c *catalog) migrate(ctx context.Context) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if c.postgres {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('catalog schema', 0))`); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (version BIGINT NOT NULL)`); err != nil {
+		return err
+	}
+	var version int
+	err = tx.QueryRowContext(ctx, `SELECT version FROM schema_version`).Scan(&version)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_version (version) VALUES (0)`); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than this build supports", version)
+	}
+	for i := version; i < len(migrations); i++ {
+		for _, statement := range migrations[i] {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("migrating to version %d: %w", i+1, err)
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx, c.rebind(`UPDATE schema_version SET version = ?`), len(migrations)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *catalog) Put(ctx context.Context, record Record) error {
+	now := c.timeUtil.Now().UTC()
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = now
+	}
+	record.UpdatedAt = now
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// created_at is kept on conflict so a re-upload under the same key keeps its place in listings.
+	_, err = tx.ExecContext(ctx, c.rebind(`INSERT INTO uploads
+		(tenant, object_key, original_filename, size, content_type, checksum, uploader, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (tenant, object_key) DO UPDATE SET
+			original_filename = excluded.original_filename,
+			size = excluded.size,
+			content_type = excluded.content_type,
+			checksum = excluded.checksum,
+			uploader = excluded.uploader,
+			updated_at = excluded.updated_at`),
+		record.Tenant, record.Key, record.OriginalFileName, record.Size, record.ContentType, record.Checksum,
+		record.Uploader, record.CreatedAt.UnixMilli(), record.UpdatedAt.UnixMilli())
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, c.rebind(`DELETE FROM upload_tags WHERE tenant = ? AND object_key = ?`), record.Tenant, record.Key); err != nil {
+		return err
+	}
+	for name, value := range record.Tags {
+		_, err := tx.ExecContext(ctx, c.rebind(`INSERT INTO upload_tags (tenant, object_key, name, value) VALUES (?, ?, ?, ?)`),
+			record.Tenant, record.Key, name, value)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (c *catalog) Get(ctx context.Context, tenant, objectKey string) (Record, error) {
+	page, err := c.query(ctx, `SELECT `+columns+` FROM uploads WHERE tenant = ? AND object_key = ?`, tenant, objectKey)
+	if err != nil {
+		return Record{}, err
+	}
+	if len(page) == 0 {
+		return Record{}, ErrNotFound
+	}
+	return page[0], nil
+}
+
+func (c *catalog) Delete(ctx context.Context, tenant, objectKey string) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, c.rebind(`DELETE FROM upload_tags WHERE tenant = ? AND object_key = ?`), tenant, objectKey); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, c.rebind(`DELETE FROM uploads WHERE tenant = ? AND object_key = ?`), tenant, objectKey); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *catalog) PutUsage(ctx context.Context, objectKey, tenant string, size int64) error {
+	tx, err := c.beginUsage(ctx, objectKey)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := c.removeUsage(ctx, tx, objectKey); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, c.rebind(`INSERT INTO object_usage (object_key, tenant, size) VALUES (?, ?, ?)`), objectKey, tenant, size); err != nil {
+		return err
+	}
+	if err := c.addTenantUsage(ctx, tx, tenant, size, 1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *catalog) DeleteUsage(ctx context.Context, objectKey string) error {
+	tx, err := c.beginUsage(ctx, objectKey)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := c.removeUsage(ctx, tx, objectKey); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// beginUsage starts a transaction that changes objectKey's usage. On Postgres it holds a lock on
+// the key until it ends, so instances writing the same key concurrently cannot both find it
+// unrecorded and count it twice.
+func (c *catalog) beginUsage(ctx context.Context, objectKey string) (*sql.Tx, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.postgres {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, objectKey); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// removeUsage deletes objectKey's entry and takes it off the totals of the tenant it was recorded for.
+func (c *catalog) removeUsage(ctx context.Context, tx *sql.Tx, objectKey string) error {
+	var tenant string
+	var size int64
+	err := tx.QueryRowContext(ctx, c.rebind(`SELECT tenant, size FROM object_usage WHERE object_key = ?`), objectKey).Scan(&tenant, &size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, c.rebind(`DELETE FROM object_usage WHERE object_key = ?`), objectKey); err != nil {
+		return err
+	}
+	return c.addTenantUsage(ctx, tx, tenant, -size, -1)
+}
+
+func (c *catalog) addTenantUsage(ctx context.Context, tx *sql.Tx, tenant string, bytes, objects int64) error {
+	_, err := tx.ExecContext(ctx, c.rebind(`INSERT INTO tenant_usage (tenant, bytes, objects) VALUES (?, ?, ?)
+		ON CONFLICT (tenant) DO UPDATE SET
+			bytes = tenant_usage.bytes + excluded.bytes,
+			objects = tenant_usage.objects + excluded.objects`), tenant, bytes, objects)
+	return err
+}
+
+func (c *catalog) TenantUsage(ctx context.Context, tenant string) (int64, int64, error) {
+	var bytes, objects int64
+	err := c.db.QueryRowContext(ctx, c.rebind(`SELECT bytes, objects FROM tenant_usage WHERE tenant = ?`), tenant).Scan(&bytes, &objects)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, nil
+	}
+	return bytes, objects, err
+}
+
+func (c *catalog) UsageKeys(ctx context.Context) ([]string, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT object_key FROM object_usage ORDER BY object_key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (c *catalog) List(ctx context.Context, q Query) (Page, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	where := []string{"tenant = ?"}
+	args := []any{q.Tenant}
+	if q.Search != "" {
+		where = append(where, `(LOWER(object_key) LIKE ? ESCAPE '\' OR LOWER(original_filename) LIKE ? ESCAPE '\')`)
+		pattern := "%" + escapeLike(strings.ToLower(q.Search)) + "%"
+		args = append(args, pattern, pattern)
+	}
+	if q.Prefix != "" {
+		where = append(where, `object_key LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLike(q.Prefix)+"%")
+	}
+	if q.ContentType != "" {
+		if major, ok := strings.CutSuffix(q.ContentType, "/*"); ok {
+			where = append(where, `content_type LIKE ? ESCAPE '\'`)
+			args = append(args, escapeLike(major)+"/%")
+		} else {
+			where = append(where, "content_type = ?")
+			args = append(args, q.ContentType)
+		}
+	}
+	if q.Uploader != "" {
+		where = append(where, "uploader = ?")
+		args = append(args, q.Uploader)
+	}
+	for name, value := range q.Tags {
+		if value == "" {
+			where = append(where, "EXISTS (SELECT 1 FROM upload_tags t WHERE t.tenant = uploads.tenant AND t.object_key = uploads.object_key AND t.name = ?)")
+			args = append(args, name)
+			continue
+		}
+		where = append(where, "EXISTS (SELECT 1 FROM upload_tags t WHERE t.tenant = uploads.tenant AND t.object_key = uploads.object_key AND t.name = ? AND t.value = ?)")
+		args = append(args, name, value)
+	}
+	if q.MinSize > 0 {
+		where = append(where, "size >= ?")
+		args = append(args, q.MinSize)
+	}
+	if q.MaxSize > 0 {
+		where = append(where, "size <= ?")
+		args = append(args, q.MaxSize)
+	}
+	if !q.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, q.CreatedAfter.UnixMilli())
+	}
+	if !q.CreatedBefore.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, q.CreatedBefore.UnixMilli())
+	}
+	if q.Cursor != "" {
+		createdAt, key, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		where = append(where, "(created_at < ? OR (created_at = ? AND object_key < ?))")
+		args = append(args, createdAt, createdAt, key)
+	}
+
+	// One extra row tells whether there is a next page.
+	records, err := c.query(ctx, `SELECT `+columns+` FROM uploads WHERE `+strings.Join(where, " AND ")+
+		` ORDER BY created_at DESC, object_key DESC LIMIT `+strconv.Itoa(limit+1), args...)
+	if err != nil {
+		return Page{}, err
+	}
+	page := Page{Records: records}
+	if len(records) > limit {
+		page.Records = records[:limit]
+		last := page.Records[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt.UnixMilli(), last.Key)
+	}
+	return page, nil
+}
+
+func (c *catalog) Close() error {
+	return c.db.Close()
+}
+
+const columns = `object_key, original_filename, size, content_type, checksum, uploader, tenant, created_at, updated_at`
+
+func (c *catalog) query(ctx context.Context, query string, args ...any) ([]Record, error) {
+	records, err := c.scan(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	// Tags are loaded once the rows are closed, since SQLite runs on a single connection.
+	if err := c.loadTags(ctx, records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (c *catalog) scan(ctx context.Context, query string, args ...any) ([]Record, error) {
+	rows, err := c.db.QueryContext(ctx, c.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		var r Record
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&r.Key, &r.OriginalFileName, &r.Size, &r.ContentType, &r.Checksum, &r.Uploader, &r.Tenant, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = time.UnixMilli(createdAt).UTC()
+		r.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+func (c *catalog) loadTags(ctx context.Context, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	// Records are always read for a single tenant.
+	index := make(map[string]*Record, len(records))
+	args := []any{records[0].Tenant}
+	for i := range records {
+		index[records[i].Key] = &records[i]
+		args = append(args, records[i].Key)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(records)), ", ")
+	rows, err := c.db.QueryContext(ctx, c.rebind(`SELECT object_key, name, value FROM upload_tags WHERE tenant = ? AND object_key IN (`+placeholders+`)`), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, name, value string
+		if err := rows.Scan(&key, &name, &value); err != nil {
+			return err
+		}
+		r := index[key]
+		if r.Tags == nil {
+			r.Tags = map[string]string{}
+		}
+		r.Tags[name] = value
+	}
+	return rows.Err()
+}
+
+// rebind rewrites ? placeholders as $1, $2, ... for Postgres. Queries never contain a literal ?.
+func (c *catalog) rebind(query string) string {
+	if !c.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func encodeCursor(createdAt int64, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(createdAt, 10) + ":" + key))
+}
+
+func decodeCursor(cursor string) (int64, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	createdAt, key, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return 0, "", ErrInvalidCursor
+	}
+	millis, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	return millis, key, nil
+}
+
+// NewCatalog opens the catalog database and creates or upgrades its tables. driver is DriverSQLite, with dsn a
+// file path, or DriverPostgres, with dsn a connection URL.
+func NewCatalog(driver, dsn string, timeUtil timeutil.TimeUtil) (Catalog, error) {
+	var db *sql.DB
+	var err error
+	switch driver {
+	case DriverSQLite, "":
+		db, err = sql.Open("sqlite3", dsn)
+		if err == nil {
+			// SQLite allows one writer at a time; a single connection avoids "database is locked".
+			db.SetMaxOpenConns(1)
+		}
+	case DriverPostgres:
+		db, err = sql.Open("pgx", dsn)
+	default:
+		return nil, fmt.Errorf("catalog: unknown driver %q", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &catalog{db: db, postgres: driver == DriverPostgres, timeUtil: timeUtil}
+	if err := c.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("catalog: migrating schema: %w", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,225 @@
+package catalog_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/catalog"
+	"github.com/haithamswe/multi-protocol-upload-api/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCatalog(t *testing.T) (catalog.Catalog, *time.Time) {
+	now := time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+	timeUtil := mocks.NewTimeUtil(t)
+	timeUtil.On("Now").Return(func() time.Time { return now }).Maybe()
+
+	c, err := catalog.NewCatalog(catalog.DriverSQLite, filepath.Join(t.TempDir(), "catalog.db"), timeUtil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, &now
+}
+
+func TestPutGet(t *testing.T) {
+	c, now := newTestCatalog(t)
+	ctx := context.Background()
+
+	record := catalog.Record{
+		Key:              "acme/report.pdf",
+		OriginalFileName: "Report.pdf",
+		Size:             1024,
+		ContentType:      "application/pdf",
+		Checksum:         "abc",
+		Uploader:         "key:0a1b2c",
+		Tenant:           "acme",
+		Tags:             map[string]string{"team": "billing", "draft": ""},
+	}
+	assert.NoError(t, c.Put(ctx, record))
+
+	got, err := c.Get(ctx, "acme", "acme/report.pdf")
+	assert.NoError(t, err)
+	record.CreatedAt, record.UpdatedAt = *now, *now
+	assert.Equal(t, record, got)
+
+	// Other tenants cannot see the record.
+	_, err = c.Get(ctx, "globex", "acme/report.pdf")
+	assert.ErrorIs(t, err, catalog.ErrNotFound)
+
+	// Re-uploading keeps the creation time and replaces the tags.
+	created := *now
+	*now = now.Add(time.Hour)
+	record.Size = 2048
+	record.Tags = map[string]string{"team": "sales"}
+	record.CreatedAt, record.UpdatedAt = time.Time{}, time.Time{}
+	assert.NoError(t, c.Put(ctx, record))
+	got, err = c.Get(ctx, "acme", "acme/report.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2048), got.Size)
+	assert.Equal(t, map[string]string{"team": "sales"}, got.Tags)
+	assert.Equal(t, created, got.CreatedAt)
+	assert.Equal(t, *now, got.UpdatedAt)
+
+	// Another tenant may hold a record for the same key, as happens with deduplicated uploads.
+	assert.NoError(t, c.Put(ctx, catalog.Record{Key: "acme/report.pdf", Tenant: "globex", Tags: map[string]string{"team": "ops"}}))
+	got, err = c.Get(ctx, "globex", "acme/report.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "ops"}, got.Tags)
+
+	assert.NoError(t, c.Delete(ctx, "acme", "acme/report.pdf"))
+	_, err = c.Get(ctx, "acme", "acme/report.pdf")
+	assert.ErrorIs(t, err, catalog.ErrNotFound)
+	_, err = c.Get(ctx, "globex", "acme/report.pdf")
+	assert.NoError(t, err)
+}
+
+func TestUsage(t *testing.T) {
+	c, _ := newTestCatalog(t)
+	ctx := context.Background()
+
+	assert.NoError(t, c.PutUsage(ctx, "a", "acme", 10))
+	assert.NoError(t, c.PutUsage(ctx, "b", "acme", 20))
+	// Overwriting a key replaces its size, and moves it when another tenant now owns it.
+	assert.NoError(t, c.PutUsage(ctx, "a", "acme", 15))
+	assert.NoError(t, c.PutUsage(ctx, "b", "globex", 5))
+	assert.NoError(t, c.DeleteUsage(ctx, "unknown"))
+
+	bytes, objects, err := c.TenantUsage(ctx, "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{15, 1}, []int64{bytes, objects})
+	bytes, objects, err = c.TenantUsage(ctx, "globex")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{5, 1}, []int64{bytes, objects})
+
+	assert.NoError(t, c.DeleteUsage(ctx, "a"))
+	bytes, objects, err = c.TenantUsage(ctx, "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0, 0}, []int64{bytes, objects})
+	keys, err := c.UsageKeys(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, keys)
+}
+
+func TestNewCatalog_MigratesOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	db, err := sql.Open("sqlite3", path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	for _, statement := range []string{
+		`CREATE TABLE uploads (object_key TEXT PRIMARY KEY, original_filename TEXT NOT NULL, size BIGINT NOT NULL,
+			content_type TEXT NOT NULL, checksum TEXT NOT NULL, uploader TEXT NOT NULL, tenant TEXT NOT NULL,
+			created_at BIGINT NOT NULL, updated_at BIGINT NOT NULL)`,
+		`CREATE TABLE upload_tags (object_key TEXT NOT NULL REFERENCES uploads (object_key) ON DELETE CASCADE,
+			name TEXT NOT NULL, value TEXT NOT NULL, PRIMARY KEY (object_key, name))`,
+		`INSERT INTO uploads VALUES ('acme/report.pdf', 'Report.pdf', 1024, 'application/pdf', 'abc', 'key:0a1b2c', 'acme', 0, 0)`,
+		`INSERT INTO upload_tags VALUES ('acme/report.pdf', 'team', 'billing')`,
+	} {
+		_, err := db.Exec(statement)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, db.Close())
+
+	timeUtil := mocks.NewTimeUtil(t)
+	timeUtil.On("Now").Return(time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)).Maybe()
+	for range 2 {
+		// Opening an upgraded catalog again leaves it as it is.
+		c, err := catalog.NewCatalog(catalog.DriverSQLite, path, timeUtil)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		got, err := c.Get(context.Background(), "acme", "acme/report.pdf")
+		assert.NoError(t, err)
+		assert.Equal(t, "Report.pdf", got.OriginalFileName)
+		assert.Equal(t, map[string]string{"team": "billing"}, got.Tags)
+
+		// Records are now keyed by tenant.
+		assert.NoError(t, c.Put(context.Background(), catalog.Record{Key: "acme/report.pdf", Tenant: "globex"}))
+		assert.NoError(t, c.PutUsage(context.Background(), "acme/report.pdf", "acme", 1024))
+		assert.NoError(t, c.Close())
+	}
+}
+
+func TestList(t *testing.T) {
+	c, now := newTestCatalog(t)
+	ctx := context.Background()
+
+	records := []catalog.Record{
+		{Key: "a/cat.png", OriginalFileName: "Cat.png", Size: 100, ContentType: "image/png", Uploader: "ip:10.0.0.1", Tenant: "acme", Tags: map[string]string{"album": "pets"}},
+		{Key: "a/dog.jpg", OriginalFileName: "dog.jpg", Size: 300, ContentType: "image/jpeg", Uploader: "ip:10.0.0.2", Tenant: "acme", Tags: map[string]string{"album": "pets", "best": ""}},
+		{Key: "b/invoice_1.pdf", OriginalFileName: "invoice 1.pdf", Size: 50, ContentType: "application/pdf", Uploader: "ip:10.0.0.1", Tenant: "acme"},
+		{Key: "b/other.pdf", Size: 10, ContentType: "application/pdf", Tenant: "globex"},
+	}
+	for _, r := range records {
+		assert.NoError(t, c.Put(ctx, r))
+		*now = now.Add(time.Minute)
+	}
+	start := now.Add(-4 * time.Minute)
+
+	tests := []struct {
+		name  string
+		query catalog.Query
+		keys  []string
+	}{
+		{"tenant", catalog.Query{Tenant: "acme"}, []string{"b/invoice_1.pdf", "a/dog.jpg", "a/cat.png"}},
+		{"search filename", catalog.Query{Tenant: "acme", Search: "CAT"}, []string{"a/cat.png"}},
+		{"search escapes wildcards", catalog.Query{Tenant: "acme", Search: "_1"}, []string{"b/invoice_1.pdf"}},
+		{"prefix", catalog.Query{Tenant: "acme", Prefix: "a/"}, []string{"a/dog.jpg", "a/cat.png"}},
+		{"content type", catalog.Query{Tenant: "acme", ContentType: "image/png"}, []string{"a/cat.png"}},
+		{"content type wildcard", catalog.Query{Tenant: "acme", ContentType: "image/*"}, []string{"a/dog.jpg", "a/cat.png"}},
+		{"uploader", catalog.Query{Tenant: "acme", Uploader: "ip:10.0.0.1"}, []string{"b/invoice_1.pdf", "a/cat.png"}},
+		{"tag value", catalog.Query{Tenant: "acme", Tags: map[string]string{"album": "pets"}}, []string{"a/dog.jpg", "a/cat.png"}},
+		{"tag present", catalog.Query{Tenant: "acme", Tags: map[string]string{"album": "pets", "best": ""}}, []string{"a/dog.jpg"}},
+		{"size", catalog.Query{Tenant: "acme", MinSize: 60, MaxSize: 200}, []string{"a/cat.png"}},
+		{"created range", catalog.Query{Tenant: "acme", CreatedAfter: start.Add(time.Minute), CreatedBefore: start.Add(2 * time.Minute)}, []string{"a/dog.jpg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := c.List(ctx, tt.query)
+			assert.NoError(t, err)
+			keys := []string{}
+			for _, r := range page.Records {
+				keys = append(keys, r.Key)
+			}
+			assert.Equal(t, tt.keys, keys)
+			assert.Empty(t, page.NextCursor)
+		})
+	}
+}
+
+func TestList_Pagination(t *testing.T) {
+	c, _ := newTestCatalog(t)
+	ctx := context.Background()
+
+	// Records created in the same millisecond are ordered by key.
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		assert.NoError(t, c.Put(ctx, catalog.Record{Key: key, Tenant: "acme"}))
+	}
+
+	var keys []string
+	query := catalog.Query{Tenant: "acme", Limit: 2}
+	for pages := 0; pages < 5; pages++ {
+		page, err := c.List(ctx, query)
+		assert.NoError(t, err)
+		for _, r := range page.Records {
+			keys = append(keys, r.Key)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"e", "d", "c", "b", "a"}, keys)
+
+	_, err := c.List(ctx, catalog.Query{Tenant: "acme", Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, catalog.ErrInvalidCursor)
+}
+
+func TestNewCatalog_UnknownDriver(t *testing.T) {
+	_, err := catalog.NewCatalog("mysql", "", mocks.NewTimeUtil(t))
+	assert.Error(t, err)
+}
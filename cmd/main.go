@@ -1,30 +1,72 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/haithamswe/multi-protocol-upload-api/archive"
+	"github.com/haithamswe/multi-protocol-upload-api/catalog"
+	"github.com/haithamswe/multi-protocol-upload-api/compression"
+	"github.com/haithamswe/multi-protocol-upload-api/contenttype"
+	"github.com/haithamswe/multi-protocol-upload-api/dedup"
+	"github.com/haithamswe/multi-protocol-upload-api/envelope"
 	"github.com/haithamswe/multi-protocol-upload-api/handlers"
+	"github.com/haithamswe/multi-protocol-upload-api/health"
+	"github.com/haithamswe/multi-protocol-upload-api/images"
+	"github.com/haithamswe/multi-protocol-upload-api/limits"
+	"github.com/haithamswe/multi-protocol-upload-api/logging"
+	"github.com/haithamswe/multi-protocol-upload-api/metrics"
+	"github.com/haithamswe/multi-protocol-upload-api/objectkey"
+	"github.com/haithamswe/multi-protocol-upload-api/quota"
+	"github.com/haithamswe/multi-protocol-upload-api/ratelimit"
+	"github.com/haithamswe/multi-protocol-upload-api/requestid"
 	"github.com/haithamswe/multi-protocol-upload-api/s3"
+	"github.com/haithamswe/multi-protocol-upload-api/scanner"
+	"github.com/haithamswe/multi-protocol-upload-api/server"
+	"github.com/haithamswe/multi-protocol-upload-api/tracing"
+	"github.com/haithamswe/multi-protocol-upload-api/utils/envutil"
 	"github.com/haithamswe/multi-protocol-upload-api/utils/timeutil"
 	"github.com/haithamswe/multi-protocol-upload-api/utils/uuidutil"
 	"github.com/joho/godotenv"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// rebuildAttempts bounds how often a failed usage rebuild is retried, 30 seconds apart at first
+// and twice as long after every further failure.
+const rebuildAttempts = 5
+
+var logLevel = new(slog.LevelVar)
+
 func main() {
+	logger := logging.New(os.Stdout, logLevel)
+	// Route the standard log package, and anything that still uses it, through the redacting logger.
+	slog.SetDefault(logger)
+
 	_, filename, _, ok := runtime.Caller(0)
 	if !ok {
-		log.Fatal("Error: Unable to get caller info")
+		fatal("Unable to get caller info", nil)
 	}
 
 	projectRoot := filepath.Dir(filepath.Dir(filename))
 	envPath := filepath.Join(projectRoot, ".env")
 	if err := godotenv.Load(envPath); err != nil {
-		log.Fatal("Error loading .env file from root:", err)
+		fatal("Error loading .env file from root", err)
 	}
+	level, err := logging.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		fatal("Invalid LOG_LEVEL", err)
+	}
+	logLevel.Set(level)
 
 	bucket := os.Getenv("S3_BUCKET")
 	region := os.Getenv("S3_REGION")
@@ -33,15 +75,586 @@ func main() {
 	port := os.Getenv("SERVER_PORT")
 
 	if bucket == "" || region == "" || accessKey == "" || secretKey == "" || port == "" {
-		log.Fatal("Missing required environment variables")
+		fatal("Missing required environment variables", nil)
+	}
+
+	tracingConfig, err := loadTracingConfig()
+	if err != nil {
+		fatal("Invalid tracing configuration", err)
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingConfig)
+	if err != nil {
+		fatal("Could not set up tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	uploadLimits, err := loadUploadLimits()
+	if err != nil {
+		fatal("Invalid upload limits configuration", err)
+	}
+
+	contentTypePolicy, err := loadContentTypePolicy()
+	if err != nil {
+		fatal("Invalid content type configuration", err)
+	}
+	rejectTypeMismatch, err := envutil.Bool("CONTENT_TYPE_REJECT_MISMATCH", true)
+	if err != nil {
+		fatal("Invalid content type configuration", err)
+	}
+
+	maxTenantLabels, err := envutil.Int64("METRICS_MAX_TENANTS", 100)
+	if err != nil {
+		fatal("Invalid metrics configuration", err)
+	}
+	m := metrics.NewPrometheusMetrics(int(maxTenantLabels))
+
+	handlerOptions := []handlers.Option{
+		handlers.WithMetrics(m),
+		handlers.WithUploadLimits(uploadLimits),
+		handlers.WithContentTypePolicy(contentTypePolicy, rejectTypeMismatch),
+	}
+	if clamdAddress := os.Getenv("CLAMD_ADDRESS"); clamdAddress != "" {
+		timeoutSeconds, err := envutil.Int64("CLAMD_TIMEOUT_SECONDS", 30)
+		if err != nil {
+			fatal("Invalid scanner configuration", err)
+		}
+		clamd, err := scanner.NewClamd(clamdAddress, time.Duration(timeoutSeconds)*time.Second)
+		if err != nil {
+			fatal("Invalid scanner configuration", err)
+		}
+		handlerOptions = append(handlerOptions, handlers.WithScanner(clamd, os.Getenv("SCAN_QUARANTINE_PREFIX")))
 	}
 
 	timeUtil := timeutil.NewTimeUtil()
 	uuidUtil := uuidutil.NewUUIDUtil()
-	s3Client := s3.NewS3(bucket, region, accessKey, secretKey, timeUtil, uuidUtil)
-	handlers := handlers.NewHandlers(s3Client)
+	retryPolicy, err := loadRetryPolicy()
+	if err != nil {
+		fatal("Invalid retry configuration", err)
+	}
+	transportConfig, err := loadTransportConfig()
+	if err != nil {
+		fatal("Invalid S3 transport configuration", err)
+	}
+	httpClient, err := s3.NewHTTPClient(transportConfig)
+	if err != nil {
+		fatal("Invalid S3 transport configuration", err)
+	}
+	keyStrategy, err := objectkey.NewStrategy(os.Getenv("S3_KEY_STRATEGY"), timeUtil, uuidUtil)
+	if err != nil {
+		fatal("Invalid key strategy", err)
+	}
+	dedupEnabled, err := envutil.Bool("DEDUP_ENABLED", false)
+	if err != nil {
+		fatal("Invalid deduplication configuration", err)
+	}
+	dedupPrefix := os.Getenv("DEDUP_PREFIX")
+	if dedupPrefix == "" {
+		dedupPrefix = dedup.DefaultPrefix
+	}
+	s3Options := []s3.Option{
+		s3.WithKeyStrategy(keyStrategy),
+		s3.WithRetryPolicy(retryPolicy),
+		s3.WithHTTPClient(httpClient),
+		s3.WithMetrics(m),
+	}
+	if dedupEnabled {
+		// No other upload may land among the blobs, whatever its key template or tenant.
+		s3Options = append(s3Options, s3.WithReservedPrefix(dedupPrefix))
+	}
+	s3Client := s3.NewS3(bucket, region, accessKey, secretKey, timeUtil, uuidUtil, s3Options...)
+	encryptionPolicy, err := loadEncryptionPolicy()
+	if err != nil {
+		fatal("Invalid encryption configuration", err)
+	}
+	handlerOptions = append(handlerOptions, handlers.WithEncryption(encryptionPolicy))
+	compressor, err := loadCompressor()
+	if err != nil {
+		fatal("Invalid compression configuration", err)
+	}
+	if compressor != nil {
+		handlerOptions = append(handlerOptions, handlers.WithCompression(compressor))
+	}
+	if keyringPath := os.Getenv("ENVELOPE_KEYRING"); keyringPath != "" {
+		encryptor, err := envelope.LoadKeyring(keyringPath)
+		if err != nil {
+			fatal("Invalid envelope encryption configuration", err)
+		}
+		handlerOptions = append(handlerOptions, handlers.WithEnvelopeEncryption(encryptor))
+	}
+	extractionEnabled, err := envutil.Bool("ARCHIVE_EXTRACTION_ENABLED", false)
+	if err != nil {
+		fatal("Invalid archive extraction configuration", err)
+	}
+	if extractionEnabled {
+		archiveLimits, err := loadArchiveLimits()
+		if err != nil {
+			fatal("Invalid archive extraction configuration", err)
+		}
+		handlerOptions = append(handlerOptions, handlers.WithArchiveExtraction(keyStrategy, archiveLimits))
+	}
+	imageProcessor, err := loadImageProcessor()
+	if err != nil {
+		fatal("Invalid image processing configuration", err)
+	}
+	if imageProcessor != nil {
+		handlerOptions = append(handlerOptions, handlers.WithImageProcessing(imageProcessor, os.Getenv("IMAGE_DERIVATIVE_PREFIX")))
+	}
+	if dedupEnabled {
+		handlerOptions = append(handlerOptions, handlers.WithDeduplication(dedup.NewDeduplicator(s3Client, dedupPrefix)))
+	}
+	usageStore := quota.NewMemoryStore()
+	// The catalog is opt-in, so an unset driver does not create a database file in the working directory.
+	if driver := os.Getenv("CATALOG_DRIVER"); driver != "" && driver != "none" {
+		dsn := os.Getenv("CATALOG_DSN")
+		if dsn == "" {
+			dsn = "catalog.db"
+		}
+		fileCatalog, err := catalog.NewCatalog(driver, dsn, timeUtil)
+		if err != nil {
+			fatal("Could not open the file catalog", err)
+		}
+		defer fileCatalog.Close()
+		handlerOptions = append(handlerOptions, handlers.WithCatalog(fileCatalog))
+		// Usage kept in the catalog is shared by every instance using the same database.
+		usageStore = fileCatalog
+	}
+	quotas, quotaForbidden, err := loadQuotas(usageStore)
+	if err != nil {
+		fatal("Invalid quota configuration", err)
+	}
+	if quotas != nil {
+		handlerOptions = append(handlerOptions, handlers.WithQuotas(quotas, quotaForbidden))
+	}
+	handlers := handlers.NewHandlers(s3Client, handlerOptions...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	usageReady, err := rebuildUsage(ctx, logger, quotas, s3Client)
+	if err != nil {
+		fatal("Invalid quota configuration", err)
+	}
+
+	rateLimitConfig, err := loadRateLimitConfig()
+	if err != nil {
+		fatal("Invalid rate limit configuration", err)
+	}
+	keyFunc, err := ratelimit.NewKeyFunc(os.Getenv("RATE_LIMIT_KEY"), envutil.List("RATE_LIMIT_KNOWN_CLIENTS"))
+	if err != nil {
+		fatal("Invalid rate limit configuration", err)
+	}
+	limiter := ratelimit.NewLimiter(rateLimitConfig, keyFunc, timeUtil)
+
+	mux := http.NewServeMux()
+	mux.Handle("/upload-to-s3", limiter.Requests(limiter.Uploads(http.HandlerFunc(handlers.UploadToS3))))
+	mux.Handle("/get-presigned-s3-url", limiter.Requests(http.HandlerFunc(handlers.GetPresignedS3Url)))
+	mux.Handle("/delete-from-s3", limiter.Requests(http.HandlerFunc(handlers.DeleteFromS3)))
+	mux.Handle("/usage", limiter.Requests(http.HandlerFunc(handlers.GetUsage)))
+	mux.Handle("/files", limiter.Requests(http.HandlerFunc(handlers.ListFiles)))
+	mux.Handle("/file", limiter.Requests(http.HandlerFunc(handlers.GetFile)))
+	mux.Handle("/metadata", limiter.Requests(http.HandlerFunc(handlers.GetMetadata)))
+	mux.Handle("/download", limiter.Requests(http.HandlerFunc(handlers.Download)))
+	mux.Handle("/download-zip", limiter.Requests(http.HandlerFunc(handlers.DownloadZip)))
+	mux.Handle("/metrics", m.Handler())
+
+	readinessTimeout, err := envutil.Seconds("READINESS_TIMEOUT_SECONDS", 5*time.Second)
+	if err != nil {
+		fatal("Invalid readiness configuration", err)
+	}
+	checks := map[string]health.Check{"s3": s3Client.HeadBucket}
+	if usageReady != nil {
+		checks["usage"] = usageReady
+	}
+	healthChecks := health.NewHealth(checks, readinessTimeout)
+	mux.HandleFunc("/healthz", healthChecks.Healthz)
+	mux.HandleFunc("/readyz", healthChecks.Readyz)
+
+	serverConfig, err := loadServerConfig()
+	if err != nil {
+		fatal("Invalid server configuration", err)
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		fatal("Could not listen", err)
+	}
+
+	handler := requestid.Middleware(uuidUtil)(logging.Middleware(logger)(mux))
+	logger.Info("Listening", "port", port)
+	err = server.Serve(ctx, server.New(handler, serverConfig), ln, serverConfig.DrainDelay, serverConfig.ShutdownTimeout, func() {
+		logger.Info("Shutting down, draining in-flight requests", "drain_delay", serverConfig.DrainDelay.String(), "timeout", serverConfig.ShutdownTimeout.String())
+		healthChecks.Drain()
+	})
+	if err != nil {
+		logger.Error("Server stopped", "error", err)
+		return
+	}
+	logger.Info("Server stopped")
+}
+
+func fatal(msg string, err error) {
+	if err != nil {
+		slog.Error(msg, "error", err)
+	} else {
+		slog.Error(msg)
+	}
+	os.Exit(1)
+}
+
+func loadUploadLimits() (limits.SizeLimits, error) {
+	maxBytes, err := envutil.Int64("UPLOAD_MAX_BYTES", 0)
+	if err != nil {
+		return nil, err
+	}
+	perTenant, err := envutil.Int64Map("UPLOAD_MAX_BYTES_PER_TENANT")
+	if err != nil {
+		return nil, err
+	}
+	perRoute, err := envutil.Int64Map("UPLOAD_MAX_BYTES_PER_ROUTE")
+	if err != nil {
+		return nil, err
+	}
+	minBytes, err := envutil.Int64("UPLOAD_MIN_BYTES", 0)
+	if err != nil {
+		return nil, err
+	}
+	rejectEmpty, err := envutil.Bool("UPLOAD_REJECT_EMPTY", false)
+	if err != nil {
+		return nil, err
+	}
+	return limits.NewSizeLimits(maxBytes, perTenant, perRoute, minBytes, rejectEmpty), nil
+}
+
+func loadContentTypePolicy() (contenttype.Policy, error) {
+	global := contenttype.Rules{
+		Allowed: envutil.List("CONTENT_TYPE_ALLOWED"),
+		Blocked: envutil.List("CONTENT_TYPE_BLOCKED"),
+	}
+	allowedPerRoute, err := envutil.Map("CONTENT_TYPE_ALLOWED_PER_ROUTE")
+	if err != nil {
+		return nil, err
+	}
+	blockedPerRoute, err := envutil.Map("CONTENT_TYPE_BLOCKED_PER_ROUTE")
+	if err != nil {
+		return nil, err
+	}
+
+	perRoute := map[string]contenttype.Rules{}
+	for route, types := range allowedPerRoute {
+		rules := perRoute[route]
+		rules.Allowed = strings.Split(types, "|")
+		perRoute[route] = rules
+	}
+	for route, types := range blockedPerRoute {
+		rules := perRoute[route]
+		rules.Blocked = strings.Split(types, "|")
+		perRoute[route] = rules
+	}
+	return contenttype.NewPolicy(global, perRoute), nil
+}
+
+// loadCompressor returns nil when compression is disabled.
+func loadCompressor() (compression.Compressor, error) {
+	encoding, err := compression.ParseEncoding(os.Getenv("COMPRESSION"))
+	if err != nil || encoding == compression.None {
+		return nil, err
+	}
+	minBytes, err := envutil.Int64("COMPRESSION_MIN_BYTES", compression.DefaultMinBytes)
+	if err != nil {
+		return nil, err
+	}
+	return compression.NewCompressor(encoding, envutil.List("COMPRESSION_TYPES"), minBytes)
+}
+
+func loadArchiveLimits() (archive.Limits, error) {
+	maxEntries, err := envutil.Int64("ARCHIVE_MAX_ENTRIES", int64(archive.DefaultLimits.MaxEntries))
+	if err != nil {
+		return archive.Limits{}, err
+	}
+	maxBytes, err := envutil.Int64("ARCHIVE_MAX_BYTES", archive.DefaultLimits.MaxBytes)
+	if err != nil {
+		return archive.Limits{}, err
+	}
+	maxRatio, err := envutil.Float64("ARCHIVE_MAX_RATIO", archive.DefaultLimits.MaxRatio)
+	if err != nil {
+		return archive.Limits{}, err
+	}
+	return archive.Limits{MaxEntries: int(maxEntries), MaxBytes: maxBytes, MaxRatio: maxRatio}, nil
+}
+
+// loadImageProcessor returns nil when no derivatives are configured.
+func loadImageProcessor() (images.Processor, error) {
+	derivatives, err := images.ParseDerivatives(os.Getenv("IMAGE_DERIVATIVES"))
+	if err != nil || len(derivatives) == 0 {
+		return nil, err
+	}
+	maxPixels, err := envutil.Int64("IMAGE_MAX_PIXELS", images.DefaultMaxPixels)
+	if err != nil {
+		return nil, err
+	}
+	return images.NewProcessor(derivatives, maxPixels), nil
+}
+
+func loadRetryPolicy() (s3.RetryPolicy, error) {
+	policy := s3.DefaultRetryPolicy
+	maxAttempts, err := envutil.Int64("S3_MAX_ATTEMPTS", int64(policy.MaxAttempts))
+	if err != nil {
+		return policy, err
+	}
+	baseDelayMs, err := envutil.Int64("S3_RETRY_BASE_DELAY_MS", policy.BaseDelay.Milliseconds())
+	if err != nil {
+		return policy, err
+	}
+	maxDelayMs, err := envutil.Int64("S3_RETRY_MAX_DELAY_MS", policy.MaxDelay.Milliseconds())
+	if err != nil {
+		return policy, err
+	}
+	budgetTokens, err := envutil.Int64("S3_RETRY_BUDGET", int64(policy.BudgetTokens))
+	if err != nil {
+		return policy, err
+	}
+	policy.MaxAttempts = int(maxAttempts)
+	policy.BaseDelay = time.Duration(baseDelayMs) * time.Millisecond
+	policy.MaxDelay = time.Duration(maxDelayMs) * time.Millisecond
+	policy.BudgetTokens = int(budgetTokens)
+	return policy, nil
+}
+
+func loadEncryptionPolicy() (s3.EncryptionPolicy, error) {
+	var defaultEncryption s3.Encryption
+	var err error
+	if defaultEncryption.Mode, err = s3.ParseEncryptionMode(os.Getenv("S3_SSE")); err != nil {
+		return nil, err
+	}
+	defaultEncryption.KMSKeyID = os.Getenv("S3_SSE_KMS_KEY_ID")
+	if defaultEncryption.KMSContext, err = envutil.Map("S3_SSE_KMS_CONTEXT"); err != nil {
+		return nil, err
+	}
+	modes, err := envutil.Map("S3_SSE_PER_TENANT")
+	if err != nil {
+		return nil, err
+	}
+	keyIDs, err := envutil.Map("S3_SSE_KMS_KEY_ID_PER_TENANT")
+	if err != nil {
+		return nil, err
+	}
+	perTenant := map[string]s3.Encryption{}
+	for tenant, mode := range modes {
+		encryption := defaultEncryption
+		if encryption.Mode, err = s3.ParseEncryptionMode(mode); err != nil {
+			return nil, fmt.Errorf("S3_SSE_PER_TENANT[%s]: %w", tenant, err)
+		}
+		perTenant[tenant] = encryption
+	}
+	for tenant, keyID := range keyIDs {
+		encryption, ok := perTenant[tenant]
+		if !ok {
+			encryption = defaultEncryption
+		}
+		if encryption.Mode != s3.EncryptionKMS {
+			return nil, fmt.Errorf("S3_SSE_KMS_KEY_ID_PER_TENANT[%s]: the tenant does not use SSE-KMS", tenant)
+		}
+		encryption.KMSKeyID = keyID
+		perTenant[tenant] = encryption
+	}
+	allowOverride, err := envutil.Bool("S3_SSE_ALLOW_OVERRIDE", false)
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewEncryptionPolicy(defaultEncryption, perTenant, allowOverride), nil
+}
+
+func loadTransportConfig() (s3.TransportConfig, error) {
+	cfg := s3.DefaultTransportConfig
+	var err error
+	durations := []struct {
+		key    string
+		target *time.Duration
+	}{
+		{"S3_CONNECT_TIMEOUT_SECONDS", &cfg.ConnectTimeout},
+		{"S3_TLS_HANDSHAKE_TIMEOUT_SECONDS", &cfg.TLSHandshakeTimeout},
+		{"S3_RESPONSE_HEADER_TIMEOUT_SECONDS", &cfg.ResponseHeaderTimeout},
+		{"S3_TIMEOUT_SECONDS", &cfg.Timeout},
+		{"S3_IDLE_CONN_TIMEOUT_SECONDS", &cfg.IdleConnTimeout},
+	}
+	for _, d := range durations {
+		if *d.target, err = envutil.Seconds(d.key, *d.target); err != nil {
+			return cfg, err
+		}
+	}
+	counts := []struct {
+		key    string
+		target *int
+	}{
+		{"S3_MAX_IDLE_CONNS", &cfg.MaxIdleConns},
+		{"S3_MAX_IDLE_CONNS_PER_HOST", &cfg.MaxIdleConnsPerHost},
+		{"S3_MAX_CONNS_PER_HOST", &cfg.MaxConnsPerHost},
+	}
+	for _, c := range counts {
+		value, err := envutil.Int64(c.key, int64(*c.target))
+		if err != nil {
+			return cfg, err
+		}
+		*c.target = int(value)
+	}
+	if cfg.EnableHTTP2, err = envutil.Bool("S3_ENABLE_HTTP2", cfg.EnableHTTP2); err != nil {
+		return cfg, err
+	}
+	cfg.CABundlePath = os.Getenv("S3_CA_BUNDLE")
+	cfg.ProxyURL = os.Getenv("S3_PROXY_URL")
+	return cfg, nil
+}
+
+func loadQuotas(store quota.Store) (quota.Quotas, bool, error) {
+	var limit quota.Limit
+	var err error
+	if limit.MaxBytes, err = envutil.Int64("QUOTA_MAX_BYTES", 0); err != nil {
+		return nil, false, err
+	}
+	if limit.MaxObjects, err = envutil.Int64("QUOTA_MAX_OBJECTS", 0); err != nil {
+		return nil, false, err
+	}
+	bytesPerTenant, err := envutil.Int64Map("QUOTA_MAX_BYTES_PER_TENANT")
+	if err != nil {
+		return nil, false, err
+	}
+	objectsPerTenant, err := envutil.Int64Map("QUOTA_MAX_OBJECTS_PER_TENANT")
+	if err != nil {
+		return nil, false, err
+	}
+	if limit == (quota.Limit{}) && len(bytesPerTenant) == 0 && len(objectsPerTenant) == 0 {
+		// Without a limit there is nothing to enforce, so usage is not tracked either.
+		return nil, false, nil
+	}
+	perTenant := map[string]quota.Limit{}
+	for tenant, maxBytes := range bytesPerTenant {
+		tenantLimit := limit
+		tenantLimit.MaxBytes = maxBytes
+		perTenant[tenant] = tenantLimit
+	}
+	for tenant, maxObjects := range objectsPerTenant {
+		tenantLimit, ok := perTenant[tenant]
+		if !ok {
+			tenantLimit = limit
+		}
+		tenantLimit.MaxObjects = maxObjects
+		perTenant[tenant] = tenantLimit
+	}
+
+	status, err := envutil.Int64("QUOTA_EXCEEDED_STATUS", http.StatusInsufficientStorage)
+	if err != nil {
+		return nil, false, err
+	}
+	if status != http.StatusInsufficientStorage && status != http.StatusForbidden {
+		return nil, false, fmt.Errorf("QUOTA_EXCEEDED_STATUS must be 507 or 403, got %d", status)
+	}
+	return quota.NewQuotas(limit, perTenant, store), status == http.StatusForbidden, nil
+}
+
+// rebuildUsage recomputes usage from the bucket in the background when QUOTA_REBUILD_ON_START is
+// set. The returned readiness check fails until it has finished, so quotas are not enforced
+// against an empty accounting, and is nil when there is no rebuild to wait for.
+func rebuildUsage(ctx context.Context, logger *slog.Logger, quotas quota.Quotas, s3Client s3.S3) (health.Check, error) {
+	enabled, err := envutil.Bool("QUOTA_REBUILD_ON_START", false)
+	if err != nil {
+		return nil, err
+	}
+	concurrency, err := envutil.Int64("QUOTA_REBUILD_CONCURRENCY", 8)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled || quotas == nil {
+		return nil, nil
+	}
+
+	var done atomic.Bool
+	go func() {
+		defer done.Store(true)
+		delay := 30 * time.Second
+		for attempt := 1; ; attempt++ {
+			start := time.Now()
+			err := quotas.Rebuild(ctx, quota.S3Lister(s3Client, int(concurrency)))
+			if err == nil {
+				logger.Info("Rebuilt usage from the bucket", "duration", time.Since(start).String())
+				return
+			}
+			if attempt == rebuildAttempts {
+				logger.Error("Could not rebuild usage from the bucket, enforcing quotas against the usage recorded so far", "error", err)
+				return
+			}
+			logger.Error("Could not rebuild usage from the bucket, retrying", "error", err, "retry_in", delay.String())
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+	}()
+	return func(context.Context) error {
+		if !done.Load() {
+			return errors.New("usage is being rebuilt")
+		}
+		return nil
+	}, nil
+}
 
-	http.HandleFunc("/upload-to-s3", handlers.UploadToS3)
-	http.HandleFunc("/get-presigned-s3-url", handlers.GetPresignedS3Url)
-	http.ListenAndServe(fmt.Sprintf(":%s", port), nil)
+func loadRateLimitConfig() (ratelimit.Config, error) {
+	var cfg ratelimit.Config
+	var err error
+	if cfg.RequestsPerSecond, err = envutil.Float64("RATE_LIMIT_REQUESTS_PER_SECOND", 0); err != nil {
+		return cfg, err
+	}
+	requestBurst, err := envutil.Int64("RATE_LIMIT_REQUEST_BURST", int64(max(cfg.RequestsPerSecond, 1)))
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.BytesPerSecond, err = envutil.Float64("RATE_LIMIT_BYTES_PER_SECOND", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.ByteBurst, err = envutil.Int64("RATE_LIMIT_BYTE_BURST", int64(cfg.BytesPerSecond)); err != nil {
+		return cfg, err
+	}
+	maxConcurrent, err := envutil.Int64("MAX_CONCURRENT_UPLOADS", 0)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.RequestBurst = int(requestBurst)
+	cfg.MaxConcurrentUploads = int(maxConcurrent)
+	return cfg, nil
+}
+
+func loadServerConfig() (server.Config, error) {
+	cfg := server.DefaultConfig
+	var err error
+	durations := []struct {
+		key    string
+		target *time.Duration
+	}{
+		{"SERVER_READ_HEADER_TIMEOUT_SECONDS", &cfg.ReadHeaderTimeout},
+		{"SERVER_READ_TIMEOUT_SECONDS", &cfg.ReadTimeout},
+		{"SERVER_WRITE_TIMEOUT_SECONDS", &cfg.WriteTimeout},
+		{"SERVER_IDLE_TIMEOUT_SECONDS", &cfg.IdleTimeout},
+		{"SHUTDOWN_DRAIN_DELAY_SECONDS", &cfg.DrainDelay},
+		{"SHUTDOWN_TIMEOUT_SECONDS", &cfg.ShutdownTimeout},
+	}
+	for _, d := range durations {
+		if *d.target, err = envutil.Seconds(d.key, *d.target); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+func loadTracingConfig() (tracing.Config, error) {
+	sampleRatio, err := envutil.Float64("TRACING_SAMPLE_RATIO", 1)
+	if err != nil {
+		return tracing.Config{}, err
+	}
+	return tracing.Config{
+		Exporter:     os.Getenv("TRACING_EXPORTER"),
+		OTLPEndpoint: os.Getenv("TRACING_OTLP_ENDPOINT"),
+		FilePath:     os.Getenv("TRACING_FILE"),
+		ServiceName:  os.Getenv("TRACING_SERVICE_NAME"),
+		SampleRatio:  sampleRatio,
+	}, nil
 }
@@ -0,0 +1,131 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/haithamswe/multi-protocol-upload-api/contenttype"
+	"github.com/klauspost/compress/zstd"
+)
+
+type Encoding string
+
+const (
+	None Encoding = ""
+	Gzip Encoding = "gzip"
+	Zstd Encoding = "zstd"
+)
+
+// SizeMetadata is the metadata name under which the size of compressed content is recorded
+// before compression.
+const SizeMetadata = "uncompressed-size"
+
+// DefaultMinBytes is the size below which content is not worth compressing.
+const DefaultMinBytes = 1024
+
+// DefaultTypes are content types that usually compress well.
+var DefaultTypes = []string{
+	"text/*",
+	"application/json",
+	"application/x-ndjson",
+	"application/xml",
+	"application/javascript",
+	"application/x-yaml",
+	"application/yaml",
+	"application/x-tar",
+	"image/svg+xml",
+}
+
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// ParseEncoding reads an encoding name. Empty and "none" mean no compression.
+func ParseEncoding(value string) (Encoding, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "none":
+		return None, nil
+	case "gzip":
+		return Gzip, nil
+	case "zstd":
+		return Zstd, nil
+	}
+	return None, fmt.Errorf("%w %q, expected none, gzip or zstd", ErrUnsupportedEncoding, value)
+}
+
+type Compressor interface {
+	// Compress returns data compressed and the encoding used. Content that is not of a
+	// compressible type, is too small or does not shrink is returned as is, with None.
+	Compress(data []byte, contentType string) ([]byte, Encoding, error)
+}
+
+type compressor struct {
+	encoding Encoding
+	types    []string
+	minBytes int64
+	zstd     *zstd.Encoder
+}
+
+func (c *compressor) Compress(data []byte, contentType string) ([]byte, Encoding, error) {
+	if int64(len(data)) < c.minBytes || !contenttype.Matches(c.types, contentType) {
+		return data, None, nil
+	}
+	var compressed []byte
+	switch c.encoding {
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, None, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, None, err
+		}
+		compressed = buf.Bytes()
+	case Zstd:
+		compressed = c.zstd.EncodeAll(data, make([]byte, 0, len(data)/2))
+	}
+	if len(compressed) >= len(data) {
+		return data, None, nil
+	}
+	return compressed, c.encoding, nil
+}
+
+// NewReader decodes content stored with encoding.
+func NewReader(r io.Reader, encoding Encoding) (io.ReadCloser, error) {
+	switch encoding {
+	case None:
+		return io.NopCloser(r), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+}
+
+// NewCompressor compresses content whose type matches types, DefaultTypes when empty, and which is
+// at least minBytes long.
+func NewCompressor(encoding Encoding, types []string, minBytes int64) (Compressor, error) {
+	if encoding != Gzip && encoding != Zstd {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+	if len(types) == 0 {
+		types = DefaultTypes
+	}
+	c := &compressor{encoding: encoding, types: types, minBytes: minBytes}
+	if encoding == Zstd {
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		c.zstd = encoder
+	}
+	return c, nil
+}
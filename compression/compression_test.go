@@ -0,0 +1,65 @@
+package compression_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/compression"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompress(t *testing.T) {
+	logs := bytes.Repeat([]byte("2025-02-24T10:15:00Z INFO request handled status=200\n"), 100)
+	random := make([]byte, 4096)
+	rand.Read(random)
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		compressed  bool
+	}{
+		{name: "Compressible text", data: logs, contentType: "text/plain; charset=utf-8", compressed: true},
+		{name: "Other content type", data: logs, contentType: "image/png"},
+		{name: "Too small", data: logs[:100], contentType: "text/plain"},
+		{name: "Does not shrink", data: random, contentType: "text/plain"},
+	}
+
+	for _, encoding := range []compression.Encoding{compression.Gzip, compression.Zstd} {
+		c, err := compression.NewCompressor(encoding, nil, compression.DefaultMinBytes)
+		assert.NoError(t, err)
+		for _, tt := range tests {
+			t.Run(string(encoding)+"/"+tt.name, func(t *testing.T) {
+				out, used, err := c.Compress(tt.data, tt.contentType)
+
+				assert.NoError(t, err)
+				if !tt.compressed {
+					assert.Equal(t, compression.None, used)
+					assert.Equal(t, tt.data, out)
+					return
+				}
+				assert.Equal(t, encoding, used)
+				assert.Less(t, len(out), len(tt.data)/10)
+				r, err := compression.NewReader(bytes.NewReader(out), used)
+				assert.NoError(t, err)
+				defer r.Close()
+				decoded, err := io.ReadAll(r)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.data, decoded)
+			})
+		}
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	for value, expected := range map[string]compression.Encoding{"": compression.None, "none": compression.None, "GZIP": compression.Gzip, "zstd": compression.Zstd} {
+		encoding, err := compression.ParseEncoding(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, encoding, value)
+	}
+	_, err := compression.ParseEncoding("br")
+	assert.ErrorIs(t, err, compression.ErrUnsupportedEncoding)
+	_, err = compression.NewReader(bytes.NewReader(nil), "br")
+	assert.ErrorIs(t, err, compression.ErrUnsupportedEncoding)
+}
@@ -0,0 +1,154 @@
+package contenttype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	OctetStream = "application/octet-stream"
+	textPlain   = "text/plain"
+	msDownload  = "application/x-msdownload"
+)
+
+var (
+	ErrNotAllowed = errors.New("content type is not allowed")
+	ErrMismatch   = errors.New("content does not match file extension")
+)
+
+// signatures covers formats http.DetectContentType does not know about, mostly executables
+// and office containers that must not slip through as a generic octet-stream.
+var signatures = []struct {
+	prefix      []byte
+	contentType string
+}{
+	{[]byte("\x7fELF"), "application/x-executable"},
+	{[]byte("\xfe\xed\xfa\xce"), "application/x-mach-binary"},
+	{[]byte("\xfe\xed\xfa\xcf"), "application/x-mach-binary"},
+	{[]byte("\xcf\xfa\xed\xfe"), "application/x-mach-binary"},
+	{[]byte("\xca\xfe\xba\xbe"), "application/java-vm"},
+	{[]byte("7z\xbc\xaf\x27\x1c"), "application/x-7z-compressed"},
+	{[]byte("\xfd7zXZ\x00"), "application/x-xz"},
+	{[]byte("\x28\xb5\x2f\xfd"), "application/zstd"},
+}
+
+// Detect sniffs the content type from the leading bytes of data. The file extension is only used
+// as a hint to refine generic results such as text/plain or application/octet-stream. Types a
+// browser would execute, such as HTML or SVG, are never taken from the extension alone.
+func Detect(data []byte, fileName string) string {
+	sniffed := sniff(data)
+	hinted := byExtension(fileName)
+	if hinted == "" {
+		return sniffed
+	}
+	if sniffed == OctetStream && !isText(hinted) {
+		return hinted
+	}
+	if baseType(sniffed) == textPlain && isText(hinted) && !isActive(hinted) {
+		return hinted
+	}
+	if baseType(sniffed) == "application/zip" && isZipContainer(hinted) {
+		return hinted
+	}
+	return sniffed
+}
+
+// Verify reports ErrMismatch when the extension promises a specific type but the content sniffs
+// as something else, e.g. an executable renamed to .jpg.
+func Verify(data []byte, fileName string) error {
+	hinted := byExtension(fileName)
+	if hinted == "" || hinted == OctetStream {
+		return nil
+	}
+	sniffed := sniff(data)
+	if sniffed == OctetStream || baseType(sniffed) == textPlain {
+		// Nothing recognisable in the magic bytes, so there is nothing to contradict the extension,
+		// unless those bytes clearly are not text while the extension says they should be.
+		if isText(hinted) && sniffed == OctetStream && len(data) > 0 {
+			return fmt.Errorf("%w: %s is not %s", ErrMismatch, filepath.Ext(fileName), hinted)
+		}
+		return nil
+	}
+	if baseType(sniffed) == baseType(hinted) {
+		return nil
+	}
+	if baseType(sniffed) == "application/zip" && isZipContainer(hinted) {
+		return nil
+	}
+	if isText(sniffed) && isText(hinted) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s content detected for %s file", ErrMismatch, baseType(sniffed), filepath.Ext(fileName))
+}
+
+func sniff(data []byte) string {
+	if isPortableExecutable(data) {
+		return msDownload
+	}
+	for _, signature := range signatures {
+		if bytes.HasPrefix(data, signature.prefix) {
+			return signature.contentType
+		}
+	}
+	return http.DetectContentType(data)
+}
+
+// isPortableExecutable checks for the "PE\0\0" header at the offset the DOS stub stores at 0x3C,
+// since "MZ" alone also starts plenty of text files.
+func isPortableExecutable(data []byte) bool {
+	if len(data) < 0x40 || !bytes.HasPrefix(data, []byte("MZ")) {
+		return false
+	}
+	offset := int64(binary.LittleEndian.Uint32(data[0x3c:]))
+	return offset+4 <= int64(len(data)) && bytes.Equal(data[offset:offset+4], []byte("PE\x00\x00"))
+}
+
+func byExtension(fileName string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext == "" {
+		return ""
+	}
+	return mime.TypeByExtension(ext)
+}
+
+func isText(contentType string) bool {
+	base := baseType(contentType)
+	return strings.HasPrefix(base, "text/") ||
+		base == "application/json" ||
+		base == "application/xml" ||
+		base == "application/javascript" ||
+		base == "image/svg+xml"
+}
+
+// isActive reports types a browser renders as a document or runs as script when served inline.
+func isActive(contentType string) bool {
+	switch baseType(contentType) {
+	case "text/html", "application/xhtml+xml", "image/svg+xml", "text/xml", "application/xml",
+		"application/javascript", "text/javascript", "application/ecmascript", "text/ecmascript":
+		return true
+	}
+	return false
+}
+
+func isZipContainer(contentType string) bool {
+	base := baseType(contentType)
+	return base == "application/zip" ||
+		base == "application/java-archive" ||
+		base == "application/epub+zip" ||
+		strings.HasPrefix(base, "application/vnd.openxmlformats-officedocument.") ||
+		strings.HasPrefix(base, "application/vnd.oasis.opendocument.")
+}
+
+func baseType(contentType string) string {
+	base, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return base
+}
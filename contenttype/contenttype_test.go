@@ -0,0 +1,71 @@
+package contenttype_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/contenttype"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	pngData  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	jpegData = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	exeData  = []byte("MZ" + strings.Repeat("\x00", 0x3a) + "\x40\x00\x00\x00PE\x00\x00")
+	pdfData  = []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		fileName string
+		expected string
+	}{
+		{name: "PNG by magic bytes", data: pngData, fileName: "image.png", expected: "image/png"},
+		{name: "Magic bytes win over extension", data: pngData, fileName: "image.jpg", expected: "image/png"},
+		{name: "Executable", data: exeData, fileName: "setup", expected: "application/x-msdownload"},
+		{name: "DOS stub without a PE header", data: []byte("MZ" + strings.Repeat("\x00", 0x3a) + "\x40\x00\x00\x00"), fileName: "", expected: "application/octet-stream"},
+		{name: "Text starting with MZ", data: []byte("MZ is a postcode area"), fileName: "notes.txt", expected: "text/plain; charset=utf-8"},
+		{name: "PDF without extension", data: pdfData, fileName: "document", expected: "application/pdf"},
+		{name: "Extension refines plain text", data: []byte(`{"a": 1}`), fileName: "data.json", expected: "application/json"},
+		{name: "Extension refines octet-stream", data: []byte{0x00, 0x61, 0x73, 0x6d, 0x01}, fileName: "module.wasm", expected: "application/wasm"},
+		{name: "HTML is not taken from the extension", data: []byte("<img src=x onerror=alert(1)>"), fileName: "page.html", expected: "text/plain; charset=utf-8"},
+		{name: "SVG is not taken from the extension", data: []byte("hello"), fileName: "image.svg", expected: "text/plain; charset=utf-8"},
+		{name: "JavaScript is not taken from the extension", data: []byte("alert(1)"), fileName: "app.js", expected: "text/plain; charset=utf-8"},
+		{name: "Sniffed HTML", data: []byte("<!DOCTYPE html><title>x</title>"), fileName: "page.html", expected: "text/html; charset=utf-8"},
+		{name: "Unknown binary", data: []byte{0x00, 0x01, 0x02}, fileName: "", expected: "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, contenttype.Detect(tt.data, tt.fileName))
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	assert.NoError(t, contenttype.Verify(jpegData, "photo.jpg"))
+	assert.NoError(t, contenttype.Verify(jpegData, "photo.JPEG"))
+	assert.NoError(t, contenttype.Verify(exeData, "setup"))
+	assert.NoError(t, contenttype.Verify([]byte(`{"a": 1}`), "data.json"))
+	assert.ErrorIs(t, contenttype.Verify(exeData, "photo.jpg"), contenttype.ErrMismatch)
+	assert.ErrorIs(t, contenttype.Verify(pngData, "document.pdf"), contenttype.ErrMismatch)
+	assert.ErrorIs(t, contenttype.Verify([]byte{0x00, 0x01, 0x02}, "data.json"), contenttype.ErrMismatch)
+}
+
+func TestPolicy(t *testing.T) {
+	policy := contenttype.NewPolicy(
+		contenttype.Rules{Blocked: []string{"application/x-msdownload"}},
+		map[string]contenttype.Rules{
+			"/avatars": {Allowed: []string{"image/*"}, Blocked: []string{"image/svg+xml"}},
+		},
+	)
+
+	assert.NoError(t, policy.Check("/upload-to-s3", "application/pdf"))
+	assert.NoError(t, policy.Check("/avatars", "image/png"))
+	assert.NoError(t, policy.Check("/avatars", "image/jpeg; charset=binary"))
+	assert.ErrorIs(t, policy.Check("/upload-to-s3", "application/x-msdownload"), contenttype.ErrNotAllowed)
+	assert.ErrorIs(t, policy.Check("/avatars", "application/pdf"), contenttype.ErrNotAllowed)
+	assert.ErrorIs(t, policy.Check("/avatars", "image/svg+xml"), contenttype.ErrNotAllowed)
+}
@@ -0,0 +1,64 @@
+package contenttype
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Policy interface {
+	Check(route, contentType string) error
+}
+
+// Rules holds allow and block patterns. Patterns are exact media types or wildcards such as
+// "image/*". An empty Allowed list allows everything that is not Blocked.
+type Rules struct {
+	Allowed []string
+	Blocked []string
+}
+
+type policy struct {
+	global   Rules
+	perRoute map[string]Rules
+}
+
+func (p policy) Check(route, contentType string) error {
+	base := baseType(contentType)
+	rules := []Rules{p.global}
+	if routeRules, ok := p.perRoute[route]; ok {
+		rules = append(rules, routeRules)
+	}
+	for _, r := range rules {
+		if matchesAny(r.Blocked, base) {
+			return fmt.Errorf("%w: %s is blocked", ErrNotAllowed, base)
+		}
+		if len(r.Allowed) > 0 && !matchesAny(r.Allowed, base) {
+			return fmt.Errorf("%w: %s", ErrNotAllowed, base)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether contentType, ignoring its parameters, matches any of patterns.
+func Matches(patterns []string, contentType string) bool {
+	return matchesAny(patterns, baseType(contentType))
+}
+
+func matchesAny(patterns []string, contentType string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*/*" || pattern == contentType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func NewPolicy(global Rules, perRoute map[string]Rules) Policy {
+	return &policy{
+		global:   global,
+		perRoute: perRoute,
+	}
+}
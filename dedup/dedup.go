@@ -0,0 +1,102 @@
+package dedup
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+)
+
+const DefaultPrefix = "blobs/"
+
+// anonymousOwner names the key segment of uploads without an owner. No tenant ID can be "_".
+const anonymousOwner = "_"
+
+type Result struct {
+	s3.UploadResult
+	// Deduplicated is set when the content was already stored and the PUT was skipped.
+	Deduplicated bool
+}
+
+// Deduplicator shares stored content between uploads of the same owner. Every blob belongs to
+// exactly one owner, whose ID is part of its key and whose tenant is recorded on it like on any
+// other object, so neither its metadata nor whether an upload was deduplicated tells one owner
+// anything about another's uploads. Uploading the same content again returns the same key, and
+// deleting that key deletes the content for every upload that returned it, as deleting an
+// overwritten key would.
+type Deduplicator interface {
+	// Upload stores data under a key derived from owner and its SHA-256, unless it is already
+	// stored with the requested encryption. An upload that finds the content stored keeps the
+	// blob's filename, metadata and tags.
+	Upload(ctx context.Context, data []byte, fileName string, opts s3.UploadOptions, owner string) (Result, error)
+	// IsBlob reports whether objectKey is a content-addressed key.
+	IsBlob(objectKey string) bool
+}
+
+type deduplicator struct {
+	client s3.S3
+	prefix string
+}
+
+func (d *deduplicator) Upload(ctx context.Context, data []byte, fileName string, opts s3.UploadOptions, owner string) (Result, error) {
+	checksums := s3.ComputeChecksums(data)
+	if err := checksums.Verify(opts.Checksums); err != nil {
+		return Result{}, err
+	}
+	key := d.key(owner, checksums.SHA256)
+
+	info, err := d.client.HeadObject(ctx, key)
+	if err == nil && satisfies(info.Encryption, opts.Encryption.Mode) {
+		return Result{
+			UploadResult: s3.UploadResult{Key: key, ETag: info.ETag, Checksums: checksums},
+			Deduplicated: true,
+		}, nil
+	}
+	if err != nil && !isNotFound(err) {
+		return Result{}, err
+	}
+
+	opts.Key = key
+	opts.KeyPrefix = ""
+	opts.Reserved = true
+	result, err := d.client.Upload(ctx, data, fileName, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{UploadResult: result}, nil
+}
+
+func (d *deduplicator) IsBlob(objectKey string) bool {
+	return strings.HasPrefix(objectKey, d.prefix)
+}
+
+func (d *deduplicator) key(owner string, sha256 []byte) string {
+	if owner == "" {
+		owner = anonymousOwner
+	}
+	return d.prefix + owner + "/" + hex.EncodeToString(sha256)
+}
+
+// satisfies reports whether a stored blob is encrypted as an upload requires. Storing the blob
+// again with the requested encryption upgrades it.
+func satisfies(stored, requested s3.EncryptionMode) bool {
+	return requested == s3.EncryptionNone || stored == requested
+}
+
+func isNotFound(err error) bool {
+	var s3Err *s3.Error
+	return errors.As(err, &s3Err) && (s3Err.Code == "NoSuchKey" || s3Err.StatusCode == http.StatusNotFound)
+}
+
+// NewDeduplicator stores content-addressed blobs under prefix, DefaultPrefix when empty. The
+// prefix must not be shared with objects stored under other keys, which s3.WithReservedPrefix
+// enforces.
+func NewDeduplicator(client s3.S3, prefix string) Deduplicator {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &deduplicator{client: client, prefix: prefix}
+}
@@ -0,0 +1,95 @@
+package dedup_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/dedup"
+	"github.com/haithamswe/multi-protocol-upload-api/mocks"
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// SHA-256 of "data".
+const dataHash = "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"
+
+const dataKey = "blobs/acme/" + dataHash
+
+var errNotFound = &s3.Error{StatusCode: http.StatusNotFound}
+
+func TestUpload(t *testing.T) {
+	tests := []struct {
+		name         string
+		headErr      error
+		stored       s3.EncryptionMode
+		encryption   s3.EncryptionMode
+		deduplicated bool
+	}{
+		{name: "New content is stored", headErr: errNotFound},
+		{name: "Existing content is not stored again", stored: s3.EncryptionS3, deduplicated: true},
+		{name: "Unencrypted content is stored again encrypted", encryption: s3.EncryptionS3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := mocks.NewS3(t)
+			client.On("HeadObject", ctx, dataKey).Return(s3.ObjectInfo{Key: dataKey, ETag: `"etag"`, Encryption: tt.stored}, tt.headErr)
+			encryption := s3.Encryption{Mode: tt.encryption}
+			if !tt.deduplicated {
+				client.On("Upload", ctx, []byte("data"), "a.txt", s3.UploadOptions{Key: dataKey, Reserved: true, Tenant: "acme", Encryption: encryption}).
+					Return(s3.UploadResult{Key: dataKey, ETag: `"etag"`}, nil)
+			}
+
+			d := dedup.NewDeduplicator(client, "")
+			result, err := d.Upload(ctx, []byte("data"), "a.txt", s3.UploadOptions{KeyPrefix: "ignored/", Tenant: "acme", Encryption: encryption}, "acme")
+
+			assert.NoError(t, err)
+			assert.Equal(t, dataKey, result.Key)
+			assert.Equal(t, `"etag"`, result.ETag)
+			assert.Equal(t, tt.deduplicated, result.Deduplicated)
+			assert.True(t, d.IsBlob(result.Key))
+		})
+	}
+}
+
+func TestUpload_ScopedToOwner(t *testing.T) {
+	ctx := context.Background()
+	for owner, key := range map[string]string{"globex": "blobs/globex/" + dataHash, "": "blobs/_/" + dataHash} {
+		client := mocks.NewS3(t)
+		client.On("HeadObject", ctx, key).Return(s3.ObjectInfo{}, errNotFound)
+		client.On("Upload", ctx, []byte("data"), "a.txt", mock.Anything).Return(s3.UploadResult{Key: key}, nil)
+
+		result, err := dedup.NewDeduplicator(client, "").Upload(ctx, []byte("data"), "a.txt", s3.UploadOptions{}, owner)
+
+		assert.NoError(t, err)
+		assert.Equal(t, key, result.Key)
+		assert.False(t, result.Deduplicated)
+	}
+}
+
+func TestUpload_BadDigest(t *testing.T) {
+	d := dedup.NewDeduplicator(mocks.NewS3(t), "")
+
+	_, err := d.Upload(context.Background(), []byte("data"), "a.txt", s3.UploadOptions{Checksums: s3.ComputeChecksums([]byte("other"))}, "acme")
+
+	assert.ErrorIs(t, err, s3.ErrBadDigest)
+}
+
+func TestUpload_Errors(t *testing.T) {
+	ctx := context.Background()
+	client := mocks.NewS3(t)
+	client.On("HeadObject", ctx, dataKey).Return(s3.ObjectInfo{}, errors.New("connection reset")).Once()
+	client.On("HeadObject", ctx, dataKey).Return(s3.ObjectInfo{}, errNotFound).Once()
+	client.On("Upload", ctx, []byte("data"), "a.txt", mock.Anything).Return(s3.UploadResult{}, errors.New("boom"))
+	d := dedup.NewDeduplicator(client, "")
+
+	_, err := d.Upload(ctx, []byte("data"), "a.txt", s3.UploadOptions{}, "acme")
+	assert.EqualError(t, err, "connection reset")
+
+	_, err = d.Upload(ctx, []byte("data"), "a.txt", s3.UploadOptions{}, "acme")
+	assert.EqualError(t, err, "boom")
+}
@@ -0,0 +1,273 @@
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Metadata names under which the wrapped data key and the master key that wraps it are stored.
+const (
+	MetadataKey   = "envelope-key"
+	MetadataKeyID = "envelope-key-id"
+)
+
+const (
+	// ChunkSize is the plaintext size of each sealed chunk.
+	ChunkSize = 64 * 1024
+	KeySize   = 32
+
+	version     = 1
+	prefixSize  = 7
+	headerSize  = 1 + prefixSize
+	tagSize     = 16
+	sealedChunk = ChunkSize + tagSize
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown master key")
+	ErrCorrupted  = errors.New("encrypted content is corrupted")
+)
+
+// Encryptor encrypts content with a fresh data key per object, which is stored wrapped by a master
+// key.
+//
+// Content is split into chunks sealed with AES-256-GCM. Each chunk's nonce combines a random
+// per-object prefix, the chunk's index and a flag marking the final chunk, so chunks cannot be
+// reordered, dropped or truncated without detection.
+type Encryptor interface {
+	// Encrypt returns the ciphertext and the metadata to store with it.
+	Encrypt(plaintext []byte) ([]byte, map[string]string, error)
+	// NewReader decrypts ciphertext stored with metadata. Chunks are authenticated before any
+	// of their plaintext is returned.
+	NewReader(ciphertext io.Reader, metadata map[string]string) (io.Reader, error)
+}
+
+// IsEncrypted reports whether an object's metadata describes envelope encrypted content.
+func IsEncrypted(metadata map[string]string) bool {
+	return metadata[MetadataKey] != ""
+}
+
+func chunks(plaintextSize int64) int64 {
+	return max(1, (plaintextSize+ChunkSize-1)/ChunkSize)
+}
+
+// EncryptedSize is the size of the ciphertext for plaintextSize bytes.
+func EncryptedSize(plaintextSize int64) int64 {
+	return headerSize + plaintextSize + chunks(plaintextSize)*tagSize
+}
+
+// DecryptedSize is the plaintext size of encryptedSize bytes of well-formed ciphertext.
+func DecryptedSize(encryptedSize int64) int64 {
+	body := encryptedSize - headerSize
+	full, rest := body/sealedChunk, body%sealedChunk
+	return full*ChunkSize + max(rest-tagSize, 0)
+}
+
+type encryptor struct {
+	primaryID  string
+	masterKeys map[string]cipher.AEAD
+}
+
+func (e *encryptor) Encrypt(plaintext []byte) ([]byte, map[string]string, error) {
+	dataKey := make([]byte, KeySize)
+	rand.Read(dataKey)
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	n := int64(len(plaintext))
+	out := make([]byte, headerSize, EncryptedSize(n))
+	out[0] = version
+	rand.Read(out[1:headerSize])
+	var prefix [prefixSize]byte
+	copy(prefix[:], out[1:headerSize])
+	count := chunks(n)
+	for i := int64(0); i < count; i++ {
+		start, end := i*ChunkSize, min((i+1)*ChunkSize, n)
+		out = aead.Seal(out, nonce(prefix, uint32(i), i == count-1), plaintext[start:end], nil)
+	}
+
+	wrapped, err := e.wrap(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, map[string]string{
+		MetadataKey:   base64.StdEncoding.EncodeToString(wrapped),
+		MetadataKeyID: e.primaryID,
+	}, nil
+}
+
+// wrap seals dataKey with the primary master key. The key ID is authenticated, so a wrapped key
+// cannot be passed off as wrapped by another master key.
+func (e *encryptor) wrap(dataKey []byte) ([]byte, error) {
+	master := e.masterKeys[e.primaryID]
+	out := make([]byte, master.NonceSize(), master.NonceSize()+KeySize+master.Overhead())
+	rand.Read(out)
+	return master.Seal(out, out, dataKey, []byte(e.primaryID)), nil
+}
+
+func (e *encryptor) unwrap(metadata map[string]string) ([]byte, error) {
+	keyID := metadata[MetadataKeyID]
+	master, ok := e.masterKeys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(metadata[MetadataKey])
+	if err != nil || len(wrapped) < master.NonceSize() {
+		return nil, fmt.Errorf("%w: malformed data key", ErrCorrupted)
+	}
+	dataKey, err := master.Open(nil, wrapped[:master.NonceSize()], wrapped[master.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: data key does not authenticate", ErrCorrupted)
+	}
+	return dataKey, nil
+}
+
+func (e *encryptor) NewReader(ciphertext io.Reader, metadata map[string]string) (io.Reader, error) {
+	dataKey, err := e.unwrap(metadata)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	src := bufio.NewReaderSize(ciphertext, sealedChunk)
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, fmt.Errorf("%w: missing header", ErrCorrupted)
+	}
+	if header[0] != version {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrCorrupted, header[0])
+	}
+	r := &reader{src: src, aead: aead, buf: make([]byte, sealedChunk)}
+	copy(r.prefix[:], header[1:])
+	return r, nil
+}
+
+type reader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	prefix  [prefixSize]byte
+	counter uint32
+	buf     []byte
+	plain   []byte
+	done    bool
+	err     error
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *reader) next() error {
+	n, err := io.ReadFull(r.src, r.buf)
+	last := false
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, err := r.src.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if n < tagSize {
+		return fmt.Errorf("%w: truncated", ErrCorrupted)
+	}
+	plain, err := r.aead.Open(r.buf[:0], nonce(r.prefix, r.counter, last), r.buf[:n], nil)
+	if err != nil {
+		return fmt.Errorf("%w: chunk %d does not authenticate", ErrCorrupted, r.counter)
+	}
+	r.counter++
+	r.plain, r.done = plain, last
+	return nil
+}
+
+func nonce(prefix [prefixSize]byte, counter uint32, last bool) []byte {
+	n := make([]byte, 0, 12)
+	n = append(n, prefix[:]...)
+	n = binary.BigEndian.AppendUint32(n, counter)
+	if last {
+		return append(n, 1)
+	}
+	return append(n, 0)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewEncryptor wraps data keys with masterKeys[primaryID]. The other master keys are only used to
+// decrypt objects written before the primary key was rotated.
+func NewEncryptor(primaryID string, masterKeys map[string][]byte) (Encryptor, error) {
+	if _, ok := masterKeys[primaryID]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primaryID)
+	}
+	e := &encryptor{primaryID: primaryID, masterKeys: map[string]cipher.AEAD{}}
+	for id, key := range masterKeys {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("master key %q must be %d bytes", id, KeySize)
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		e.masterKeys[id] = aead
+	}
+	return e, nil
+}
+
+type keyringFile struct {
+	Primary string            `json:"primary"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// LoadKeyring reads a JSON keyring of base64 encoded master keys:
+//
+//	{"primary": "2025-01", "keys": {"2025-01": "...", "2024-06": "..."}}
+func LoadKeyring(path string) (Encryptor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid keyring %s: %w", path, err)
+	}
+	keys := make(map[string][]byte, len(file.Keys))
+	for id, encoded := range file.Keys {
+		if keys[id], err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("invalid keyring %s: key %q is not base64", path, id)
+		}
+	}
+	return NewEncryptor(file.Primary, keys)
+}
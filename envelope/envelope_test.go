@@ -0,0 +1,122 @@
+package envelope_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/envelope"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEncryptor(t *testing.T, primary string, keys map[string][]byte) envelope.Encryptor {
+	e, err := envelope.NewEncryptor(primary, keys)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return e
+}
+
+func decrypt(e envelope.Encryptor, ciphertext []byte, metadata map[string]string) ([]byte, error) {
+	r, err := e.NewReader(bytes.NewReader(ciphertext), metadata)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	e := newTestEncryptor(t, "k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, envelope.KeySize)})
+
+	for _, size := range []int{0, 1, envelope.ChunkSize - 1, envelope.ChunkSize, envelope.ChunkSize + 1, 3 * envelope.ChunkSize} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		ciphertext, metadata, err := e.Encrypt(plaintext)
+		assert.NoError(t, err)
+		assert.Equal(t, envelope.EncryptedSize(int64(size)), int64(len(ciphertext)), "size %d", size)
+		assert.Equal(t, int64(size), envelope.DecryptedSize(int64(len(ciphertext))), "size %d", size)
+		assert.True(t, envelope.IsEncrypted(metadata))
+		assert.Equal(t, "k1", metadata[envelope.MetadataKeyID])
+		if size > 16 {
+			assert.False(t, bytes.Contains(ciphertext, plaintext[:16]))
+		}
+
+		decrypted, err := decrypt(e, ciphertext, metadata)
+		assert.NoError(t, err, "size %d", size)
+		assert.True(t, bytes.Equal(plaintext, decrypted), "size %d", size)
+	}
+}
+
+func TestTamperingIsDetected(t *testing.T) {
+	e := newTestEncryptor(t, "k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, envelope.KeySize)})
+	plaintext := bytes.Repeat([]byte("x"), 2*envelope.ChunkSize+10)
+	ciphertext, metadata, err := e.Encrypt(plaintext)
+	assert.NoError(t, err)
+	sealedChunk := envelope.ChunkSize + 16
+
+	flipped := bytes.Clone(ciphertext)
+	flipped[len(flipped)-1] ^= 1
+	firstChunk := 8 + sealedChunk
+	swapped := append(append(bytes.Clone(ciphertext[:8]), ciphertext[firstChunk:firstChunk+sealedChunk]...), ciphertext[8:firstChunk]...)
+	swapped = append(swapped, ciphertext[firstChunk+sealedChunk:]...)
+
+	tests := map[string][]byte{
+		"Flipped bit":         flipped,
+		"Dropped final chunk": ciphertext[:8+2*sealedChunk],
+		"Truncated chunk":     ciphertext[:len(ciphertext)-5],
+		"Reordered chunks":    swapped,
+		"Appended data":       append(bytes.Clone(ciphertext), 0),
+	}
+	for name, tampered := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := decrypt(e, tampered, metadata)
+			assert.ErrorIs(t, err, envelope.ErrCorrupted)
+		})
+	}
+
+	wrongKey := map[string]string{envelope.MetadataKeyID: "k1", envelope.MetadataKey: base64.StdEncoding.EncodeToString(make([]byte, 60))}
+	_, err = decrypt(e, ciphertext, wrongKey)
+	assert.ErrorIs(t, err, envelope.ErrCorrupted)
+}
+
+func TestKeyRotation(t *testing.T) {
+	k1, k2 := bytes.Repeat([]byte{1}, envelope.KeySize), bytes.Repeat([]byte{2}, envelope.KeySize)
+	ciphertext, metadata, err := newTestEncryptor(t, "k1", map[string][]byte{"k1": k1}).Encrypt([]byte("secret"))
+	assert.NoError(t, err)
+
+	rotated := newTestEncryptor(t, "k2", map[string][]byte{"k1": k1, "k2": k2})
+	decrypted, err := decrypt(rotated, ciphertext, metadata)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(decrypted))
+
+	_, err = decrypt(newTestEncryptor(t, "k2", map[string][]byte{"k2": k2}), ciphertext, metadata)
+	assert.ErrorIs(t, err, envelope.ErrUnknownKey)
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, envelope.KeySize))
+	write := func(content string) string {
+		path := filepath.Join(dir, "keyring.json")
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	e, err := envelope.LoadKeyring(write(`{"primary": "k1", "keys": {"k1": "` + key + `"}}`))
+	assert.NoError(t, err)
+	_, metadata, err := e.Encrypt([]byte("data"))
+	assert.NoError(t, err)
+	assert.Equal(t, "k1", metadata[envelope.MetadataKeyID])
+
+	_, err = envelope.LoadKeyring(write(`{"primary": "k2", "keys": {"k1": "` + key + `"}}`))
+	assert.Error(t, err)
+	_, err = envelope.LoadKeyring(write(`{"primary": "k1", "keys": {"k1": "c2hvcnQ="}}`))
+	assert.Error(t, err)
+	_, err = envelope.LoadKeyring(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/haithamswe/multi-protocol-upload-api/apierror"
+	"github.com/haithamswe/multi-protocol-upload-api/archive"
+	"github.com/haithamswe/multi-protocol-upload-api/catalog"
+	"github.com/haithamswe/multi-protocol-upload-api/contenttype"
+	"github.com/haithamswe/multi-protocol-upload-api/logging"
+	"github.com/haithamswe/multi-protocol-upload-api/objectkey"
+	"github.com/haithamswe/multi-protocol-upload-api/quota"
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+)
+
+// extractParam asks for an uploaded zip or tar archive to be expanded into individual objects.
+const extractParam = "extract"
+
+// manifestSuffix is appended to the extraction prefix, without its trailing slash, to name the
+// manifest. The manifest sits next to the prefix, so no archive entry can replace it.
+const manifestSuffix = ".manifest.json"
+
+func (h handlers) parseExtract(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get(extractParam)
+	if value == "" {
+		return false, nil
+	}
+	extract, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("Invalid %s parameter, expected true or false", extractParam)
+	}
+	if extract && h.archiveKeys == nil {
+		return false, errors.New("Archive extraction is not enabled")
+	}
+	return extract, nil
+}
+
+func archiveError(err error) error {
+	var apiErr *apierror.Error
+	switch {
+	case errors.As(err, &apiErr):
+		return err
+	case errors.Is(err, archive.ErrUnsupported):
+		return apierror.Wrap(apierror.KindUnsupportedMediaType, err.Error(), err)
+	case errors.Is(err, archive.ErrTooManyEntries), errors.Is(err, archive.ErrTooLarge), errors.Is(err, archive.ErrRatio):
+		return apierror.Wrap(apierror.KindTooLarge, err.Error(), err)
+	}
+	return apierror.Wrap(apierror.KindUnprocessable, err.Error(), err)
+}
+
+type archiveManifest struct {
+	Archive string          `json:"archive"`
+	Prefix  string          `json:"prefix"`
+	Entries []manifestEntry `json:"entries"`
+}
+
+type manifestEntry struct {
+	Name        string `json:"name"`
+	Key         string `json:"key"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType"`
+}
+
+type extractionResponse struct {
+	Prefix  string `json:"prefix"`
+	Entries int    `json:"entries"`
+}
+
+// extractedObject is an object stored while extracting an archive. Its quota is only committed
+// once the whole archive is stored.
+type extractedObject struct {
+	record      catalog.Record
+	reservation quota.Reservation
+}
+
+// extractArchive stores every file in an archive under a common prefix, followed by a manifest
+// listing them. Either all of them are stored or, when an entry is rejected, none are.
+func (h handlers) extractArchive(w http.ResponseWriter, r *http.Request, fileName string, fileData []byte, format archive.Format, opts s3.UploadOptions, response uploadResponse) {
+	ctx := r.Context()
+	// Client digests describe the archive, which is not stored itself.
+	checksums := s3.ComputeChecksums(fileData)
+	if err := checksums.Verify(opts.Checksums); err != nil {
+		apierror.Write(w, r, storageError(err))
+		return
+	}
+	opts.Checksums = s3.Checksums{}
+
+	prefix := h.archiveKeys.Key(objectkey.Input{FileName: fileName, Tenant: opts.Tenant, Data: fileData}) + "/"
+	manifest := archiveManifest{Archive: fileName, Prefix: prefix, Entries: []manifestEntry{}}
+	var stored []extractedObject
+	keys := map[string]string{}
+	extractCtx, extractSpan := h.tracer.Start(ctx, "ExtractArchive")
+	err := archive.Walk(fileData, format, h.archiveLimits, func(entry archive.Entry) error {
+		key := prefix + entryKey(entry.Name)
+		if other, ok := keys[key]; ok {
+			return fmt.Errorf("%w: %s and %s map to the same key", archive.ErrInvalid, other, entry.Name)
+		}
+		keys[key] = entry.Name
+		contentType := contenttype.Detect(entry.Data, entry.Name)
+		if err := h.contentTypePolicy.Check(r.URL.Path, contentType); err != nil {
+			return contentTypeError(fmt.Errorf("%s: %w", entry.Name, err))
+		}
+		object, err := h.storeExtracted(extractCtx, key, path.Base(entry.Name), entry.Data, contentType, opts)
+		if err != nil {
+			return err
+		}
+		stored = append(stored, object)
+		manifest.Entries = append(manifest.Entries, manifestEntry{Name: entry.Name, Key: key, Size: int64(len(entry.Data)), ContentType: contentType})
+		return nil
+	})
+	if err == nil {
+		var body []byte
+		if body, err = json.Marshal(manifest); err == nil {
+			manifestKey := strings.TrimSuffix(prefix, "/") + manifestSuffix
+			var object extractedObject
+			if object, err = h.storeExtracted(extractCtx, manifestKey, path.Base(manifestKey), body, "application/json", opts); err == nil {
+				stored = append(stored, object)
+			}
+		}
+	}
+	endStep(extractSpan, err)
+	if err != nil {
+		h.discardExtracted(ctx, stored)
+		apierror.Write(w, r, archiveError(err))
+		return
+	}
+
+	for _, object := range stored {
+		if object.reservation != nil {
+			if err := object.reservation.Commit(ctx, object.record.Key); err != nil {
+				slog.ErrorContext(ctx, "Could not record usage", "object_key", object.record.Key, "error", err)
+			}
+		}
+		if h.catalog != nil {
+			object.record.Uploader = logging.Principal(r)
+			object.record.Tags = opts.Tags
+			if err := h.catalog.Put(ctx, object.record); err != nil {
+				slog.ErrorContext(ctx, "Could not record upload in the catalog", "object_key", object.record.Key, "error", err)
+			}
+		}
+	}
+	manifestObject := stored[len(stored)-1]
+	response.ObjectKey = manifestObject.record.Key
+	response.Checksums = checksums
+	response.EnvelopeEncrypted = h.envelope != nil
+	response.Extraction = &extractionResponse{Prefix: prefix, Entries: len(manifest.Entries)}
+	logging.AddAttrs(ctx, slog.String("object_key", response.ObjectKey), slog.Int("extracted_entries", len(manifest.Entries)))
+	writeJSON(w, http.StatusOK, response)
+}
+
+// entryKey turns a path within an archive into a key suffix made of sanitised path segments.
+func entryKey(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = objectkey.SanitizeFileName(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (h handlers) storeExtracted(ctx context.Context, key, fileName string, data []byte, contentType string, opts s3.UploadOptions) (extractedObject, error) {
+	opts.Key, opts.ContentType = key, contentType
+	storedData, err := h.encode(ctx, data, &opts)
+	if err != nil {
+		return extractedObject{}, err
+	}
+	var reservation quota.Reservation
+	if h.quotas != nil {
+		if reservation, err = h.quotas.Reserve(ctx, opts.Tenant, int64(len(storedData))); err != nil {
+			return extractedObject{}, quotaError(err, h.quotaForbidden)
+		}
+	}
+	result, err := h.s3Client.Upload(ctx, storedData, fileName, opts)
+	if err != nil {
+		if reservation != nil {
+			reservation.Cancel()
+		}
+		return extractedObject{}, storageError(err)
+	}
+	checksum := sha256.Sum256(data)
+	record := catalog.Record{
+		Key:              result.Key,
+		OriginalFileName: fileName,
+		Size:             int64(len(data)),
+		ContentType:      contentType,
+		Checksum:         hex.EncodeToString(checksum[:]),
+		Tenant:           opts.Tenant,
+	}
+	return extractedObject{record: record, reservation: reservation}, nil
+}
+
+// discardExtracted deletes the objects stored for an archive that could not be extracted whole.
+func (h handlers) discardExtracted(ctx context.Context, stored []extractedObject) {
+	// The request may have been canceled, which must not leave a partial extraction behind.
+	ctx = context.WithoutCancel(ctx)
+	for _, object := range stored {
+		if object.reservation != nil {
+			object.reservation.Cancel()
+		}
+		if err := h.s3Client.DeleteObject(ctx, object.record.Key); err != nil {
+			slog.ErrorContext(ctx, "Could not delete extracted object", "object_key", object.record.Key, "error", err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+)
+
+// parseChecksums reads the digests a client may send with an upload, in the same base64 form S3
+// accepts: Content-MD5, x-amz-checksum-sha256 and x-amz-checksum-crc32c.
+func parseChecksums(r *http.Request) (s3.Checksums, error) {
+	var checksums s3.Checksums
+	headers := []struct {
+		name   string
+		size   int
+		target *[]byte
+	}{
+		{"Content-MD5", 16, &checksums.MD5},
+		{"X-Amz-Checksum-Sha256", 32, &checksums.SHA256},
+		{"X-Amz-Checksum-Crc32c", 4, &checksums.CRC32C},
+	}
+	for _, h := range headers {
+		value := r.Header.Get(h.name)
+		if value == "" {
+			continue
+		}
+		sum, err := s3.ParseChecksum(value, h.size)
+		if err != nil {
+			return checksums, fmt.Errorf("Invalid %s header, %v", h.name, err)
+		}
+		*h.target = sum
+	}
+	return checksums, nil
+}
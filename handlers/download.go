@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/haithamswe/multi-protocol-upload-api/apierror"
+	"github.com/haithamswe/multi-protocol-upload-api/compression"
+	"github.com/haithamswe/multi-protocol-upload-api/envelope"
+	"github.com/haithamswe/multi-protocol-upload-api/logging"
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+)
+
+// Download streams an object's content through the API, decrypting it when it was envelope
+// encrypted on upload and decompressing it unless the client accepts its encoding.
+func (h handlers) Download(w http.ResponseWriter, r *http.Request) {
+	r, span := h.startSpan(r, "Download")
+	sw := &statusWriter{ResponseWriter: w}
+	w = sw
+	defer func() {
+		endSpan(span, sw.Status())
+	}()
+
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.New(apierror.KindMethodNotAllowed, "Method Not Allowed"))
+		return
+	}
+	objectKey := r.URL.Query().Get("objectKey")
+	if objectKey == "" {
+		apierror.Write(w, r, apierror.New(apierror.KindValidation, "Missing objectKey parameter"))
+		return
+	}
+	logging.AddAttrs(r.Context(), slog.String("object_key", objectKey))
+	r, err := withCustomerKey(r)
+	if err != nil {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+
+	body, info, err := h.s3Client.GetObject(r.Context(), objectKey)
+	if err != nil {
+		apierror.Write(w, r, storageError(err))
+		return
+	}
+	defer body.Close()
+	if info.Tenant() != r.Header.Get(tenantHeader) {
+		apierror.Write(w, r, apierror.New(apierror.KindNotFound, "object not found"))
+		return
+	}
+
+	header := w.Header()
+	content, size := io.Reader(body), contentSize(info)
+	encoding := info.ContentEncoding
+	if encoding != "" {
+		header.Set("Vary", "Accept-Encoding")
+	}
+	if encoding != "" && !envelope.IsEncrypted(info.Metadata) && acceptsEncoding(r, encoding) {
+		// The stored bytes are sent as they are.
+		header.Set("Content-Encoding", encoding)
+		size = info.Size
+	} else {
+		decoded, err := h.openContent(body, info)
+		if err != nil {
+			apierror.Write(w, r, err)
+			return
+		}
+		defer decoded.Close()
+		content = decoded
+	}
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	if size >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	if name := info.OriginalFileName(); name != "" {
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+	if !info.LastModified.IsZero() {
+		header.Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	// Chunks are authenticated before they are written, so a corrupted object ends the response
+	// short of Content-Length rather than returning altered content.
+	written, err := io.Copy(w, content)
+	logging.AddAttrs(r.Context(), slog.Int64("size", written))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Download ended early", "object_key", objectKey, "error", err)
+	}
+}
+
+// openContent returns a reader for an object's content as it was uploaded, decrypting and
+// decompressing it as needed.
+func (h handlers) openContent(body io.Reader, info s3.ObjectInfo) (io.ReadCloser, error) {
+	content := body
+	if envelope.IsEncrypted(info.Metadata) {
+		if h.envelope == nil {
+			return nil, apierror.New(apierror.KindInternal, "object is envelope encrypted but no keyring is configured")
+		}
+		var err error
+		if content, err = h.envelope.NewReader(body, info.Metadata); err != nil {
+			return nil, envelopeError(err)
+		}
+	}
+	if info.ContentEncoding == "" {
+		return io.NopCloser(content), nil
+	}
+	decoded, err := compression.NewReader(content, compression.Encoding(info.ContentEncoding))
+	if err != nil {
+		return nil, apierror.Wrap(apierror.KindInternal, "object has an unsupported content encoding", err)
+	}
+	return decoded, nil
+}
+
+// contentSize returns the size of an object's content as it was uploaded, or -1 when it is not
+// known.
+func contentSize(info s3.ObjectInfo) int64 {
+	if info.ContentEncoding != "" {
+		size, err := strconv.ParseInt(info.Metadata[compression.SizeMetadata], 10, 64)
+		if err != nil {
+			return -1
+		}
+		return size
+	}
+	if envelope.IsEncrypted(info.Metadata) {
+		return envelope.DecryptedSize(info.Size)
+	}
+	return info.Size
+}
+
+// acceptsEncoding reports whether a request's Accept-Encoding header allows encoding.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+				continue
+			}
+			q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q=")
+			if !ok {
+				return true
+			}
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+	}
+	return false
+}
+
+func envelopeError(err error) error {
+	if errors.Is(err, envelope.ErrUnknownKey) {
+		return apierror.Wrap(apierror.KindInternal, "object was encrypted with a master key missing from the keyring", err)
+	}
+	return apierror.Wrap(apierror.KindInternal, "encrypted object is corrupted", err)
+}
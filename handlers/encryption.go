@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+)
+
+// The request headers are the ones S3 itself accepts.
+const (
+	sseHeader                  = "X-Amz-Server-Side-Encryption"
+	sseKMSKeyIDHeader          = "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"
+	sseContextHeader           = "X-Amz-Server-Side-Encryption-Context"
+	sseCustomerAlgorithmHeader = "X-Amz-Server-Side-Encryption-Customer-Algorithm"
+	sseCustomerKeyHeader       = "X-Amz-Server-Side-Encryption-Customer-Key"
+	sseCustomerKeyMD5Header    = "X-Amz-Server-Side-Encryption-Customer-Key-Md5"
+)
+
+// parseEncryption reads the encryption a client asked for. The encryption policy decides whether
+// it is allowed.
+func parseEncryption(r *http.Request) (s3.Encryption, error) {
+	var encryption s3.Encryption
+	var err error
+	if encryption.Mode, err = s3.ParseEncryptionMode(r.Header.Get(sseHeader)); err != nil {
+		return encryption, fmt.Errorf("Invalid %s header, expected AES256 or aws:kms", sseHeader)
+	}
+	encryption.KMSKeyID = r.Header.Get(sseKMSKeyIDHeader)
+	if value := r.Header.Get(sseContextHeader); value != "" {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || json.Unmarshal(decoded, &encryption.KMSContext) != nil {
+			return encryption, fmt.Errorf("Invalid %s header, expected a base64 encoded JSON object of strings", sseContextHeader)
+		}
+	}
+	if encryption.CustomerKey, err = parseCustomerKey(r); err != nil {
+		return encryption, err
+	}
+	if encryption.CustomerKey != nil {
+		if encryption.Mode != s3.EncryptionNone {
+			return encryption, fmt.Errorf("%s cannot be combined with a customer-provided key", sseHeader)
+		}
+		encryption.Mode = s3.EncryptionCustomer
+	}
+	return encryption, nil
+}
+
+// parseCustomerKey reads an SSE-C key. It returns nil when the request carries none.
+func parseCustomerKey(r *http.Request) ([]byte, error) {
+	value := r.Header.Get(sseCustomerKeyHeader)
+	if value == "" {
+		return nil, nil
+	}
+	if algorithm := r.Header.Get(sseCustomerAlgorithmHeader); algorithm != "" && algorithm != "AES256" {
+		return nil, fmt.Errorf("Invalid %s header, expected AES256", sseCustomerAlgorithmHeader)
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != s3.CustomerKeySize {
+		return nil, fmt.Errorf("Invalid %s header, expected a base64 encoded %d byte key", sseCustomerKeyHeader, s3.CustomerKeySize)
+	}
+	if value := r.Header.Get(sseCustomerKeyMD5Header); value != "" {
+		sum := md5.Sum(key)
+		if expected, err := base64.StdEncoding.DecodeString(value); err != nil || !bytes.Equal(expected, sum[:]) {
+			return nil, fmt.Errorf("%s does not match the key", sseCustomerKeyMD5Header)
+		}
+	}
+	return key, nil
+}
+
+// withCustomerKey passes a request's SSE-C key on to S3, which needs it to read objects stored with it.
+func withCustomerKey(r *http.Request) (*http.Request, error) {
+	key, err := parseCustomerKey(r)
+	if err != nil || key == nil {
+		return r, err
+	}
+	return r.WithContext(s3.WithCustomerKey(r.Context(), key)), nil
+}
+
+// deduplicable reports whether uploads with encryption may share content-addressed blobs. Blobs
+// are stored once, so keys chosen per request would not apply to later uploads of the same content.
+func deduplicable(encryption s3.Encryption) bool {
+	return encryption.Mode == s3.EncryptionNone || encryption.Mode == s3.EncryptionS3
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/haithamswe/multi-protocol-upload-api/apierror"
+	"github.com/haithamswe/multi-protocol-upload-api/contenttype"
+	"github.com/haithamswe/multi-protocol-upload-api/limits"
+	"github.com/haithamswe/multi-protocol-upload-api/quota"
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+)
+
+func sizeError(err error) error {
+	if errors.Is(err, limits.ErrTooLarge) {
+		return apierror.Wrap(apierror.KindTooLarge, "upload exceeds maximum allowed size", err)
+	}
+	return apierror.Wrap(apierror.KindValidation, err.Error(), err)
+}
+
+func contentTypeError(err error) error {
+	if errors.Is(err, contenttype.ErrMismatch) || errors.Is(err, contenttype.ErrNotAllowed) {
+		return apierror.Wrap(apierror.KindUnsupportedMediaType, err.Error(), err)
+	}
+	return apierror.Wrap(apierror.KindValidation, err.Error(), err)
+}
+
+func quotaError(err error, forbidden bool) error {
+	if !errors.Is(err, quota.ErrBytesExceeded) && !errors.Is(err, quota.ErrObjectsExceeded) {
+		return apierror.Wrap(apierror.KindUpstreamUnavailable, "usage accounting is unavailable", err)
+	}
+	if forbidden {
+		return apierror.Wrap(apierror.KindForbidden, quotaMessage(err), err)
+	}
+	return apierror.Wrap(apierror.KindInsufficientStorage, quotaMessage(err), err)
+}
+
+func quotaMessage(err error) string {
+	if errors.Is(err, quota.ErrObjectsExceeded) {
+		return "object count quota exceeded"
+	}
+	return "storage quota exceeded"
+}
+
+// storageError classifies S3 failures without forwarding S3's own messages, request IDs or
+// bucket details to clients.
+func storageError(err error) error {
+	// Metadata is validated up front, but only Upload knows the final size including the
+	// filename it records.
+	if errors.Is(err, s3.ErrInvalidMetadata) || errors.Is(err, s3.ErrInvalidTags) {
+		return apierror.Wrap(apierror.KindValidation, err.Error(), err)
+	}
+	if errors.Is(err, s3.ErrInvalidEncryption) {
+		return apierror.Wrap(apierror.KindValidation, err.Error(), err)
+	}
+	if errors.Is(err, s3.ErrReservedKey) {
+		// The key names storage the API keeps for itself, such as deduplicated content.
+		return apierror.Wrap(apierror.KindForbidden, "the object key falls under a reserved prefix", err)
+	}
+	if errors.Is(err, s3.ErrKeyConflict) {
+		return apierror.Wrap(apierror.KindConflict, "the object key is in use by another upload", err)
+	}
+	if errors.Is(err, s3.ErrBadDigest) {
+		return apierror.Wrap(apierror.KindBadDigest, err.Error(), err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return apierror.Wrap(apierror.KindCanceled, "request was canceled", err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return apierror.Wrap(apierror.KindUpstreamTimeout, "storage did not respond in time", err)
+	}
+	var s3Err *s3.Error
+	if !errors.As(err, &s3Err) {
+		return apierror.Wrap(apierror.KindUpstreamUnavailable, "storage is unavailable", err)
+	}
+	switch {
+	case s3Err.Code == "NoSuchKey" || s3Err.StatusCode == http.StatusNotFound:
+		return apierror.Wrap(apierror.KindNotFound, "object not found", err)
+	case s3Err.Code == "" && s3Err.StatusCode == http.StatusBadRequest:
+		// HEAD responses have no body. S3 answers them with 400 for SSE-C objects read without
+		// the matching key.
+		return apierror.Wrap(apierror.KindValidation, "storage rejected the request, objects encrypted with SSE-C need their customer key", err)
+	case s3Err.Code == "AccessDenied" || s3Err.StatusCode == http.StatusForbidden:
+		return apierror.Wrap(apierror.KindForbidden, "access to storage was denied", err)
+	case s3Err.Code == "BadDigest" || s3Err.Code == "XAmzContentChecksumMismatch":
+		// The content was verified before it was sent, so it was corrupted on the way to S3.
+		return apierror.Wrap(apierror.KindBadDigest, "storage rejected the upload because it was corrupted in transit, retry the upload", err)
+	case s3Err.Code == "EntityTooLarge":
+		return apierror.Wrap(apierror.KindTooLarge, "upload exceeds the storage object size limit", err)
+	case s3Err.Code == "SlowDown" || s3Err.StatusCode >= http.StatusInternalServerError:
+		return apierror.Wrap(apierror.KindUpstreamUnavailable, "storage is unavailable", err)
+	default:
+		return apierror.Wrap(apierror.KindUpstream, "storage rejected the request", err)
+	}
+}
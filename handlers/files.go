@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/apierror"
+	"github.com/haithamswe/multi-protocol-upload-api/catalog"
+)
+
+func (h handlers) ListFiles(w http.ResponseWriter, r *http.Request) {
+	r, span := h.startSpan(r, "ListFiles")
+	sw := &statusWriter{ResponseWriter: w}
+	w = sw
+	defer func() {
+		endSpan(span, sw.Status())
+	}()
+
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.New(apierror.KindMethodNotAllowed, "Method Not Allowed"))
+		return
+	}
+	if h.catalog == nil {
+		apierror.Write(w, r, apierror.New(apierror.KindNotFound, "file catalog is disabled"))
+		return
+	}
+	query, err := parseFileQuery(r.URL.Query())
+	if err != nil {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+	query.Tenant = r.Header.Get(tenantHeader)
+
+	page, err := h.catalog.List(r.Context(), query)
+	if err != nil {
+		if errors.Is(err, catalog.ErrInvalidCursor) {
+			apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, "Invalid cursor parameter", err))
+			return
+		}
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (h handlers) GetFile(w http.ResponseWriter, r *http.Request) {
+	r, span := h.startSpan(r, "GetFile")
+	sw := &statusWriter{ResponseWriter: w}
+	w = sw
+	defer func() {
+		endSpan(span, sw.Status())
+	}()
+
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.New(apierror.KindMethodNotAllowed, "Method Not Allowed"))
+		return
+	}
+	if h.catalog == nil {
+		apierror.Write(w, r, apierror.New(apierror.KindNotFound, "file catalog is disabled"))
+		return
+	}
+	objectKey := r.URL.Query().Get("objectKey")
+	if objectKey == "" {
+		apierror.Write(w, r, apierror.New(apierror.KindValidation, "Missing objectKey parameter"))
+		return
+	}
+
+	record, err := h.catalog.Get(r.Context(), r.Header.Get(tenantHeader), objectKey)
+	if err != nil {
+		if errors.Is(err, catalog.ErrNotFound) {
+			apierror.Write(w, r, apierror.Wrap(apierror.KindNotFound, "file not found", err))
+			return
+		}
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+func parseFileQuery(values url.Values) (catalog.Query, error) {
+	query := catalog.Query{
+		Search:      values.Get("q"),
+		Prefix:      values.Get("prefix"),
+		ContentType: values.Get("contentType"),
+		Uploader:    values.Get("uploader"),
+		Cursor:      values.Get("cursor"),
+	}
+	for _, tag := range values["tag"] {
+		name, value, _ := strings.Cut(tag, ":")
+		if name == "" {
+			return query, fmt.Errorf("Invalid tag parameter %q", tag)
+		}
+		if query.Tags == nil {
+			query.Tags = map[string]string{}
+		}
+		query.Tags[name] = value
+	}
+
+	ints := []struct {
+		name   string
+		target *int64
+	}{
+		{"minSize", &query.MinSize},
+		{"maxSize", &query.MaxSize},
+	}
+	for _, i := range ints {
+		if raw := values.Get(i.name); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 0 {
+				return query, fmt.Errorf("Invalid %s parameter", i.name)
+			}
+			*i.target = n
+		}
+	}
+	if raw := values.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > catalog.MaxPageSize {
+			return query, fmt.Errorf("Invalid limit parameter, must be between 1 and %d", catalog.MaxPageSize)
+		}
+		query.Limit = n
+	}
+
+	times := []struct {
+		name   string
+		target *time.Time
+	}{
+		{"createdAfter", &query.CreatedAfter},
+		{"createdBefore", &query.CreatedBefore},
+	}
+	for _, t := range times {
+		if raw := values.Get(t.name); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return query, fmt.Errorf("Invalid %s parameter, expected RFC 3339", t.name)
+			}
+			*t.target = parsed
+		}
+	}
+	return query, nil
+}
@@ -1,81 +1,654 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"encoding/hex"
+	"errors"
+	"github.com/haithamswe/multi-protocol-upload-api/apierror"
+	"github.com/haithamswe/multi-protocol-upload-api/archive"
+	"github.com/haithamswe/multi-protocol-upload-api/catalog"
+	"github.com/haithamswe/multi-protocol-upload-api/compression"
+	"github.com/haithamswe/multi-protocol-upload-api/contenttype"
+	"github.com/haithamswe/multi-protocol-upload-api/dedup"
+	"github.com/haithamswe/multi-protocol-upload-api/envelope"
+	"github.com/haithamswe/multi-protocol-upload-api/images"
+	"github.com/haithamswe/multi-protocol-upload-api/limits"
+	"github.com/haithamswe/multi-protocol-upload-api/logging"
+	"github.com/haithamswe/multi-protocol-upload-api/metrics"
+	"github.com/haithamswe/multi-protocol-upload-api/objectkey"
+	"github.com/haithamswe/multi-protocol-upload-api/quota"
 	"github.com/haithamswe/multi-protocol-upload-api/s3"
+	"github.com/haithamswe/multi-protocol-upload-api/scanner"
 	"io"
+	"log/slog"
+	"maps"
 	"net/http"
 	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tenantHeader = "X-Tenant-ID"
+
+	// SigV4 presigned URLs are valid for at most seven days.
+	maxPresignExpires = 7 * 24 * 60 * 60
 )
 
 type Handlers interface {
 	UploadToS3(w http.ResponseWriter, r *http.Request)
 	GetPresignedS3Url(w http.ResponseWriter, r *http.Request)
+	DeleteFromS3(w http.ResponseWriter, r *http.Request)
+	GetUsage(w http.ResponseWriter, r *http.Request)
+	ListFiles(w http.ResponseWriter, r *http.Request)
+	GetFile(w http.ResponseWriter, r *http.Request)
+	GetMetadata(w http.ResponseWriter, r *http.Request)
+	Download(w http.ResponseWriter, r *http.Request)
+	DownloadZip(w http.ResponseWriter, r *http.Request)
 }
 
+type Option func(*handlers)
+
 type handlers struct {
-	s3Client s3.S3
+	s3Client            s3.S3
+	uploadLimits        limits.SizeLimits
+	contentTypePolicy   contenttype.Policy
+	rejectTypeMismatch  bool
+	scanner             scanner.Scanner
+	quarantinePrefix    string
+	metrics             metrics.Metrics
+	tracer              trace.Tracer
+	quotas              quota.Quotas
+	quotaForbidden      bool
+	catalog             catalog.Catalog
+	dedup               dedup.Deduplicator
+	encryptionPolicy    s3.EncryptionPolicy
+	envelope            envelope.Encryptor
+	compressor          compression.Compressor
+	images              images.Processor
+	derivativeKeyPrefix string
+	archiveKeys         objectkey.Strategy
+	archiveLimits       archive.Limits
+}
+
+type usageResponse struct {
+	Tenant string      `json:"tenant"`
+	Usage  quota.Usage `json:"usage"`
+	Limit  quota.Limit `json:"limit"`
+}
+
+type uploadResponse struct {
+	ObjectKey   string       `json:"objectKey"`
+	ContentType string       `json:"contentType"`
+	ETag        string       `json:"etag,omitempty"`
+	Checksums   s3.Checksums `json:"checksums"`
+	ScanStatus  string       `json:"scanStatus,omitempty"`
+	Signature   string       `json:"signature,omitempty"`
+	// Encryption is the server-side encryption requested for the object.
+	Encryption s3.EncryptionMode `json:"encryption,omitempty"`
+	// Deduplicated is set when the tenant had already stored identical content, whose key is returned.
+	Deduplicated bool `json:"deduplicated,omitempty"`
+	// ContentEncoding is set when the content was compressed before it was stored.
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	// EnvelopeEncrypted is set when the service encrypted the content before storing it.
+	EnvelopeEncrypted bool `json:"envelopeEncrypted,omitempty"`
+	// Derivatives maps the names of images rendered from the upload to their keys.
+	Derivatives map[string]string `json:"derivatives,omitempty"`
+	// Extraction is set when an archive was expanded. ObjectKey is then the key of its manifest.
+	Extraction *extractionResponse `json:"extraction,omitempty"`
+}
+
+func WithUploadLimits(uploadLimits limits.SizeLimits) Option {
+	return func(h *handlers) {
+		h.uploadLimits = uploadLimits
+	}
+}
+
+// WithContentTypePolicy enforces allowed/blocked content types per route. When rejectMismatch is
+// set, uploads whose magic bytes contradict the filename extension are rejected as well.
+func WithContentTypePolicy(policy contenttype.Policy, rejectMismatch bool) Option {
+	return func(h *handlers) {
+		h.contentTypePolicy = policy
+		h.rejectTypeMismatch = rejectMismatch
+	}
+}
+
+// WithScanner scans every upload before it is committed to S3. Infected uploads are rejected, or
+// stored under quarantinePrefix when one is configured.
+func WithScanner(s scanner.Scanner, quarantinePrefix string) Option {
+	return func(h *handlers) {
+		h.scanner = s
+		h.quarantinePrefix = quarantinePrefix
+	}
+}
+
+// WithQuotas tracks stored bytes and objects per tenant and rejects uploads that would exceed the
+// tenant's quota with 507 Insufficient Storage, or 403 Forbidden when forbidden is set.
+func WithQuotas(q quota.Quotas, forbidden bool) Option {
+	return func(h *handlers) {
+		h.quotas = q
+		h.quotaForbidden = forbidden
+	}
+}
+
+// WithCatalog records every upload in a queryable file index.
+func WithCatalog(c catalog.Catalog) Option {
+	return func(h *handlers) {
+		h.catalog = c
+	}
+}
+
+// WithDeduplication stores a tenant's clean uploads once per distinct content. Identical uploads
+// share one key, so deleting it deletes the content for all of them.
+func WithDeduplication(d dedup.Deduplicator) Option {
+	return func(h *handlers) {
+		h.dedup = d
+	}
+}
+
+// WithEncryption decides how uploads are encrypted at rest. Without it, uploads use whatever
+// encryption the request asks for.
+func WithEncryption(policy s3.EncryptionPolicy) Option {
+	return func(h *handlers) {
+		h.encryptionPolicy = policy
+	}
+}
+
+// WithEnvelopeEncryption encrypts uploads with a per-object data key before they are stored. The
+// download route decrypts them again.
+func WithEnvelopeEncryption(e envelope.Encryptor) Option {
+	return func(h *handlers) {
+		h.envelope = e
+	}
+}
+
+// WithCompression compresses uploads before they are stored. Downloads through the API are
+// decompressed unless the client accepts the stored encoding.
+func WithCompression(c compression.Compressor) Option {
+	return func(h *handlers) {
+		h.compressor = c
+	}
+}
+
+// WithImageProcessing renders derivatives of uploaded images, which are stored under
+// keyPrefix + <object key> + "/" and deleted along with the image. keyPrefix defaults to
+// images.DefaultPrefix.
+func WithImageProcessing(p images.Processor, keyPrefix string) Option {
+	return func(h *handlers) {
+		if keyPrefix == "" {
+			keyPrefix = images.DefaultPrefix
+		}
+		h.images = p
+		h.derivativeKeyPrefix = keyPrefix
+	}
+}
+
+// WithArchiveExtraction lets uploads ask for zip and tar archives to be expanded into individual
+// objects. keys names the prefix the files of each archive are stored under.
+func WithArchiveExtraction(keys objectkey.Strategy, limits archive.Limits) Option {
+	return func(h *handlers) {
+		h.archiveKeys = keys
+		h.archiveLimits = limits
+	}
+}
+
+func WithMetrics(m metrics.Metrics) Option {
+	return func(h *handlers) {
+		h.metrics = m
+	}
 }
 
 func (h handlers) UploadToS3(w http.ResponseWriter, r *http.Request) {
-	fileData, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	route, tenant := r.URL.Path, r.Header.Get(tenantHeader)
+	start := time.Now()
+	done := h.metrics.UploadStarted(route)
+	r, span := h.startSpan(r, "UploadToS3")
+	sw := &statusWriter{ResponseWriter: w}
+	w = sw
+	var size int64
+	defer func() {
+		done()
+		h.metrics.ObserveUpload(route, tenant, metrics.Outcome(sw.Status()), size, time.Since(start))
+		span.SetAttributes(attribute.Int64("upload.size", size))
+		endSpan(span, sw.Status())
+		logging.AddAttrs(r.Context(), slog.String("tenant", tenant), slog.Int64("size", size))
+	}()
+	if tenant != "" {
+		span.SetAttributes(attribute.String("tenant.id", tenant))
+	}
+
+	if err := objectkey.ValidateTenant(tenant); err != nil {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+	tags, err := parseTags(r)
 	if err != nil {
-		http.Error(w, "io.ReadAll returned error", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+	metadata, err := parseMetadata(r)
+	if err != nil {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+	checksums, err := parseChecksums(r)
+	if err != nil {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+	requestedEncryption, err := parseEncryption(r)
+	if err != nil {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+	encryption, err := h.encryptionPolicy.Resolve(tenant, requestedEncryption)
+	if err != nil {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+	stripMetadata, err := parseStripMetadata(r)
+	if err != nil {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+	extract, err := h.parseExtract(r)
+	if err != nil {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+
+	limit := h.uploadLimits.Resolve(route, tenant)
+	if err := limit.CheckContentLength(r.ContentLength); err != nil {
+		apierror.Write(w, r, sizeError(err))
+		return
+	}
+	if h.quotas != nil && r.ContentLength > 0 {
+		if err := h.quotas.Check(r.Context(), tenant, r.ContentLength); err != nil {
+			apierror.Write(w, r, quotaError(err, h.quotaForbidden))
+			return
+		}
+	}
+
+	body := io.Reader(r.Body)
+	if limit.MaxBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, limit.MaxBytes)
+	}
+	_, readSpan := h.tracer.Start(r.Context(), "ReadBody")
+	fileData, err := io.ReadAll(body)
+	readSpan.End()
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			apierror.Write(w, r, sizeError(limits.ErrTooLarge))
+			return
+		}
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, "could not read request body", err))
+		return
+	}
+	size = int64(len(fileData))
+	if err := limit.Check(size); err != nil {
+		apierror.Write(w, r, sizeError(err))
 		return
 	}
-	defer r.Body.Close()
 
 	fileName := r.URL.Query().Get("filename")
 
-	objectKey, err := h.s3Client.Upload(fileData, fileName)
+	if h.rejectTypeMismatch {
+		if err := contenttype.Verify(fileData, fileName); err != nil {
+			apierror.Write(w, r, contentTypeError(err))
+			return
+		}
+	}
+	contentType := contenttype.Detect(fileData, fileName)
+	if err := h.contentTypePolicy.Check(route, contentType); err != nil {
+		apierror.Write(w, r, contentTypeError(err))
+		return
+	}
+	if stripMetadata {
+		// Client digests describe the image as sent, so they are checked before it changes.
+		if err := s3.ComputeChecksums(fileData).Verify(checksums); err != nil {
+			apierror.Write(w, r, storageError(err))
+			return
+		}
+		checksums = s3.Checksums{}
+		if fileData, err = images.StripMetadata(fileData, contentType); err != nil {
+			apierror.Write(w, r, imageError(err))
+			return
+		}
+		size = int64(len(fileData))
+	}
+	var archiveFormat archive.Format
+	if extract {
+		var ok bool
+		if archiveFormat, ok = archive.Detect(fileData); !ok {
+			apierror.Write(w, r, archiveError(archive.ErrUnsupported))
+			return
+		}
+	}
+
+	uploadOptions := s3.UploadOptions{
+		ContentType: contentType,
+		Tenant:      tenant,
+		Metadata:    metadata,
+		Tags:        tags,
+		Checksums:   checksums,
+		Encryption:  encryption,
+	}
+	response := uploadResponse{ContentType: contentType, Encryption: encryption.Mode}
+	if h.scanner != nil {
+		scanCtx, scanSpan := h.tracer.Start(r.Context(), "Scan")
+		result, err := h.scanner.Scan(scanCtx, fileData)
+		endStep(scanSpan, err)
+		if err != nil {
+			apierror.Write(w, r, apierror.Wrap(apierror.KindUpstreamUnavailable, "malware scanner is unavailable", err))
+			return
+		}
+		response.ScanStatus = "clean"
+		if result.Infected {
+			if h.quarantinePrefix == "" {
+				apierror.Write(w, r, apierror.New(apierror.KindUnprocessable, "upload rejected: malware detected ("+result.Signature+")"))
+				return
+			}
+			uploadOptions.KeyPrefix = h.quarantinePrefix
+			response.ScanStatus = "quarantined"
+			response.Signature = result.Signature
+		}
+	}
+
+	// Infected archives are not expanded. With a quarantine they are stored whole instead.
+	if extract && uploadOptions.KeyPrefix == "" {
+		h.extractArchive(w, r, fileName, fileData, archiveFormat, uploadOptions, response)
+		return
+	}
+
+	storedData, err := h.encode(r.Context(), fileData, &uploadOptions)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
+	response.ContentEncoding = uploadOptions.ContentEncoding
+	response.EnvelopeEncrypted = h.envelope != nil
+	// Client digests describe the content as sent. Once it is transformed, they are verified here
+	// instead of by S3.
+	transformed := uploadOptions.ContentEncoding != "" || h.envelope != nil
+	var contentChecksums s3.Checksums
+	if transformed {
+		contentChecksums = s3.ComputeChecksums(fileData)
+		if err := contentChecksums.Verify(checksums); err != nil {
+			apierror.Write(w, r, storageError(err))
+			return
+		}
+		uploadOptions.Checksums = s3.Checksums{}
+	}
 
-	response := map[string]string{
-		"objectKey": objectKey,
+	var reservation quota.Reservation
+	if h.quotas != nil {
+		// Quotas count the bytes stored, after compression and with the envelope overhead.
+		reservation, err = h.quotas.Reserve(r.Context(), tenant, int64(len(storedData)))
+		if err != nil {
+			apierror.Write(w, r, quotaError(err, h.quotaForbidden))
+			return
+		}
+	}
+
+	var result s3.UploadResult
+	// Quarantined uploads are kept apart from clean content, so they are never deduplicated.
+	// Envelope encrypted content differs on every upload, so there is nothing to share. Blobs
+	// are stored as uploaded, so compressed uploads are stored on their own instead of under a
+	// blob that may hold the same content uncompressed.
+	if h.dedup != nil && h.envelope == nil && uploadOptions.ContentEncoding == "" && uploadOptions.KeyPrefix == "" && deduplicable(encryption) {
+		var deduped dedup.Result
+		deduped, err = h.dedup.Upload(r.Context(), fileData, fileName, uploadOptions, tenant)
+		result, response.Deduplicated = deduped.UploadResult, deduped.Deduplicated
+	} else {
+		result, err = h.s3Client.Upload(r.Context(), storedData, fileName, uploadOptions)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if reservation != nil {
+			reservation.Cancel()
+		}
+		apierror.Write(w, r, storageError(err))
 		return
 	}
+	objectKey := result.Key
+	if !transformed {
+		contentChecksums = result.Checksums
+	}
+	if reservation != nil {
+		// Content the tenant already stored is not charged for twice.
+		if response.Deduplicated {
+			reservation.Cancel()
+		} else if err := reservation.Commit(r.Context(), objectKey); err != nil {
+			slog.ErrorContext(r.Context(), "Could not record usage", "object_key", objectKey, "error", err)
+		}
+	}
+	response.ObjectKey = objectKey
+	response.ETag = result.ETag
+	response.Checksums = contentChecksums
+	span.SetAttributes(attribute.String("aws.s3.key", objectKey))
+	logging.AddAttrs(r.Context(), slog.String("object_key", objectKey), slog.String("content_type", contentType))
+	if response.ScanStatus != "" {
+		logging.AddAttrs(r.Context(), slog.String("scan_status", response.ScanStatus))
+	}
+	if response.Deduplicated {
+		logging.AddAttrs(r.Context(), slog.Bool("deduplicated", true))
+	}
+
+	// A tenant uploading content it already stored keeps the stored object, whose record is left
+	// as it is, so the catalog keeps describing the object that is served.
+	if h.catalog != nil && !response.Deduplicated {
+		record := catalog.Record{
+			Key:              objectKey,
+			OriginalFileName: fileName,
+			Size:             size,
+			ContentType:      contentType,
+			Checksum:         hex.EncodeToString(contentChecksums.SHA256),
+			Uploader:         logging.Principal(r),
+			Tenant:           tenant,
+			Tags:             tags,
+		}
+		// The object is already stored, so a catalog failure is logged rather than failing the upload.
+		if err := h.catalog.Put(r.Context(), record); err != nil {
+			slog.ErrorContext(r.Context(), "Could not record upload in the catalog", "object_key", objectKey, "error", err)
+		}
+	}
+
+	// Quarantined and deduplicated uploads are not processed further.
+	if h.images != nil && uploadOptions.KeyPrefix == "" && !h.isBlob(objectKey) && images.Supported(contentType) {
+		response.Derivatives = h.storeDerivatives(r.Context(), objectKey, fileName, fileData, uploadOptions)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// encode compresses and envelope encrypts data as configured, and returns the bytes to store. The
+// encoding and the metadata needed to read them back are set in opts.
+func (h handlers) encode(ctx context.Context, data []byte, opts *s3.UploadOptions) ([]byte, error) {
+	stored, systemMetadata := data, map[string]string{}
+	if h.compressor != nil {
+		_, compressSpan := h.tracer.Start(ctx, "Compress")
+		compressed, encoding, err := h.compressor.Compress(data, opts.ContentType)
+		compressSpan.End()
+		if err != nil {
+			return nil, apierror.Wrap(apierror.KindInternal, "could not compress upload", err)
+		}
+		if encoding != compression.None {
+			stored = compressed
+			opts.ContentEncoding = string(encoding)
+			systemMetadata[compression.SizeMetadata] = strconv.Itoa(len(data))
+		}
+	}
+	if h.envelope != nil {
+		_, encryptSpan := h.tracer.Start(ctx, "Encrypt")
+		ciphertext, keyMetadata, err := h.envelope.Encrypt(stored)
+		encryptSpan.End()
+		if err != nil {
+			return nil, apierror.Wrap(apierror.KindInternal, "could not encrypt upload", err)
+		}
+		stored = ciphertext
+		maps.Copy(systemMetadata, keyMetadata)
+	}
+	if len(systemMetadata) > 0 {
+		opts.SystemMetadata = systemMetadata
+	}
+	return stored, nil
 }
 
 func (h handlers) GetPresignedS3Url(w http.ResponseWriter, r *http.Request) {
+	r, span := h.startSpan(r, "GetPresignedS3Url")
+	sw := &statusWriter{ResponseWriter: w}
+	w = sw
+	defer func() {
+		h.metrics.ObservePresign(metrics.Outcome(sw.Status()))
+		endSpan(span, sw.Status())
+	}()
+
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, apierror.New(apierror.KindMethodNotAllowed, "Method Not Allowed"))
 		return
 	}
 	objectKey := r.URL.Query().Get("objectKey")
 	if objectKey == "" {
-		http.Error(w, "Missing objectKey parameter", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.New(apierror.KindValidation, "Missing objectKey parameter"))
 		return
 	}
 	expiresStr := r.URL.Query().Get("expires")
 	if expiresStr == "" {
-		http.Error(w, "Missing expires parameter", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.New(apierror.KindValidation, "Missing expires parameter"))
 		return
 	}
 	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || expires <= 0 || expires > maxPresignExpires {
+		apierror.Write(w, r, apierror.New(apierror.KindValidation, "Invalid expires parameter"))
+		return
+	}
+
+	r, err = withCustomerKey(r)
 	if err != nil {
-		http.Error(w, "Invalid expires parameter", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
 		return
 	}
 
-	presignedURL := h.s3Client.PresignUrl(objectKey, expires)
+	logging.AddAttrs(r.Context(), slog.String("object_key", objectKey), slog.Int64("expires", expires))
+	// A presigned URL bypasses this service, so ownership is checked before one is signed.
+	info, err := h.s3Client.HeadObject(r.Context(), objectKey)
+	if err != nil {
+		apierror.Write(w, r, storageError(err))
+		return
+	}
+	if info.Tenant() != r.Header.Get(tenantHeader) {
+		apierror.Write(w, r, apierror.New(apierror.KindNotFound, "object not found"))
+		return
+	}
+	presignedURL := h.s3Client.PresignUrl(r.Context(), objectKey, expires)
 
 	response := map[string]string{
 		"presignedURL": presignedURL,
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, response)
 }
 
-func NewHandlers(s3Client s3.S3) Handlers {
-	return handlers{
-		s3Client: s3Client,
+func (h handlers) DeleteFromS3(w http.ResponseWriter, r *http.Request) {
+	r, span := h.startSpan(r, "DeleteFromS3")
+	sw := &statusWriter{ResponseWriter: w}
+	w = sw
+	defer func() {
+		endSpan(span, sw.Status())
+	}()
+
+	if r.Method != http.MethodDelete {
+		apierror.Write(w, r, apierror.New(apierror.KindMethodNotAllowed, "Method Not Allowed"))
+		return
+	}
+	objectKey := r.URL.Query().Get("objectKey")
+	if objectKey == "" {
+		apierror.Write(w, r, apierror.New(apierror.KindValidation, "Missing objectKey parameter"))
+		return
+	}
+	logging.AddAttrs(r.Context(), slog.String("object_key", objectKey))
+	r, err := withCustomerKey(r)
+	if err != nil {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+
+	// The object's tenant decides who may delete it.
+	info, err := h.s3Client.HeadObject(r.Context(), objectKey)
+	if err != nil {
+		apierror.Write(w, r, storageError(err))
+		return
+	}
+	tenant := r.Header.Get(tenantHeader)
+	if info.Tenant() != tenant {
+		// Do not reveal that another tenant's object exists.
+		apierror.Write(w, r, apierror.New(apierror.KindNotFound, "object not found"))
+		return
+	}
+	if err := h.s3Client.DeleteObject(r.Context(), objectKey); err != nil {
+		apierror.Write(w, r, storageError(err))
+		return
+	}
+	// Deduplicated blobs are never processed, so they have no derivatives.
+	if h.images != nil && !h.isBlob(objectKey) {
+		h.deleteDerivatives(r.Context(), objectKey)
+	}
+	if h.quotas != nil {
+		if err := h.quotas.Release(r.Context(), objectKey); err != nil {
+			slog.ErrorContext(r.Context(), "Could not release usage", "object_key", objectKey, "error", err)
+		}
+	}
+	if h.catalog != nil {
+		if err := h.catalog.Delete(r.Context(), tenant, objectKey); err != nil {
+			slog.ErrorContext(r.Context(), "Could not remove upload from the catalog", "object_key", objectKey, "error", err)
+		}
+	}
+	logging.AddAttrs(r.Context(), slog.String("tenant", tenant), slog.Int64("size", info.Size))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h handlers) isBlob(objectKey string) bool {
+	return h.dedup != nil && h.dedup.IsBlob(objectKey)
+}
+
+func (h handlers) GetUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.New(apierror.KindMethodNotAllowed, "Method Not Allowed"))
+		return
+	}
+	if h.quotas == nil {
+		apierror.Write(w, r, apierror.New(apierror.KindNotFound, "usage accounting is disabled"))
+		return
+	}
+	tenant := r.Header.Get(tenantHeader)
+	usage, err := h.quotas.Usage(r.Context(), tenant)
+	if err != nil {
+		apierror.Write(w, r, quotaError(err, h.quotaForbidden))
+		return
+	}
+	writeJSON(w, http.StatusOK, usageResponse{
+		Tenant: tenant,
+		Usage:  usage,
+		Limit:  h.quotas.Limit(tenant),
+	})
+}
+
+func NewHandlers(s3Client s3.S3, opts ...Option) Handlers {
+	h := handlers{
+		s3Client:          s3Client,
+		uploadLimits:      limits.NewSizeLimits(0, nil, nil, 0, false),
+		contentTypePolicy: contenttype.NewPolicy(contenttype.Rules{}, nil),
+		metrics:           metrics.NewNoopMetrics(),
+		encryptionPolicy:  s3.NewEncryptionPolicy(s3.Encryption{}, nil, true),
+		tracer:            otel.Tracer(tracerName),
+	}
+	for _, opt := range opts {
+		opt(&h)
 	}
+	return h
 }
@@ -1,22 +1,55 @@
 package handlers_test
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/haithamswe/multi-protocol-upload-api/apierror"
+	"github.com/haithamswe/multi-protocol-upload-api/archive"
+	"github.com/haithamswe/multi-protocol-upload-api/catalog"
+	"github.com/haithamswe/multi-protocol-upload-api/compression"
+	"github.com/haithamswe/multi-protocol-upload-api/contenttype"
+	"github.com/haithamswe/multi-protocol-upload-api/dedup"
+	"github.com/haithamswe/multi-protocol-upload-api/envelope"
 	"github.com/haithamswe/multi-protocol-upload-api/handlers"
+	"github.com/haithamswe/multi-protocol-upload-api/images"
+	"github.com/haithamswe/multi-protocol-upload-api/limits"
+	"github.com/haithamswe/multi-protocol-upload-api/metrics"
 	"github.com/haithamswe/multi-protocol-upload-api/mocks"
+	"github.com/haithamswe/multi-protocol-upload-api/objectkey"
+	"github.com/haithamswe/multi-protocol-upload-api/quota"
+	"github.com/haithamswe/multi-protocol-upload-api/requestid"
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+	"github.com/haithamswe/multi-protocol-upload-api/scanner"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestUploadToS3(t *testing.T) {
 	mockS3 := mocks.NewS3(t)
-	mockS3.On("Upload", mock.AnythingOfType("[]uint8"), "test.txt").
-		Return("uploaded-test.txt", nil)
+	mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "test.txt", s3.UploadOptions{ContentType: "text/plain; charset=utf-8"}).
+		Return(s3.UploadResult{Key: "uploaded-test.txt"}, nil)
 
 	h := handlers.NewHandlers(mockS3)
 
@@ -27,23 +60,1431 @@ func TestUploadToS3(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rec.Code)
 
-	var response map[string]string
+	var response map[string]any
 	err := json.NewDecoder(rec.Body).Decode(&response)
 	assert.NoError(t, err)
 	assert.Equal(t, "uploaded-test.txt", response["objectKey"])
+	assert.Equal(t, "text/plain; charset=utf-8", response["contentType"])
 
 	mockS3.AssertExpectations(t)
 }
 
+func TestUploadToS3_InvalidTenant(t *testing.T) {
+	h := handlers.NewHandlers(mocks.NewS3(t))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=test.txt", bytes.NewBufferString("file content"))
+	req.Header.Set("X-Tenant-ID", "evil/acme")
+	rec := httptest.NewRecorder()
+	h.UploadToS3(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestUploadToS3_SizeLimits(t *testing.T) {
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("Upload", mock.Anything, []byte("0123456789"), "ok.txt", mock.AnythingOfType("s3.UploadOptions")).
+		Return(s3.UploadResult{Key: "uploaded-ok.txt"}, nil)
+
+	uploadLimits := limits.NewSizeLimits(20, map[string]int64{"acme": 5}, nil, 2, true)
+	h := handlers.NewHandlers(mockS3, handlers.WithUploadLimits(uploadLimits))
+
+	tests := []struct {
+		name          string
+		body          string
+		tenant        string
+		unknownLength bool
+		expected      int
+	}{
+		{name: "Within limits", body: "0123456789", expected: http.StatusOK},
+		{name: "Content-Length over global limit", body: "012345678901234567890123", expected: http.StatusRequestEntityTooLarge},
+		{name: "Streamed body over global limit", body: "012345678901234567890123", unknownLength: true, expected: http.StatusRequestEntityTooLarge},
+		{name: "Over tenant limit", body: "0123456789", tenant: "acme", expected: http.StatusRequestEntityTooLarge},
+		{name: "Empty body", body: "", expected: http.StatusBadRequest},
+		{name: "Streamed empty body", body: "", unknownLength: true, expected: http.StatusBadRequest},
+		{name: "Below minimum size", body: "0", expected: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := "ok.txt"
+			if tt.expected != http.StatusOK {
+				filename = "rejected.txt"
+			}
+			req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename="+filename, bytes.NewBufferString(tt.body))
+			if tt.unknownLength {
+				req.ContentLength = -1
+			}
+			if tt.tenant != "" {
+				req.Header.Set("X-Tenant-ID", tt.tenant)
+			}
+			rec := httptest.NewRecorder()
+
+			h.UploadToS3(rec, req)
+
+			assert.Equal(t, tt.expected, rec.Code)
+		})
+	}
+}
+
+func TestUploadToS3_ContentTypePolicy(t *testing.T) {
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "photo.png", s3.UploadOptions{ContentType: "image/png"}).
+		Return(s3.UploadResult{Key: "uploaded-photo.png"}, nil)
+
+	policy := contenttype.NewPolicy(contenttype.Rules{Allowed: []string{"image/*"}}, nil)
+	h := handlers.NewHandlers(mockS3, handlers.WithContentTypePolicy(policy, true))
+
+	pngData := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	exeData := "MZ" + strings.Repeat("\x00", 0x3a) + "\x40\x00\x00\x00PE\x00\x00"
+
+	tests := []struct {
+		name     string
+		body     string
+		filename string
+		expected int
+	}{
+		{name: "Allowed image", body: pngData, filename: "photo.png", expected: http.StatusOK},
+		{name: "Executable renamed to jpg", body: exeData, filename: "photo.jpg", expected: http.StatusUnsupportedMediaType},
+		{name: "Type not in allow list", body: "%PDF-1.7\n", filename: "doc.pdf", expected: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename="+tt.filename, bytes.NewBufferString(tt.body))
+			rec := httptest.NewRecorder()
+
+			h.UploadToS3(rec, req)
+
+			assert.Equal(t, tt.expected, rec.Code)
+		})
+	}
+}
+
+func TestUploadToS3_Scanner(t *testing.T) {
+	tests := []struct {
+		name             string
+		result           scanner.Result
+		scanErr          error
+		quarantinePrefix string
+		expected         int
+		expectedPrefix   string
+		expectedStatus   string
+	}{
+		{name: "Clean upload", result: scanner.Result{}, expected: http.StatusOK, expectedStatus: "clean"},
+		{name: "Infected upload rejected", result: scanner.Result{Infected: true, Signature: "Eicar"}, expected: http.StatusUnprocessableEntity},
+		{name: "Infected upload quarantined", result: scanner.Result{Infected: true, Signature: "Eicar"}, quarantinePrefix: "quarantine/", expected: http.StatusOK, expectedPrefix: "quarantine/", expectedStatus: "quarantined"},
+		{name: "Scanner unavailable", scanErr: scanner.ErrScanFailed, expected: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3 := mocks.NewS3(t)
+			if tt.expected == http.StatusOK {
+				mockS3.On("Upload", mock.Anything, []byte("file content"), "test.txt", mock.MatchedBy(func(opts s3.UploadOptions) bool {
+					return opts.KeyPrefix == tt.expectedPrefix
+				})).Return(s3.UploadResult{Key: tt.expectedPrefix + "uploaded-test.txt"}, nil)
+			}
+			mockScanner := mocks.NewScanner(t)
+			mockScanner.On("Scan", mock.Anything, []byte("file content")).Return(tt.result, tt.scanErr)
+
+			h := handlers.NewHandlers(mockS3, handlers.WithScanner(mockScanner, tt.quarantinePrefix))
+
+			req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=test.txt", bytes.NewBufferString("file content"))
+			rec := httptest.NewRecorder()
+
+			h.UploadToS3(rec, req)
+
+			assert.Equal(t, tt.expected, rec.Code)
+			if tt.expected == http.StatusOK {
+				var response map[string]any
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+				assert.Equal(t, tt.expectedStatus, response["scanStatus"])
+				assert.Equal(t, tt.expectedPrefix+"uploaded-test.txt", response["objectKey"])
+			}
+		})
+	}
+}
+
+func TestUploadToS3_StorageErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   apierror.Kind
+	}{
+		{name: "Throttled", err: &s3.Error{StatusCode: 503, Code: "SlowDown", Message: "Please reduce your request rate."}, expectedStatus: http.StatusServiceUnavailable, expectedCode: apierror.KindUpstreamUnavailable},
+		{name: "Access denied", err: &s3.Error{StatusCode: 403, Code: "AccessDenied", Message: "Access Denied"}, expectedStatus: http.StatusForbidden, expectedCode: apierror.KindForbidden},
+		{name: "Entity too large", err: &s3.Error{StatusCode: 400, Code: "EntityTooLarge"}, expectedStatus: http.StatusRequestEntityTooLarge, expectedCode: apierror.KindTooLarge},
+		{name: "Other S3 error", err: &s3.Error{StatusCode: 400, Code: "InvalidBucketName"}, expectedStatus: http.StatusBadGateway, expectedCode: apierror.KindUpstream},
+		{name: "Network error", err: errors.New("dial tcp: i/o timeout"), expectedStatus: http.StatusServiceUnavailable, expectedCode: apierror.KindUpstreamUnavailable},
+		{name: "Deadline exceeded", err: context.DeadlineExceeded, expectedStatus: http.StatusGatewayTimeout, expectedCode: apierror.KindUpstreamTimeout},
+		{name: "Client went away", err: context.Canceled, expectedStatus: apierror.StatusClientClosedRequest, expectedCode: apierror.KindCanceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3 := mocks.NewS3(t)
+			mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "test.txt", mock.AnythingOfType("s3.UploadOptions")).
+				Return(s3.UploadResult{}, tt.err)
+
+			h := handlers.NewHandlers(mockS3)
+
+			req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=test.txt", bytes.NewBufferString("file content"))
+			req = req.WithContext(requestid.NewContext(req.Context(), "req-123"))
+			rec := httptest.NewRecorder()
+
+			h.UploadToS3(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.Equal(t, apierror.ContentType, rec.Header().Get("Content-Type"))
+
+			var problem apierror.Problem
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+			assert.Equal(t, tt.expectedCode, problem.Code)
+			assert.Equal(t, "req-123", problem.RequestID)
+			assert.NotContains(t, problem.Detail, "Please reduce")
+			assert.NotContains(t, problem.Detail, "dial tcp")
+		})
+	}
+}
+
+func TestUploadToS3_Metrics(t *testing.T) {
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "test.txt", mock.AnythingOfType("s3.UploadOptions")).
+		Return(s3.UploadResult{Key: "uploaded-test.txt"}, nil)
+
+	m := metrics.NewPrometheusMetrics(10)
+	uploadLimits := limits.NewSizeLimits(5, nil, nil, 0, false)
+	h := handlers.NewHandlers(mockS3, handlers.WithMetrics(m), handlers.WithUploadLimits(uploadLimits))
+
+	for _, body := range []string{"12345", "too large"} {
+		req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=test.txt", bytes.NewBufferString(body))
+		req.Header.Set("X-Tenant-ID", "acme")
+		h.UploadToS3(httptest.NewRecorder(), req)
+	}
+	h.GetPresignedS3Url(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/get-presigned-s3-url", nil))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	output := rec.Body.String()
+	assert.Contains(t, output, `upload_api_uploads_total{outcome="success",route="/upload-to-s3",tenant="acme"} 1`)
+	assert.Contains(t, output, `upload_api_uploads_total{outcome="rejected",route="/upload-to-s3",tenant="acme"} 1`)
+	assert.Contains(t, output, `upload_api_upload_bytes_total{route="/upload-to-s3",tenant="acme"} 5`)
+	assert.Contains(t, output, `upload_api_uploads_in_flight{route="/upload-to-s3"} 0`)
+	assert.Contains(t, output, `upload_api_presigns_total{outcome="rejected"} 1`)
+}
+
+func TestUploadToS3_Quotas(t *testing.T) {
+	tests := []struct {
+		name           string
+		forbidden      bool
+		chunked        bool
+		expectedStatus int
+		expectedCode   apierror.Kind
+	}{
+		{name: "Insufficient storage", expectedStatus: http.StatusInsufficientStorage, expectedCode: apierror.KindInsufficientStorage},
+		{name: "Forbidden", forbidden: true, expectedStatus: http.StatusForbidden, expectedCode: apierror.KindForbidden},
+		{name: "Without Content-Length", chunked: true, expectedStatus: http.StatusInsufficientStorage, expectedCode: apierror.KindInsufficientStorage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3 := mocks.NewS3(t)
+			mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "test.txt", mock.AnythingOfType("s3.UploadOptions")).
+				Return(s3.UploadResult{Key: "uploaded-test.txt"}, nil).Once()
+
+			q := quota.NewQuotas(quota.Limit{MaxBytes: 20}, nil, quota.NewMemoryStore())
+			h := handlers.NewHandlers(mockS3, handlers.WithQuotas(q, tt.forbidden))
+
+			upload := func(body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=test.txt", bytes.NewBufferString(body))
+				req.Header.Set("X-Tenant-ID", "acme")
+				if tt.chunked {
+					req.ContentLength = -1
+				}
+				rec := httptest.NewRecorder()
+				h.UploadToS3(rec, req)
+				return rec
+			}
+
+			assert.Equal(t, http.StatusOK, upload("file content").Code)
+			assert.Equal(t, quota.Usage{Bytes: 12, Objects: 1}, usageOf(t, q, "acme"))
+
+			rec := upload("more file content")
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			var problem apierror.Problem
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+			assert.Equal(t, tt.expectedCode, problem.Code)
+			assert.Equal(t, "storage quota exceeded", problem.Detail)
+			assert.Equal(t, quota.Usage{Bytes: 12, Objects: 1}, usageOf(t, q, "acme"))
+		})
+	}
+}
+
+func usageOf(t *testing.T, q quota.Quotas, tenant string) quota.Usage {
+	usage, err := q.Usage(context.Background(), tenant)
+	assert.NoError(t, err)
+	return usage
+}
+
+func TestUploadToS3_QuotaReleasedOnFailure(t *testing.T) {
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "test.txt", mock.AnythingOfType("s3.UploadOptions")).
+		Return(s3.UploadResult{}, &s3.Error{StatusCode: 503, Code: "SlowDown"})
+
+	q := quota.NewQuotas(quota.Limit{MaxBytes: 12}, nil, quota.NewMemoryStore())
+	h := handlers.NewHandlers(mockS3, handlers.WithQuotas(q, false))
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		h.UploadToS3(rec, httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=test.txt", bytes.NewBufferString("file content")))
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	}
+	assert.NoError(t, q.Check(context.Background(), "", 12))
+}
+
+func TestDeleteFromS3(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		tenant         string
+		headErr        error
+		expectedStatus int
+		expectedUsage  quota.Usage
+	}{
+		{name: "Deleted", method: http.MethodDelete, tenant: "acme", expectedStatus: http.StatusNoContent, expectedUsage: quota.Usage{Bytes: 10, Objects: 1}},
+		{name: "Other tenant", method: http.MethodDelete, tenant: "globex", expectedStatus: http.StatusNotFound, expectedUsage: quota.Usage{Bytes: 30, Objects: 2}},
+		{name: "Missing object", method: http.MethodDelete, tenant: "acme", headErr: &s3.Error{StatusCode: http.StatusNotFound}, expectedStatus: http.StatusNotFound, expectedUsage: quota.Usage{Bytes: 30, Objects: 2}},
+		{name: "Wrong method", method: http.MethodGet, tenant: "acme", expectedStatus: http.StatusMethodNotAllowed, expectedUsage: quota.Usage{Bytes: 30, Objects: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3 := mocks.NewS3(t)
+			mockS3.On("HeadObject", mock.Anything, "report.pdf").
+				Return(s3.ObjectInfo{Key: "report.pdf", Size: 20, Metadata: map[string]string{"tenant": "acme"}}, tt.headErr).Maybe()
+			if tt.expectedStatus == http.StatusNoContent {
+				mockS3.On("DeleteObject", mock.Anything, "report.pdf").Return(nil)
+			}
+
+			q := quota.NewQuotas(quota.Limit{}, nil, quota.NewMemoryStore())
+			for key, size := range map[string]int64{"report.pdf": 20, "other.pdf": 10} {
+				r, _ := q.Reserve(context.Background(), "acme", size)
+				r.Commit(context.Background(), key)
+			}
+			h := handlers.NewHandlers(mockS3, handlers.WithQuotas(q, false))
+
+			req := httptest.NewRequest(tt.method, "/delete-from-s3?objectKey=report.pdf", nil)
+			req.Header.Set("X-Tenant-ID", tt.tenant)
+			rec := httptest.NewRecorder()
+			h.DeleteFromS3(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.Equal(t, tt.expectedUsage, usageOf(t, q, "acme"))
+		})
+	}
+}
+
+func TestGetUsage(t *testing.T) {
+	q := quota.NewQuotas(quota.Limit{MaxBytes: 100}, map[string]quota.Limit{"acme": {MaxBytes: 50, MaxObjects: 5}}, quota.NewMemoryStore())
+	r, _ := q.Reserve(context.Background(), "acme", 12)
+	r.Commit(context.Background(), "a")
+	h := handlers.NewHandlers(mocks.NewS3(t), handlers.WithQuotas(q, false))
+
+	req := httptest.NewRequest(http.MethodGet, "/usage", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec := httptest.NewRecorder()
+	h.GetUsage(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"tenant":"acme","usage":{"bytes":12,"objects":1},"limit":{"maxBytes":50,"maxObjects":5}}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handlers.NewHandlers(mocks.NewS3(t)).GetUsage(rec, httptest.NewRequest(http.MethodGet, "/usage", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUploadToS3_Catalog(t *testing.T) {
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("Upload", mock.Anything, []byte("file content"), "test.txt", mock.AnythingOfType("s3.UploadOptions")).
+		Return(s3.UploadResult{Key: "uploaded-test.txt", Checksums: s3.ComputeChecksums([]byte("file content"))}, nil)
+	mockCatalog := mocks.NewCatalog(t)
+	mockCatalog.On("Put", mock.Anything, catalog.Record{
+		Key:              "uploaded-test.txt",
+		OriginalFileName: "test.txt",
+		Size:             12,
+		ContentType:      "text/plain; charset=utf-8",
+		Checksum:         "e0ac3601005dfa1864f5392aabaf7d898b1b5bab854f1acb4491bcd806b76b0c",
+		Uploader:         "ip:192.0.2.1",
+		Tenant:           "acme",
+		Tags:             map[string]string{"team": "billing", "draft": ""},
+	}).Return(errors.New("disk full"))
+	h := handlers.NewHandlers(mockS3, handlers.WithCatalog(mockCatalog))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=test.txt", bytes.NewBufferString("file content"))
+	req.Header.Set("X-Tenant-ID", "acme")
+	req.Header.Set("X-Upload-Tags", "team=billing&draft=")
+	rec := httptest.NewRecorder()
+	h.UploadToS3(rec, req)
+
+	// The object is stored, so a catalog failure does not fail the upload.
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=test.txt", bytes.NewBufferString("file content"))
+	req.Header.Set("X-Upload-Tags", "team=billing&team=sales")
+	rec = httptest.NewRecorder()
+	h.UploadToS3(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestListFiles(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		expectedQuery  *catalog.Query
+		listErr        error
+		expectedStatus int
+	}{
+		{
+			name: "Filters",
+			url:  "/files?q=report&prefix=2025/&contentType=image/*&uploader=ip:10.0.0.1&tag=team:billing&tag=draft&minSize=1&maxSize=100&createdAfter=2025-01-01T00:00:00Z&limit=10&cursor=abc",
+			expectedQuery: &catalog.Query{
+				Tenant: "acme", Search: "report", Prefix: "2025/", ContentType: "image/*", Uploader: "ip:10.0.0.1",
+				Tags: map[string]string{"team": "billing", "draft": ""}, MinSize: 1, MaxSize: 100,
+				CreatedAfter: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Limit: 10, Cursor: "abc",
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{name: "Invalid cursor", url: "/files?cursor=abc", expectedQuery: &catalog.Query{Tenant: "acme", Cursor: "abc"}, listErr: catalog.ErrInvalidCursor, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid limit", url: "/files?limit=5000", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid size", url: "/files?minSize=-1", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid time", url: "/files?createdBefore=yesterday", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCatalog := mocks.NewCatalog(t)
+			if tt.expectedQuery != nil {
+				mockCatalog.On("List", mock.Anything, *tt.expectedQuery).
+					Return(catalog.Page{Records: []catalog.Record{{Key: "2025/report.png"}}, NextCursor: "next"}, tt.listErr)
+			}
+			h := handlers.NewHandlers(mocks.NewS3(t), handlers.WithCatalog(mockCatalog))
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.Header.Set("X-Tenant-ID", "acme")
+			rec := httptest.NewRecorder()
+			h.ListFiles(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var page catalog.Page
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+				assert.Equal(t, "next", page.NextCursor)
+				assert.Len(t, page.Records, 1)
+			}
+		})
+	}
+}
+
+func TestGetFile(t *testing.T) {
+	mockCatalog := mocks.NewCatalog(t)
+	mockCatalog.On("Get", mock.Anything, "acme", "report.pdf").Return(catalog.Record{Key: "report.pdf", Size: 20, Tenant: "acme"}, nil)
+	mockCatalog.On("Get", mock.Anything, "globex", "report.pdf").Return(catalog.Record{}, catalog.ErrNotFound)
+	h := handlers.NewHandlers(mocks.NewS3(t), handlers.WithCatalog(mockCatalog))
+
+	for tenant, expectedStatus := range map[string]int{"acme": http.StatusOK, "globex": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/file?objectKey=report.pdf", nil)
+		req.Header.Set("X-Tenant-ID", tenant)
+		rec := httptest.NewRecorder()
+		h.GetFile(rec, req)
+		assert.Equal(t, expectedStatus, rec.Code, tenant)
+	}
+
+	rec := httptest.NewRecorder()
+	handlers.NewHandlers(mocks.NewS3(t)).GetFile(rec, httptest.NewRequest(http.MethodGet, "/file?objectKey=report.pdf", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUploadToS3_MetadataAndTags(t *testing.T) {
+	tests := []struct {
+		name            string
+		url             string
+		headers         map[string]string
+		expectedOptions *s3.UploadOptions
+		expectedStatus  int
+	}{
+		{
+			name:    "Headers and query parameters",
+			url:     "/upload-to-s3?filename=test.txt&meta.owner=zoe&tag.draft=",
+			headers: map[string]string{"X-Upload-Meta-Project-Id": "42", "X-Upload-Tags": "team=billing"},
+			expectedOptions: &s3.UploadOptions{
+				ContentType: "text/plain; charset=utf-8",
+				Metadata:    map[string]string{"project-id": "42", "owner": "zoe"},
+				Tags:        map[string]string{"team": "billing", "draft": ""},
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{name: "Duplicate metadata", url: "/upload-to-s3?filename=test.txt&meta.owner=zoe", headers: map[string]string{"X-Upload-Meta-Owner": "ann"}, expectedStatus: http.StatusBadRequest},
+		{name: "Duplicate tag", url: "/upload-to-s3?filename=test.txt&tag.team=sales", headers: map[string]string{"X-Upload-Tags": "team=billing"}, expectedStatus: http.StatusBadRequest},
+		{name: "Reserved metadata", url: "/upload-to-s3?filename=test.txt", headers: map[string]string{"X-Upload-Meta-Tenant": "globex"}, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid tag", url: "/upload-to-s3?filename=test.txt", headers: map[string]string{"X-Upload-Tags": "team=a%26b"}, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3 := mocks.NewS3(t)
+			if tt.expectedOptions != nil {
+				mockS3.On("Upload", mock.Anything, mock.Anything, "test.txt", *tt.expectedOptions).Return(s3.UploadResult{Key: "uploaded-test.txt"}, nil)
+			}
+			h := handlers.NewHandlers(mockS3)
+
+			req := httptest.NewRequest(http.MethodPost, tt.url, bytes.NewBufferString("file content"))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.UploadToS3(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestGetMetadata(t *testing.T) {
+	info := s3.ObjectInfo{
+		Key:          "report.pdf",
+		Size:         20,
+		ETag:         `"abc"`,
+		ContentType:  "application/pdf",
+		LastModified: time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC),
+		Metadata:     map[string]string{"tenant": "acme", "original-filename": "report.pdf", "owner": "Zoë"},
+		TagCount:     1,
+	}
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("HeadObject", mock.Anything, "report.pdf").Return(info, nil)
+	mockS3.On("GetObjectTagging", mock.Anything, "report.pdf").Return(map[string]string{"team": "billing"}, nil).Once()
+	h := handlers.NewHandlers(mockS3)
+
+	req := httptest.NewRequest(http.MethodGet, "/metadata?objectKey=report.pdf", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec := httptest.NewRecorder()
+	h.GetMetadata(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"objectKey": "report.pdf",
+		"size": 20,
+		"contentType": "application/pdf",
+		"etag": "\"abc\"",
+		"lastModified": "2025-02-24T15:04:05Z",
+		"originalFileName": "report.pdf",
+		"metadata": {"owner": "Zoë"},
+		"tags": {"team": "billing"}
+	}`, rec.Body.String())
+
+	// HEAD returns the same headers without reading the tags.
+	req = httptest.NewRequest(http.MethodHead, "/metadata?objectKey=report.pdf", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec = httptest.NewRecorder()
+	h.GetMetadata(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "=?utf-8?q?Zo=C3=AB?=", rec.Header().Get("X-Upload-Meta-Owner"))
+	assert.Empty(t, rec.Header().Get("X-Upload-Meta-Tenant"))
+	assert.Equal(t, "1", rec.Header().Get("X-Upload-Tag-Count"))
+	assert.Equal(t, "20", rec.Header().Get("X-Object-Size"))
+	assert.Equal(t, "Mon, 24 Feb 2025 15:04:05 GMT", rec.Header().Get("Last-Modified"))
+	assert.Empty(t, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/metadata?objectKey=report.pdf", nil)
+	req.Header.Set("X-Tenant-ID", "globex")
+	rec = httptest.NewRecorder()
+	h.GetMetadata(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUploadToS3_Checksums(t *testing.T) {
+	checksums := s3.ComputeChecksums([]byte("file content"))
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expected       *s3.Checksums
+		uploadErr      error
+		expectedStatus int
+		expectedCode   apierror.Kind
+	}{
+		{name: "No checksums", expected: &s3.Checksums{}, expectedStatus: http.StatusOK},
+		{
+			name:           "Client checksums",
+			headers:        map[string]string{"Content-MD5": "0QtMP/Ejsm3AaNQ6i+8tIw==", "X-Amz-Checksum-Crc32c": "qfp3QA=="},
+			expected:       &s3.Checksums{MD5: checksums.MD5, CRC32C: checksums.CRC32C},
+			expectedStatus: http.StatusOK,
+		},
+		{name: "Malformed header", headers: map[string]string{"Content-MD5": "not base64"}, expectedStatus: http.StatusBadRequest, expectedCode: apierror.KindValidation},
+		{name: "Wrong digest length", headers: map[string]string{"X-Amz-Checksum-Sha256": "0QtMP/Ejsm3AaNQ6i+8tIw=="}, expectedStatus: http.StatusBadRequest, expectedCode: apierror.KindValidation},
+		{
+			name:           "Mismatch",
+			headers:        map[string]string{"Content-MD5": "AAAAAAAAAAAAAAAAAAAAAA=="},
+			expected:       &s3.Checksums{MD5: make([]byte, 16)},
+			uploadErr:      fmt.Errorf("%w: MD5 of the content is 0QtMP/Ejsm3AaNQ6i+8tIw==, expected AAAAAAAAAAAAAAAAAAAAAA==", s3.ErrBadDigest),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   apierror.KindBadDigest,
+		},
+		{
+			name:           "Corrupted in transit",
+			expected:       &s3.Checksums{},
+			uploadErr:      &s3.Error{StatusCode: http.StatusBadRequest, Code: "BadDigest"},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   apierror.KindBadDigest,
+		},
+		{
+			name:           "Key of another tenant",
+			expected:       &s3.Checksums{},
+			uploadErr:      fmt.Errorf("%w: default/e0ac36.txt belongs to another tenant", s3.ErrKeyConflict),
+			expectedStatus: http.StatusConflict,
+			expectedCode:   apierror.KindConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3 := mocks.NewS3(t)
+			if tt.expected != nil {
+				mockS3.On("Upload", mock.Anything, []byte("file content"), "test.txt", mock.MatchedBy(func(opts s3.UploadOptions) bool {
+					return assert.ObjectsAreEqual(*tt.expected, opts.Checksums)
+				})).Return(s3.UploadResult{Key: "uploaded-test.txt", ETag: `"d10b4c3ff123b26dc068d43a8bef2d23"`, Checksums: checksums}, tt.uploadErr)
+			}
+			h := handlers.NewHandlers(mockS3)
+
+			req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=test.txt", bytes.NewBufferString("file content"))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.UploadToS3(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusOK {
+				var problem apierror.Problem
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+				assert.Equal(t, tt.expectedCode, problem.Code)
+				return
+			}
+			var response struct {
+				ETag      string            `json:"etag"`
+				Checksums map[string]string `json:"checksums"`
+			}
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+			assert.Equal(t, `"d10b4c3ff123b26dc068d43a8bef2d23"`, response.ETag)
+			assert.Equal(t, map[string]string{
+				"md5":    "0QtMP/Ejsm3AaNQ6i+8tIw==",
+				"sha256": "4Kw2AQBd+hhk9Tkqq699iYsbW6uFTxrLRJG82Aa3aww=",
+				"crc32c": "qfp3QA==",
+			}, response.Checksums)
+		})
+	}
+}
+
+func TestUploadToS3_Deduplication(t *testing.T) {
+	blob := s3.UploadResult{Key: "blobs/acme/e0ac36", Checksums: s3.ComputeChecksums([]byte("file content"))}
+	mockDedup := mocks.NewDeduplicator(t)
+	mockDedup.On("Upload", mock.Anything, []byte("file content"), "test.txt", mock.AnythingOfType("s3.UploadOptions"), "acme").
+		Return(dedup.Result{UploadResult: blob}, nil).Once()
+	mockDedup.On("Upload", mock.Anything, []byte("file content"), "copy.txt", mock.AnythingOfType("s3.UploadOptions"), "acme").
+		Return(dedup.Result{UploadResult: blob, Deduplicated: true}, nil).Once()
+	mockDedup.On("IsBlob", "blobs/acme/e0ac36").Return(true).Maybe()
+	// The repeated upload keeps the stored object, so its record is not replaced.
+	mockCatalog := mocks.NewCatalog(t)
+	mockCatalog.On("Put", mock.Anything, mock.MatchedBy(func(r catalog.Record) bool { return r.OriginalFileName == "test.txt" })).Return(nil).Once()
+
+	q := quota.NewQuotas(quota.Limit{}, nil, quota.NewMemoryStore())
+	h := handlers.NewHandlers(mocks.NewS3(t), handlers.WithDeduplication(mockDedup), handlers.WithQuotas(q, false), handlers.WithCatalog(mockCatalog))
+
+	for i, fileName := range []string{"test.txt", "copy.txt"} {
+		req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename="+fileName, bytes.NewBufferString("file content"))
+		req.Header.Set("X-Tenant-ID", "acme")
+		rec := httptest.NewRecorder()
+		h.UploadToS3(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var response map[string]any
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+		assert.Equal(t, "blobs/acme/e0ac36", response["objectKey"])
+		assert.Equal(t, i == 1, response["deduplicated"] == true)
+	}
+	// The tenant is charged once for content it references twice.
+	assert.Equal(t, quota.Usage{Bytes: 12, Objects: 1}, usageOf(t, q, "acme"))
+}
+
+func TestUploadToS3_DeduplicationWithCompression(t *testing.T) {
+	logs := bytes.Repeat([]byte("2025-02-24T10:15:00Z INFO request handled status=200\n"), 100)
+	compressor, err := compression.NewCompressor(compression.Gzip, nil, compression.DefaultMinBytes)
+	assert.NoError(t, err)
+	// Compressed uploads are stored on their own, as compressed and labelled.
+	var stored []byte
+	var storedOptions s3.UploadOptions
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "app.log", mock.AnythingOfType("s3.UploadOptions")).
+		Run(func(args mock.Arguments) {
+			stored, storedOptions = args.Get(1).([]byte), args.Get(3).(s3.UploadOptions)
+		}).
+		Return(s3.UploadResult{Key: "app.log"}, nil).Once()
+	// Content too small to compress is still deduplicated.
+	mockDedup := mocks.NewDeduplicator(t)
+	mockDedup.On("Upload", mock.Anything, []byte("file content"), "test.txt", mock.AnythingOfType("s3.UploadOptions"), "acme").
+		Return(dedup.Result{UploadResult: s3.UploadResult{Key: "blobs/acme/e0ac36"}}, nil).Once()
+	mockDedup.On("IsBlob", mock.Anything).Return(false).Maybe()
+	h := handlers.NewHandlers(mockS3, handlers.WithCompression(compressor), handlers.WithDeduplication(mockDedup))
+
+	for fileName, body := range map[string][]byte{"app.log": logs, "test.txt": []byte("file content")} {
+		req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename="+fileName, bytes.NewReader(body))
+		req.Header.Set("X-Tenant-ID", "acme")
+		rec := httptest.NewRecorder()
+		h.UploadToS3(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	decoded, err := compression.NewReader(bytes.NewReader(stored), compression.Gzip)
+	assert.NoError(t, err)
+	content, err := io.ReadAll(decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, logs, content)
+	assert.Equal(t, "gzip", storedOptions.ContentEncoding)
+	assert.Equal(t, strconv.Itoa(len(logs)), storedOptions.SystemMetadata[compression.SizeMetadata])
+}
+
+func TestDeleteFromS3_Deduplicated(t *testing.T) {
+	tests := []struct {
+		name           string
+		tenant         string
+		expectedStatus int
+	}{
+		{name: "Owner deletes the blob", tenant: "globex", expectedStatus: http.StatusNoContent},
+		{name: "Other tenant", tenant: "acme", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3 := mocks.NewS3(t)
+			mockS3.On("HeadObject", mock.Anything, "blobs/globex/e0ac36").
+				Return(s3.ObjectInfo{Key: "blobs/globex/e0ac36", Size: 12, Metadata: map[string]string{"tenant": "globex"}}, nil)
+			mockDedup := mocks.NewDeduplicator(t)
+			mockDedup.On("IsBlob", "blobs/globex/e0ac36").Return(true).Maybe()
+			mockCatalog := mocks.NewCatalog(t)
+			if tt.expectedStatus == http.StatusNoContent {
+				// A blob has a single owner, so deleting it removes the content.
+				mockS3.On("DeleteObject", mock.Anything, "blobs/globex/e0ac36").Return(nil)
+				mockCatalog.On("Delete", mock.Anything, "globex", "blobs/globex/e0ac36").Return(nil)
+			}
+			h := handlers.NewHandlers(mockS3, handlers.WithDeduplication(mockDedup), handlers.WithCatalog(mockCatalog))
+
+			req := httptest.NewRequest(http.MethodDelete, "/delete-from-s3?objectKey=blobs/globex/e0ac36", nil)
+			req.Header.Set("X-Tenant-ID", tt.tenant)
+			rec := httptest.NewRecorder()
+			h.DeleteFromS3(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestUploadToS3_Encryption(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, s3.CustomerKeySize))
+	tests := []struct {
+		name           string
+		tenant         string
+		headers        map[string]string
+		expected       s3.Encryption
+		expectedStatus int
+	}{
+		{
+			name:           "Tenant policy",
+			tenant:         "acme",
+			headers:        map[string]string{"X-Amz-Server-Side-Encryption-Context": base64.StdEncoding.EncodeToString([]byte(`{"project":"apollo"}`))},
+			expected:       s3.Encryption{Mode: s3.EncryptionKMS, KMSKeyID: "alias/acme", KMSContext: map[string]string{"project": "apollo"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Policy cannot be overridden",
+			tenant:         "acme",
+			headers:        map[string]string{"X-Amz-Server-Side-Encryption": "AES256"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Customer key",
+			tenant:         "vault",
+			headers:        map[string]string{"X-Amz-Server-Side-Encryption-Customer-Key": key, "X-Amz-Server-Side-Encryption-Customer-Key-Md5": "y4HAEFCYWuvAXWFTtA1Qpg=="},
+			expected:       s3.Encryption{Mode: s3.EncryptionCustomer, CustomerKey: bytes.Repeat([]byte{7}, s3.CustomerKeySize)},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Customer key MD5 mismatch",
+			tenant:         "vault",
+			headers:        map[string]string{"X-Amz-Server-Side-Encryption-Customer-Key": key, "X-Amz-Server-Side-Encryption-Customer-Key-Md5": "AAAAAAAAAAAAAAAAAAAAAA=="},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Customer key required",
+			tenant:         "vault",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3 := mocks.NewS3(t)
+			if tt.expectedStatus == http.StatusOK {
+				mockS3.On("Upload", mock.Anything, []byte("file content"), "test.txt", mock.MatchedBy(func(opts s3.UploadOptions) bool {
+					return assert.Equal(t, tt.expected, opts.Encryption)
+				})).Return(s3.UploadResult{Key: "uploaded-test.txt"}, nil)
+			}
+			policy := s3.NewEncryptionPolicy(s3.Encryption{}, map[string]s3.Encryption{
+				"acme":  {Mode: s3.EncryptionKMS, KMSKeyID: "alias/acme"},
+				"vault": {Mode: s3.EncryptionCustomer},
+			}, false)
+			h := handlers.NewHandlers(mockS3, handlers.WithEncryption(policy))
+
+			req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=test.txt", bytes.NewBufferString("file content"))
+			req.Header.Set("X-Tenant-ID", tt.tenant)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			h.UploadToS3(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var response map[string]any
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+				assert.Equal(t, string(tt.expected.Mode), response["encryption"])
+			}
+		})
+	}
+}
+
+func TestEnvelopeEncryption(t *testing.T) {
+	encryptor, err := envelope.NewEncryptor("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, envelope.KeySize)})
+	assert.NoError(t, err)
+	var stored []byte
+	var storedOptions s3.UploadOptions
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "notes.txt", mock.AnythingOfType("s3.UploadOptions")).
+		Run(func(args mock.Arguments) {
+			stored, storedOptions = args.Get(1).([]byte), args.Get(3).(s3.UploadOptions)
+		}).
+		Return(s3.UploadResult{Key: "notes.txt"}, nil).Once()
+	q := quota.NewQuotas(quota.Limit{}, nil, quota.NewMemoryStore())
+	h := handlers.NewHandlers(mockS3, handlers.WithEnvelopeEncryption(encryptor), handlers.WithQuotas(q, false))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=notes.txt", bytes.NewBufferString("file content"))
+	req.Header.Set("X-Tenant-ID", "acme")
+	req.Header.Set("Content-MD5", "0QtMP/Ejsm3AaNQ6i+8tIw==")
+	rec := httptest.NewRecorder()
+	h.UploadToS3(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response map[string]any
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, true, response["envelopeEncrypted"])
+	// Checksums describe the plaintext the client sent.
+	assert.Equal(t, "0QtMP/Ejsm3AaNQ6i+8tIw==", response["checksums"].(map[string]any)["md5"])
+	assert.NotContains(t, string(stored), "file content")
+	assert.Equal(t, s3.Checksums{}, storedOptions.Checksums)
+	assert.True(t, envelope.IsEncrypted(storedOptions.SystemMetadata))
+	assert.Equal(t, quota.Usage{Bytes: envelope.EncryptedSize(12), Objects: 1}, usageOf(t, q, "acme"))
+
+	metadata := map[string]string{"tenant": "acme", "original-filename": "notes.txt"}
+	for name, value := range storedOptions.SystemMetadata {
+		metadata[name] = value
+	}
+	info := s3.ObjectInfo{Key: "notes.txt", Size: int64(len(stored)), ContentType: "text/plain; charset=utf-8", Metadata: metadata}
+	mockS3.On("GetObject", mock.Anything, "notes.txt").Return(io.NopCloser(bytes.NewReader(stored)), info, nil)
+
+	req = httptest.NewRequest(http.MethodGet, "/download?objectKey=notes.txt", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec = httptest.NewRecorder()
+	h.Download(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "file content", rec.Body.String())
+	assert.Equal(t, "12", rec.Header().Get("Content-Length"))
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=notes.txt`, rec.Header().Get("Content-Disposition"))
+
+	// A digest that does not match the plaintext is rejected before anything is stored.
+	req = httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=notes.txt", bytes.NewBufferString("file content"))
+	req.Header.Set("Content-MD5", "AAAAAAAAAAAAAAAAAAAAAA==")
+	rec = httptest.NewRecorder()
+	h.UploadToS3(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCompression(t *testing.T) {
+	logs := bytes.Repeat([]byte("2025-02-24T10:15:00Z INFO request handled status=200\n"), 100)
+	compressor, err := compression.NewCompressor(compression.Gzip, nil, compression.DefaultMinBytes)
+	assert.NoError(t, err)
+	var stored []byte
+	var storedOptions s3.UploadOptions
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "app.log", mock.AnythingOfType("s3.UploadOptions")).
+		Run(func(args mock.Arguments) {
+			stored, storedOptions = args.Get(1).([]byte), args.Get(3).(s3.UploadOptions)
+		}).
+		Return(s3.UploadResult{Key: "app.log"}, nil).Once()
+	h := handlers.NewHandlers(mockS3, handlers.WithCompression(compressor))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=app.log", bytes.NewReader(logs))
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec := httptest.NewRecorder()
+	h.UploadToS3(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response map[string]any
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, "gzip", response["contentEncoding"])
+	assert.Equal(t, base64.StdEncoding.EncodeToString(s3.ComputeChecksums(logs).SHA256), response["checksums"].(map[string]any)["sha256"])
+	assert.Less(t, len(stored), len(logs))
+	assert.Equal(t, "gzip", storedOptions.ContentEncoding)
+	assert.Equal(t, strconv.Itoa(len(logs)), storedOptions.SystemMetadata[compression.SizeMetadata])
+
+	info := s3.ObjectInfo{
+		Key:             "app.log",
+		Size:            int64(len(stored)),
+		ContentType:     "text/plain; charset=utf-8",
+		ContentEncoding: "gzip",
+		Metadata:        map[string]string{"tenant": "acme", compression.SizeMetadata: strconv.Itoa(len(logs))},
+	}
+	mockS3.On("GetObject", mock.Anything, "app.log").Return(func(context.Context, string) io.ReadCloser {
+		return io.NopCloser(bytes.NewReader(stored))
+	}, info, nil)
+	tests := []struct {
+		acceptEncoding  string
+		contentEncoding string
+		body            []byte
+	}{
+		{body: logs},
+		{acceptEncoding: "gzip;q=0, br", body: logs},
+		{acceptEncoding: "br, gzip", contentEncoding: "gzip", body: stored},
+	}
+	for _, tt := range tests {
+		req = httptest.NewRequest(http.MethodGet, "/download?objectKey=app.log", nil)
+		req.Header.Set("X-Tenant-ID", "acme")
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		rec = httptest.NewRecorder()
+		h.Download(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, tt.acceptEncoding)
+		assert.Equal(t, tt.body, rec.Body.Bytes(), tt.acceptEncoding)
+		assert.Equal(t, tt.contentEncoding, rec.Header().Get("Content-Encoding"), tt.acceptEncoding)
+		assert.Equal(t, strconv.Itoa(len(tt.body)), rec.Header().Get("Content-Length"), tt.acceptEncoding)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	encryptor, err := envelope.NewEncryptor("k2", map[string][]byte{"k2": bytes.Repeat([]byte{2}, envelope.KeySize)})
+	assert.NoError(t, err)
+	plain := s3.ObjectInfo{Key: "a.txt", Size: 4, Metadata: map[string]string{"tenant": "acme"}}
+	unknownKey := s3.ObjectInfo{Key: "b.txt", Size: 40, Metadata: map[string]string{"tenant": "acme", envelope.MetadataKey: "AAAA", envelope.MetadataKeyID: "k1"}}
+	tests := []struct {
+		name           string
+		info           s3.ObjectInfo
+		getErr         error
+		tenant         string
+		encryptor      envelope.Encryptor
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Plain object", info: plain, tenant: "acme", expectedStatus: http.StatusOK, expectedBody: "data"},
+		{name: "Other tenant", info: plain, tenant: "globex", expectedStatus: http.StatusNotFound},
+		{name: "Missing object", getErr: &s3.Error{StatusCode: http.StatusNotFound, Code: "NoSuchKey"}, tenant: "acme", expectedStatus: http.StatusNotFound},
+		{name: "Encrypted without a keyring", info: unknownKey, tenant: "acme", expectedStatus: http.StatusInternalServerError},
+		{name: "Retired master key", info: unknownKey, tenant: "acme", encryptor: encryptor, expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3 := mocks.NewS3(t)
+			mockS3.On("GetObject", mock.Anything, "a.txt").Return(io.NopCloser(bytes.NewBufferString("data")), tt.info, tt.getErr)
+			var opts []handlers.Option
+			if tt.encryptor != nil {
+				opts = append(opts, handlers.WithEnvelopeEncryption(tt.encryptor))
+			}
+			h := handlers.NewHandlers(mockS3, opts...)
+
+			req := httptest.NewRequest(http.MethodGet, "/download?objectKey=a.txt", nil)
+			req.Header.Set("X-Tenant-ID", tt.tenant)
+			rec := httptest.NewRecorder()
+			h.Download(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedBody, rec.Body.String())
+				assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestImageProcessing(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 32))
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, nil))
+	comment := []byte{0xff, 0xfe, 0, 7, 'h', 'e', 'l', 'l', 'o'}
+	photo := append(append(append([]byte{}, buf.Bytes()[:2]...), comment...), buf.Bytes()[2:]...)
+	processor := images.NewProcessor([]images.Derivative{{Name: "thumb", Width: 16, Format: images.WebP}}, 0)
+	var stored []byte
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "photo.jpg", mock.AnythingOfType("s3.UploadOptions")).
+		Run(func(args mock.Arguments) { stored = args.Get(1).([]byte) }).
+		Return(s3.UploadResult{Key: "photo.jpg"}, nil).Once()
+	mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "photo-thumb.webp", mock.MatchedBy(func(opts s3.UploadOptions) bool {
+		return opts.Key == "derivatives/photo.jpg/thumb.webp" && opts.ContentType == "image/webp" && opts.Tenant == "acme"
+	})).Return(s3.UploadResult{Key: "derivatives/photo.jpg/thumb.webp"}, nil).Once()
+	h := handlers.NewHandlers(mockS3, handlers.WithImageProcessing(processor, ""))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=photo.jpg&stripMetadata=true", bytes.NewReader(photo))
+	req.Header.Set("Content-Type", "image/jpeg")
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec := httptest.NewRecorder()
+	h.UploadToS3(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response map[string]any
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, map[string]any{"thumb": "derivatives/photo.jpg/thumb.webp"}, response["derivatives"])
+	assert.Equal(t, buf.Bytes(), stored)
+
+	// Derivatives are deleted along with the image.
+	mockS3.On("HeadObject", mock.Anything, "photo.jpg").
+		Return(s3.ObjectInfo{Key: "photo.jpg", Size: int64(len(stored)), Metadata: map[string]string{"tenant": "acme"}}, nil)
+	mockS3.On("DeleteObject", mock.Anything, "photo.jpg").Return(nil).Once()
+	mockS3.On("ListObjects", mock.Anything, "derivatives/photo.jpg/", mock.Anything).
+		Return(func(_ context.Context, _ string, fn func(s3.ObjectInfo) error) error {
+			return fn(s3.ObjectInfo{Key: "derivatives/photo.jpg/thumb.webp", Size: 10})
+		})
+	mockS3.On("DeleteObject", mock.Anything, "derivatives/photo.jpg/thumb.webp").Return(nil).Once()
+
+	req = httptest.NewRequest(http.MethodDelete, "/delete-from-s3?objectKey=photo.jpg", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec = httptest.NewRecorder()
+	h.DeleteFromS3(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestUploadToS3_StripMetadata(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		body           string
+		contentType    string
+		expectedStatus int
+	}{
+		{name: "Invalid parameter", query: "stripMetadata=maybe", body: "text", contentType: "text/plain", expectedStatus: http.StatusBadRequest},
+		{name: "Not an image", query: "stripMetadata=true", body: "text", contentType: "text/plain", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "Corrupt image", query: "stripMetadata=1", body: "\x89PNG\r\n\x1a\ntruncated", contentType: "image/png", expectedStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers.NewHandlers(mocks.NewS3(t))
+
+			req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=a&"+tt.query, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			h.UploadToS3(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func newZip(t *testing.T, files ...string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < len(files); i += 2 {
+		w, err := zw.Create(files[i])
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(files[i+1]))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestUploadToS3_ExtractArchive(t *testing.T) {
+	bundle := newZip(t, "docs/read me.txt", "hello", "data.json", `{"a":1}`)
+	keys := mocks.NewStrategy(t)
+	keys.On("Key", objectkey.Input{FileName: "bundle.zip", Tenant: "acme", Data: bundle}).Return("abc_bundle.zip")
+	var manifest map[string]any
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("Upload", mock.Anything, []byte("hello"), "read me.txt", mock.MatchedBy(func(opts s3.UploadOptions) bool {
+		return opts.Key == "abc_bundle.zip/docs/read_me.txt" && opts.Tenant == "acme" && opts.Tags["team"] == "docs"
+	})).Return(s3.UploadResult{Key: "abc_bundle.zip/docs/read_me.txt"}, nil).Once()
+	mockS3.On("Upload", mock.Anything, []byte(`{"a":1}`), "data.json", mock.MatchedBy(func(opts s3.UploadOptions) bool {
+		return opts.Key == "abc_bundle.zip/data.json" && opts.ContentType == "application/json"
+	})).Return(s3.UploadResult{Key: "abc_bundle.zip/data.json"}, nil).Once()
+	mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "abc_bundle.zip.manifest.json", mock.MatchedBy(func(opts s3.UploadOptions) bool {
+		return opts.Key == "abc_bundle.zip.manifest.json"
+	})).Run(func(args mock.Arguments) {
+		assert.NoError(t, json.Unmarshal(args.Get(1).([]byte), &manifest))
+	}).Return(s3.UploadResult{Key: "abc_bundle.zip.manifest.json", ETag: `"m"`}, nil).Once()
+	mockCatalog := mocks.NewCatalog(t)
+	mockCatalog.On("Put", mock.Anything, mock.AnythingOfType("catalog.Record")).Return(nil).Times(3)
+	h := handlers.NewHandlers(mockS3, handlers.WithArchiveExtraction(keys, archive.Limits{}), handlers.WithCatalog(mockCatalog))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=bundle.zip&extract=true", bytes.NewReader(bundle))
+	req.Header.Set("X-Tenant-ID", "acme")
+	req.Header.Set("X-Upload-Tags", "team=docs")
+	rec := httptest.NewRecorder()
+	h.UploadToS3(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response map[string]any
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, "abc_bundle.zip.manifest.json", response["objectKey"])
+	assert.Equal(t, map[string]any{"prefix": "abc_bundle.zip/", "entries": float64(2)}, response["extraction"])
+	assert.Equal(t, "bundle.zip", manifest["archive"])
+	assert.Equal(t, []any{
+		map[string]any{"name": "docs/read me.txt", "key": "abc_bundle.zip/docs/read_me.txt", "size": float64(5), "contentType": "text/plain; charset=utf-8"},
+		map[string]any{"name": "data.json", "key": "abc_bundle.zip/data.json", "size": float64(7), "contentType": "application/json"},
+	}, manifest["entries"])
+}
+
+func TestUploadToS3_ExtractArchive_Rejected(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           []byte
+		extraction     bool
+		storeErr       error
+		expectedStatus int
+	}{
+		{name: "Extraction disabled", body: newZip(t, "a.txt", "a"), expectedStatus: http.StatusBadRequest},
+		{name: "Not an archive", body: []byte("plain text"), extraction: true, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "Path traversal", body: newZip(t, "a.txt", "a", "../b.txt", "b"), extraction: true, expectedStatus: http.StatusUnprocessableEntity},
+		{name: "Too many entries", body: newZip(t, "a.txt", "a", "b.txt", "b", "c.txt", "c"), extraction: true, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "Storage failure", body: newZip(t, "a.txt", "a", "b.txt", "b"), extraction: true, storeErr: errors.New("connection reset"), expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3 := mocks.NewS3(t)
+			var opts []handlers.Option
+			if tt.extraction {
+				keys := mocks.NewStrategy(t)
+				keys.On("Key", mock.Anything).Return("abc_bundle.zip").Maybe()
+				opts = append(opts, handlers.WithArchiveExtraction(keys, archive.Limits{MaxEntries: 2}))
+			}
+			// Entries stored before the failure are deleted again.
+			mockS3.On("Upload", mock.Anything, []byte("a"), "a.txt", mock.Anything).Return(s3.UploadResult{Key: "abc_bundle.zip/a.txt"}, nil).Maybe()
+			mockS3.On("DeleteObject", mock.Anything, "abc_bundle.zip/a.txt").Return(nil).Maybe()
+			if tt.storeErr != nil {
+				mockS3.On("Upload", mock.Anything, []byte("b"), "b.txt", mock.Anything).Return(s3.UploadResult{}, tt.storeErr).Once()
+			}
+			h := handlers.NewHandlers(mockS3, opts...)
+
+			req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=bundle.zip&extract=true", bytes.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			h.UploadToS3(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.storeErr != nil {
+				mockS3.AssertCalled(t, "DeleteObject", mock.Anything, "abc_bundle.zip/a.txt")
+			}
+		})
+	}
+}
+
+func TestUploadToS3_ExtractArchive_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	keys := mocks.NewStrategy(t)
+	keys.On("Key", mock.Anything).Return("abc_bundle.zip")
+	var uploadSpan trace.SpanContext
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("Upload", mock.Anything, []byte("a"), "a.txt", mock.Anything).
+		Run(func(args mock.Arguments) {
+			uploadSpan = trace.SpanContextFromContext(args.Get(0).(context.Context))
+		}).
+		Return(s3.UploadResult{}, errors.New("connection reset"))
+	h := handlers.NewHandlers(mockS3, handlers.WithTracerProvider(tp), handlers.WithArchiveExtraction(keys, archive.Limits{}))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=bundle.zip&extract=true", bytes.NewReader(newZip(t, "a.txt", "a")))
+	h.UploadToS3(httptest.NewRecorder(), req)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	extract := spans["ExtractArchive"]
+	if assert.NotNil(t, extract) {
+		assert.Equal(t, spans["UploadToS3"].SpanContext().SpanID(), extract.Parent().SpanID())
+		assert.Equal(t, extract.SpanContext(), uploadSpan)
+		assert.Equal(t, codes.Error, extract.Status().Code)
+		assert.Len(t, extract.Events(), 1, "the error is recorded on the span")
+	}
+}
+
+func TestDownloadZip(t *testing.T) {
+	report := bytes.Repeat([]byte("quarterly figures\n"), 100)
+	compressor, err := compression.NewCompressor(compression.Gzip, nil, 0)
+	assert.NoError(t, err)
+	compressed, _, err := compressor.Compress(report, "text/plain")
+	assert.NoError(t, err)
+	objects := map[string]struct {
+		data []byte
+		info s3.ObjectInfo
+	}{
+		"reports/2025/q1.txt": {compressed, s3.ObjectInfo{Key: "reports/2025/q1.txt", ContentEncoding: "gzip", Metadata: map[string]string{"tenant": "acme"}}},
+		"reports/2025/q2.txt": {[]byte("q2"), s3.ObjectInfo{Key: "reports/2025/q2.txt", Metadata: map[string]string{"tenant": "acme"}}},
+		"reports/2025/x.txt":  {[]byte("x"), s3.ObjectInfo{Key: "reports/2025/x.txt", Metadata: map[string]string{"tenant": "globex"}}},
+	}
+	mockS3 := mocks.NewS3(t)
+	for key, object := range objects {
+		mockS3.On("HeadObject", mock.Anything, key).Return(object.info, nil).Maybe()
+		mockS3.On("GetObject", mock.Anything, key).Return(func(context.Context, string) io.ReadCloser {
+			return io.NopCloser(bytes.NewReader(object.data))
+		}, object.info, nil).Maybe()
+	}
+	mockS3.On("ListObjects", mock.Anything, "reports/2025/", mock.Anything).
+		Return(func(_ context.Context, _ string, fn func(s3.ObjectInfo) error) error {
+			for _, key := range []string{"reports/2025/q1.txt", "reports/2025/q2.txt", "reports/2025/x.txt"} {
+				if err := fn(s3.ObjectInfo{Key: key}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	h := handlers.NewHandlers(mockS3)
+	tests := []struct {
+		name        string
+		query       string
+		disposition string
+		entries     map[string]string
+	}{
+		{
+			name:        "Object keys",
+			query:       "objectKey=reports/2025/q2.txt&objectKey=reports/2025/q1.txt&filename=reports.zip",
+			disposition: `attachment; filename=reports.zip`,
+			entries:     map[string]string{"reports/2025/q2.txt": "q2", "reports/2025/q1.txt": string(report)},
+		},
+		{
+			name:        "Prefix",
+			query:       "prefix=reports/2025/",
+			disposition: `attachment; filename=2025.zip`,
+			entries:     map[string]string{"q1.txt": string(report), "q2.txt": "q2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/download-zip?"+tt.query, nil)
+			req.Header.Set("X-Tenant-ID", "acme")
+			rec := httptest.NewRecorder()
+			h.DownloadZip(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+			assert.Equal(t, tt.disposition, rec.Header().Get("Content-Disposition"))
+			zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+			assert.NoError(t, err)
+			entries := map[string]string{}
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				assert.NoError(t, err)
+				data, err := io.ReadAll(rc)
+				assert.NoError(t, err)
+				entries[f.Name] = string(data)
+			}
+			assert.Equal(t, tt.entries, entries)
+		})
+	}
+}
+
+func TestDownloadZip_Rejected(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{name: "No objects", query: "", expectedStatus: http.StatusBadRequest},
+		{name: "Keys and prefix", query: "objectKey=a.txt&prefix=docs/", expectedStatus: http.StatusBadRequest},
+		{name: "Missing object", query: "objectKey=a.txt&objectKey=missing.txt", expectedStatus: http.StatusNotFound},
+		{name: "Other tenant", query: "objectKey=a.txt&objectKey=other.txt", expectedStatus: http.StatusNotFound},
+		{name: "Nothing under prefix", query: "prefix=docs/", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3 := mocks.NewS3(t)
+			mockS3.On("HeadObject", mock.Anything, "a.txt").Return(s3.ObjectInfo{Key: "a.txt", Metadata: map[string]string{"tenant": "acme"}}, nil).Maybe()
+			mockS3.On("HeadObject", mock.Anything, "missing.txt").Return(s3.ObjectInfo{}, &s3.Error{StatusCode: http.StatusNotFound}).Maybe()
+			mockS3.On("HeadObject", mock.Anything, "other.txt").Return(s3.ObjectInfo{Key: "other.txt", Metadata: map[string]string{"tenant": "globex"}}, nil).Maybe()
+			mockS3.On("HeadObject", mock.Anything, "docs/b.txt").Return(s3.ObjectInfo{Key: "docs/b.txt", Metadata: map[string]string{"tenant": "globex"}}, nil).Maybe()
+			mockS3.On("ListObjects", mock.Anything, "docs/", mock.Anything).
+				Return(func(_ context.Context, _ string, fn func(s3.ObjectInfo) error) error {
+					return fn(s3.ObjectInfo{Key: "docs/b.txt"})
+				}).Maybe()
+			h := handlers.NewHandlers(mockS3)
+
+			req := httptest.NewRequest(http.MethodGet, "/download-zip?"+tt.query, nil)
+			req.Header.Set("X-Tenant-ID", "acme")
+			rec := httptest.NewRecorder()
+			h.DownloadZip(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestDownloadZip_PrefixOfManyTenants(t *testing.T) {
+	own := s3.ObjectInfo{Key: "docs/own.txt", Metadata: map[string]string{"tenant": "acme"}}
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("ListObjects", mock.Anything, "docs/", mock.Anything).
+		Return(func(_ context.Context, _ string, fn func(s3.ObjectInfo) error) error {
+			// More objects of other tenants than an archive may hold.
+			for i := range 1500 {
+				if err := fn(s3.ObjectInfo{Key: fmt.Sprintf("docs/%04d.txt", i)}); err != nil {
+					return err
+				}
+			}
+			for _, key := range []string{"docs/own.txt", "docs/sse-c.txt", "docs/deleted.txt"} {
+				if err := fn(s3.ObjectInfo{Key: key}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	mockS3.On("HeadObject", mock.Anything, "docs/own.txt").Return(own, nil)
+	mockS3.On("HeadObject", mock.Anything, "docs/sse-c.txt").Return(s3.ObjectInfo{}, &s3.Error{StatusCode: http.StatusBadRequest})
+	mockS3.On("HeadObject", mock.Anything, "docs/deleted.txt").Return(s3.ObjectInfo{}, &s3.Error{StatusCode: http.StatusNotFound})
+	mockS3.On("HeadObject", mock.Anything, mock.AnythingOfType("string")).Return(s3.ObjectInfo{Metadata: map[string]string{"tenant": "globex"}}, nil)
+	mockS3.On("GetObject", mock.Anything, "docs/own.txt").Return(io.NopCloser(bytes.NewBufferString("own")), own, nil)
+	h := handlers.NewHandlers(mockS3)
+
+	req := httptest.NewRequest(http.MethodGet, "/download-zip?prefix=docs/", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec := httptest.NewRecorder()
+	h.DownloadZip(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	assert.NoError(t, err)
+	if assert.Len(t, zr.File, 1) {
+		assert.Equal(t, "own.txt", zr.File[0].Name)
+	}
+}
+
+func TestDownloadZip_StorageUnavailable(t *testing.T) {
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("ListObjects", mock.Anything, "docs/", mock.Anything).
+		Return(func(_ context.Context, _ string, fn func(s3.ObjectInfo) error) error {
+			return fn(s3.ObjectInfo{Key: "docs/a.txt"})
+		})
+	mockS3.On("HeadObject", mock.Anything, "docs/a.txt").Return(s3.ObjectInfo{}, &s3.Error{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"})
+	h := handlers.NewHandlers(mockS3)
+
+	req := httptest.NewRequest(http.MethodGet, "/download-zip?prefix=docs/", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec := httptest.NewRecorder()
+	h.DownloadZip(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestDownloadZip_Catalog(t *testing.T) {
+	info := s3.ObjectInfo{Key: "docs/a.txt", Metadata: map[string]string{"tenant": "acme"}}
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("HeadObject", mock.Anything, "docs/a.txt").Return(info, nil)
+	mockS3.On("GetObject", mock.Anything, "docs/a.txt").Return(io.NopCloser(bytes.NewBufferString("a")), info, nil)
+	mockCatalog := mocks.NewCatalog(t)
+	mockCatalog.On("List", mock.Anything, catalog.Query{Tenant: "acme", Prefix: "docs/", Limit: catalog.MaxPageSize}).
+		Return(catalog.Page{Records: []catalog.Record{{Key: "docs/a.txt"}}, NextCursor: "next"}, nil)
+	mockCatalog.On("List", mock.Anything, catalog.Query{Tenant: "acme", Prefix: "docs/", Limit: catalog.MaxPageSize, Cursor: "next"}).
+		Return(catalog.Page{}, nil)
+	h := handlers.NewHandlers(mockS3, handlers.WithCatalog(mockCatalog))
+
+	req := httptest.NewRequest(http.MethodGet, "/download-zip?prefix=docs/", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec := httptest.NewRecorder()
+	h.DownloadZip(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockS3.AssertNotCalled(t, "ListObjects", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDownloadZip_EndsEarly(t *testing.T) {
+	info := s3.ObjectInfo{Key: "a.txt", Metadata: map[string]string{"tenant": "acme"}}
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("HeadObject", mock.Anything, "a.txt").Return(info, nil)
+	mockS3.On("HeadObject", mock.Anything, "b.txt").Return(s3.ObjectInfo{Key: "b.txt", Metadata: map[string]string{"tenant": "acme"}}, nil)
+	mockS3.On("GetObject", mock.Anything, "a.txt").Return(io.NopCloser(bytes.NewBufferString("a")), info, nil)
+	// The object was deleted after the archive was started.
+	mockS3.On("GetObject", mock.Anything, "b.txt").Return(nil, s3.ObjectInfo{}, &s3.Error{StatusCode: http.StatusNotFound})
+	h := handlers.NewHandlers(mockS3)
+
+	req := httptest.NewRequest(http.MethodGet, "/download-zip?objectKey=a.txt&objectKey=b.txt", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec := httptest.NewRecorder()
+	h.DownloadZip(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	_, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	assert.Error(t, err, "a truncated archive has no central directory")
+}
+
+func TestUploadToS3_Tracing(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	var uploadSpan trace.SpanContext
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("Upload", mock.Anything, mock.AnythingOfType("[]uint8"), "test.txt", mock.AnythingOfType("s3.UploadOptions")).
+		Run(func(args mock.Arguments) {
+			uploadSpan = trace.SpanContextFromContext(args.Get(0).(context.Context))
+		}).
+		Return(s3.UploadResult{}, &s3.Error{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"})
+
+	h := handlers.NewHandlers(mockS3, handlers.WithTracerProvider(tp))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload-to-s3?filename=test.txt", bytes.NewBufferString("file content"))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	req.Header.Set("X-Tenant-ID", "acme")
+	h.UploadToS3(httptest.NewRecorder(), req)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	server := spans["UploadToS3"]
+	if assert.NotNil(t, server) {
+		assert.Equal(t, traceID, server.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+		assert.True(t, server.Parent().IsRemote())
+		assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+		assert.Equal(t, codes.Error, server.Status().Code)
+		assert.Contains(t, server.Attributes(), attribute.Int("http.response.status_code", http.StatusServiceUnavailable))
+		assert.Contains(t, server.Attributes(), attribute.String("tenant.id", "acme"))
+		assert.Equal(t, server.SpanContext(), uploadSpan)
+		assert.Equal(t, server.SpanContext().SpanID(), spans["ReadBody"].Parent().SpanID())
+	}
+}
+
 func TestGetPresignedS3Url(t *testing.T) {
 	mockS3 := mocks.NewS3(t)
-	mockS3.On("PresignUrl", "test.txt", int64(3600)).
+	mockS3.On("HeadObject", mock.Anything, "test.txt").
+		Return(s3.ObjectInfo{Key: "test.txt", Size: 4, Metadata: map[string]string{"tenant": "acme"}}, nil)
+	mockS3.On("HeadObject", mock.Anything, "missing.txt").Return(s3.ObjectInfo{}, &s3.Error{StatusCode: http.StatusNotFound})
+	mockS3.On("PresignUrl", mock.Anything, "test.txt", int64(3600)).
 		Return("http://example.com/test.txt?expires=3600")
 
 	h := handlers.NewHandlers(mockS3)
 
 	// --- Valid Request ---
 	req := httptest.NewRequest(http.MethodGet, "/presign?objectKey=test.txt&expires=3600", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
 	rec := httptest.NewRecorder()
 
 	h.GetPresignedS3Url(rec, req)
@@ -69,5 +1510,28 @@ func TestGetPresignedS3Url(t *testing.T) {
 	h.GetPresignedS3Url(recInvalid, reqInvalid)
 	assert.Equal(t, http.StatusBadRequest, recInvalid.Code)
 
+	var problem apierror.Problem
+	assert.NoError(t, json.NewDecoder(recInvalid.Body).Decode(&problem))
+	assert.Equal(t, apierror.KindValidation, problem.Code)
+	assert.Equal(t, "Invalid expires parameter", problem.Detail)
+
+	// --- Edge Case: expires beyond the SigV4 maximum of seven days ---
+	reqTooLong := httptest.NewRequest(http.MethodGet, "/presign?objectKey=test.txt&expires=604801", nil)
+	recTooLong := httptest.NewRecorder()
+
+	h.GetPresignedS3Url(recTooLong, reqTooLong)
+	assert.Equal(t, http.StatusBadRequest, recTooLong.Code)
+
+	// --- Edge Case: objects of other tenants and missing objects are not signed ---
+	for _, target := range []string{"objectKey=test.txt", "objectKey=missing.txt"} {
+		reqOther := httptest.NewRequest(http.MethodGet, "/presign?"+target+"&expires=3600", nil)
+		reqOther.Header.Set("X-Tenant-ID", "globex")
+		recOther := httptest.NewRecorder()
+
+		h.GetPresignedS3Url(recOther, reqOther)
+		assert.Equal(t, http.StatusNotFound, recOther.Code)
+	}
+	mockS3.AssertNumberOfCalls(t, "PresignUrl", 1)
+
 	mockS3.AssertExpectations(t)
 }
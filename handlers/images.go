@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/haithamswe/multi-protocol-upload-api/apierror"
+	"github.com/haithamswe/multi-protocol-upload-api/images"
+	"github.com/haithamswe/multi-protocol-upload-api/quota"
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+)
+
+// stripMetadataParam asks for EXIF, XMP and similar metadata to be removed from an uploaded image.
+const stripMetadataParam = "stripMetadata"
+
+func parseStripMetadata(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get(stripMetadataParam)
+	if value == "" {
+		return false, nil
+	}
+	strip, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("Invalid %s parameter, expected true or false", stripMetadataParam)
+	}
+	return strip, nil
+}
+
+func imageError(err error) error {
+	if errors.Is(err, images.ErrUnsupported) {
+		return apierror.Wrap(apierror.KindUnsupportedMediaType, err.Error(), err)
+	}
+	return apierror.Wrap(apierror.KindUnprocessable, err.Error(), err)
+}
+
+// derivativePrefix returns the prefix under which the derivatives of objectKey are stored.
+func (h handlers) derivativePrefix(objectKey string) string {
+	return h.derivativeKeyPrefix + objectKey + "/"
+}
+
+// storeDerivatives renders and stores the configured derivatives of an uploaded image, and returns
+// their keys by name. The original is already stored, so failures are logged and the affected
+// derivatives left out.
+func (h handlers) storeDerivatives(ctx context.Context, objectKey, fileName string, data []byte, opts s3.UploadOptions) map[string]string {
+	ctx, span := h.tracer.Start(ctx, "RenderDerivatives")
+	renditions, err := h.images.Render(data, opts.ContentType)
+	span.End()
+	if err != nil {
+		slog.WarnContext(ctx, "Could not render image derivatives", "object_key", objectKey, "error", err)
+		return nil
+	}
+
+	baseName := strings.TrimSuffix(fileName, path.Ext(fileName))
+	keys := map[string]string{}
+	for _, rendition := range renditions {
+		ext := rendition.Format.Extension()
+		derivativeOptions := s3.UploadOptions{
+			Key:         h.derivativePrefix(objectKey) + rendition.Name + "." + ext,
+			ContentType: rendition.Format.ContentType(),
+			Tenant:      opts.Tenant,
+			Encryption:  opts.Encryption,
+		}
+		stored := rendition.Data
+		if h.envelope != nil {
+			ciphertext, keyMetadata, err := h.envelope.Encrypt(stored)
+			if err != nil {
+				slog.ErrorContext(ctx, "Could not encrypt image derivative", "object_key", derivativeOptions.Key, "error", err)
+				continue
+			}
+			stored, derivativeOptions.SystemMetadata = ciphertext, maps.Clone(keyMetadata)
+		}
+		var reservation quota.Reservation
+		if h.quotas != nil {
+			if reservation, err = h.quotas.Reserve(ctx, opts.Tenant, int64(len(stored))); err != nil {
+				slog.WarnContext(ctx, "Skipped image derivative", "object_key", derivativeOptions.Key, "error", err)
+				continue
+			}
+		}
+		result, err := h.s3Client.Upload(ctx, stored, baseName+"-"+rendition.Name+"."+ext, derivativeOptions)
+		if err != nil {
+			if reservation != nil {
+				reservation.Cancel()
+			}
+			slog.ErrorContext(ctx, "Could not store image derivative", "object_key", derivativeOptions.Key, "error", err)
+			continue
+		}
+		if reservation != nil {
+			if err := reservation.Commit(ctx, result.Key); err != nil {
+				slog.ErrorContext(ctx, "Could not record usage", "object_key", result.Key, "error", err)
+			}
+		}
+		keys[rendition.Name] = result.Key
+	}
+	return keys
+}
+
+// deleteDerivatives removes the derivatives stored for an image that was deleted. Failures are
+// logged, since the image itself is already gone.
+func (h handlers) deleteDerivatives(ctx context.Context, objectKey string) {
+	err := h.s3Client.ListObjects(ctx, h.derivativePrefix(objectKey), func(info s3.ObjectInfo) error {
+		if err := h.s3Client.DeleteObject(ctx, info.Key); err != nil {
+			return err
+		}
+		if h.quotas != nil {
+			if err := h.quotas.Release(ctx, info.Key); err != nil {
+				slog.ErrorContext(ctx, "Could not release usage", "object_key", info.Key, "error", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not delete image derivatives", "object_key", objectKey, "error", err)
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/apierror"
+	"github.com/haithamswe/multi-protocol-upload-api/envelope"
+	"github.com/haithamswe/multi-protocol-upload-api/logging"
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+)
+
+const (
+	// tagsHeader carries an upload's tags in query string form, e.g. "team=billing&draft=".
+	tagsHeader = "X-Upload-Tags"
+	// Metadata is sent as X-Upload-Meta-<name> headers and returned the same way.
+	metadataHeaderPrefix = "X-Upload-Meta-"
+	tagCountHeader       = "X-Upload-Tag-Count"
+
+	// Query parameter equivalents, for clients that cannot set headers.
+	metadataParamPrefix = "meta."
+	tagParamPrefix      = "tag."
+)
+
+type metadataResponse struct {
+	ObjectKey         string            `json:"objectKey"`
+	Size              int64             `json:"size"`
+	ContentType       string            `json:"contentType,omitempty"`
+	ETag              string            `json:"etag,omitempty"`
+	LastModified      time.Time         `json:"lastModified"`
+	Encryption        s3.EncryptionMode `json:"encryption,omitempty"`
+	ContentEncoding   string            `json:"contentEncoding,omitempty"`
+	EnvelopeEncrypted bool              `json:"envelopeEncrypted,omitempty"`
+	OriginalFileName  string            `json:"originalFileName,omitempty"`
+	Metadata          map[string]string `json:"metadata"`
+	Tags              map[string]string `json:"tags"`
+}
+
+// GetMetadata returns an object's user-defined metadata and tags. HEAD requests only get the
+// headers, which skips the extra S3 call needed to read the tags.
+func (h handlers) GetMetadata(w http.ResponseWriter, r *http.Request) {
+	r, span := h.startSpan(r, "GetMetadata")
+	sw := &statusWriter{ResponseWriter: w}
+	w = sw
+	defer func() {
+		endSpan(span, sw.Status())
+	}()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		apierror.Write(w, r, apierror.New(apierror.KindMethodNotAllowed, "Method Not Allowed"))
+		return
+	}
+	objectKey := r.URL.Query().Get("objectKey")
+	if objectKey == "" {
+		apierror.Write(w, r, apierror.New(apierror.KindValidation, "Missing objectKey parameter"))
+		return
+	}
+	logging.AddAttrs(r.Context(), slog.String("object_key", objectKey))
+	r, err := withCustomerKey(r)
+	if err != nil {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+
+	info, err := h.s3Client.HeadObject(r.Context(), objectKey)
+	if err != nil {
+		apierror.Write(w, r, storageError(err))
+		return
+	}
+	if info.Tenant() != r.Header.Get(tenantHeader) {
+		apierror.Write(w, r, apierror.New(apierror.KindNotFound, "object not found"))
+		return
+	}
+
+	// Report the size of the content as uploaded rather than as stored.
+	size := contentSize(info)
+	if size < 0 {
+		size = info.Size
+	}
+	metadata := info.UserMetadata()
+	tagCount := info.TagCount
+	if info.Encryption == s3.EncryptionCustomer && info.Tenant() != "" {
+		// SSE-C uploads carry a tag recording their tenant, which is not shown.
+		tagCount--
+	}
+	header := w.Header()
+	for name, value := range metadata {
+		header.Set(metadataHeaderPrefix+name, mime.QEncoding.Encode("utf-8", value))
+	}
+	header.Set(tagCountHeader, strconv.Itoa(tagCount))
+	header.Set("X-Object-Size", strconv.FormatInt(size, 10))
+	if info.ETag != "" {
+		header.Set("ETag", info.ETag)
+	}
+	if !info.LastModified.IsZero() {
+		header.Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	tags := map[string]string{}
+	if info.TagCount > 0 {
+		if tags, err = h.s3Client.GetObjectTagging(r.Context(), objectKey); err != nil {
+			apierror.Write(w, r, storageError(err))
+			return
+		}
+		delete(tags, s3.TenantTag)
+	}
+	writeJSON(w, http.StatusOK, metadataResponse{
+		ObjectKey:         objectKey,
+		Size:              size,
+		ContentType:       info.ContentType,
+		ETag:              info.ETag,
+		LastModified:      info.LastModified,
+		Encryption:        info.Encryption,
+		ContentEncoding:   info.ContentEncoding,
+		EnvelopeEncrypted: envelope.IsEncrypted(info.Metadata),
+		OriginalFileName:  info.OriginalFileName(),
+		Metadata:          metadata,
+		Tags:              tags,
+	})
+}
+
+// parseMetadata collects user-defined metadata from X-Upload-Meta-* headers and meta.* query
+// parameters. Names are case-insensitive and stored in lowercase.
+func parseMetadata(r *http.Request) (map[string]string, error) {
+	var metadata map[string]string
+	set := func(name string, values []string) error {
+		name = strings.ToLower(name)
+		if _, ok := metadata[name]; ok || len(values) != 1 {
+			return fmt.Errorf("Metadata %q is given more than once", name)
+		}
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata[name] = values[0]
+		return nil
+	}
+	for key, values := range r.Header {
+		if name, ok := strings.CutPrefix(key, metadataHeaderPrefix); ok {
+			if err := set(name, values); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for key, values := range r.URL.Query() {
+		if name, ok := strings.CutPrefix(key, metadataParamPrefix); ok {
+			if err := set(name, values); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s3.ValidateMetadata(metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// parseTags collects tags from the X-Upload-Tags header and tag.* query parameters. Each tag name
+// may appear once.
+func parseTags(r *http.Request) (map[string]string, error) {
+	var tags map[string]string
+	set := func(name string, values []string) error {
+		if _, ok := tags[name]; ok || name == "" || len(values) != 1 {
+			return fmt.Errorf("Tag %q must be given once with a non-empty name", name)
+		}
+		if tags == nil {
+			tags = map[string]string{}
+		}
+		tags[name] = values[0]
+		return nil
+	}
+	if header := r.Header.Get(tagsHeader); header != "" {
+		values, err := url.ParseQuery(header)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s header", tagsHeader)
+		}
+		for name, v := range values {
+			if err := set(name, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for key, values := range r.URL.Query() {
+		if name, ok := strings.CutPrefix(key, tagParamPrefix); ok {
+			if err := set(name, values); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s3.ValidateTags(tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/haithamswe/multi-protocol-upload-api/requestid"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/haithamswe/multi-protocol-upload-api/handlers"
+
+// WithTracerProvider overrides the global tracer provider, mostly useful in tests.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(h *handlers) {
+		h.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// startSpan continues the trace of an incoming W3C traceparent header, if any, with a server span
+// for the request and returns the request carrying the span's context.
+func (h handlers) startSpan(r *http.Request, name string) (*http.Request, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := h.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.HTTPRoute(r.URL.Path),
+		),
+	)
+	if id := requestid.FromContext(ctx); id != "" {
+		span.SetAttributes(attribute.String("request.id", id))
+	}
+	return r.WithContext(ctx), span
+}
+
+func endSpan(span trace.Span, status int) {
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	// Client errors are the caller's problem and do not mark a server span as failed.
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// endStep ends a span covering one step of a request, marking it as failed when the step returned an error.
+func endStep(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
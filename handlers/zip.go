@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/haithamswe/multi-protocol-upload-api/apierror"
+	"github.com/haithamswe/multi-protocol-upload-api/archive"
+	"github.com/haithamswe/multi-protocol-upload-api/catalog"
+	"github.com/haithamswe/multi-protocol-upload-api/logging"
+	"github.com/haithamswe/multi-protocol-upload-api/objectkey"
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+)
+
+const (
+	// maxZipObjects bounds how many objects one zip download may contain.
+	maxZipObjects = 1000
+	// maxZipScan bounds how many listed keys a prefix download checks when there is no catalog to
+	// list only the tenant's objects.
+	maxZipScan = 10 * maxZipObjects
+	// zipHeadConcurrency bounds the HEAD requests one zip download runs at a time.
+	zipHeadConcurrency = 16
+)
+
+var (
+	errTooManyObjects = fmt.Errorf("a zip download may contain at most %d objects", maxZipObjects)
+	errTooManyKeys    = fmt.Errorf("the prefix matches more than %d objects to check, use a longer prefix", maxZipScan)
+)
+
+// DownloadZip streams a zip archive of the objects listed in objectKey parameters, or of the
+// objects under a prefix. Entries are written as the objects are read from storage, so the
+// archive is never held in memory.
+func (h handlers) DownloadZip(w http.ResponseWriter, r *http.Request) {
+	r, span := h.startSpan(r, "DownloadZip")
+	sw := &statusWriter{ResponseWriter: w}
+	w = sw
+	defer func() {
+		endSpan(span, sw.Status())
+	}()
+
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.New(apierror.KindMethodNotAllowed, "Method Not Allowed"))
+		return
+	}
+	query := r.URL.Query()
+	keys, prefix := query["objectKey"], query.Get("prefix")
+	if (len(keys) == 0) == (prefix == "") {
+		apierror.Write(w, r, apierror.New(apierror.KindValidation, "Expected either objectKey or prefix parameters"))
+		return
+	}
+	if len(keys) > maxZipObjects {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, errTooManyObjects.Error(), errTooManyObjects))
+		return
+	}
+	r, err := withCustomerKey(r)
+	if err != nil {
+		apierror.Write(w, r, apierror.Wrap(apierror.KindValidation, err.Error(), err))
+		return
+	}
+
+	tenant := r.Header.Get(tenantHeader)
+	var objects []s3.ObjectInfo
+	if prefix != "" {
+		logging.AddAttrs(r.Context(), slog.String("prefix", prefix))
+		objects, err = h.listZipObjects(r.Context(), prefix, tenant)
+	} else {
+		objects, err = h.headZipObjects(r.Context(), keys, tenant)
+	}
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if len(objects) == 0 {
+		apierror.Write(w, r, apierror.New(apierror.KindNotFound, "no objects found"))
+		return
+	}
+
+	fileName := query.Get("filename")
+	if fileName == "" {
+		fileName = "download.zip"
+		if prefix != "" {
+			fileName = objectkey.SanitizeFileName(path.Base(strings.TrimSuffix(prefix, "/"))) + ".zip"
+		}
+	}
+	header := w.Header()
+	header.Set("Content-Type", "application/zip")
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	w.WriteHeader(http.StatusOK)
+
+	// Once the status is sent, failures can only cut the archive short. It then lacks its
+	// central directory, so clients cannot mistake it for a complete one.
+	zw := zip.NewWriter(w)
+	for _, object := range objects {
+		if err := h.writeZipEntry(r.Context(), zw, zipEntryName(object.Key, prefix), object.Key); err != nil {
+			slog.ErrorContext(r.Context(), "Zip download ended early", "object_key", object.Key, "error", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		slog.ErrorContext(r.Context(), "Zip download ended early", "error", err)
+		return
+	}
+	logging.AddAttrs(r.Context(), slog.Int("objects", len(objects)))
+}
+
+// headZipObjects checks that every listed object exists and belongs to tenant before the
+// archive is started, so a bad key fails the request instead of truncating the archive.
+func (h handlers) headZipObjects(ctx context.Context, keys []string, tenant string) ([]s3.ObjectInfo, error) {
+	var unique []string
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	infos, errs := h.headObjects(ctx, unique)
+	for i, key := range unique {
+		if errs[i] != nil {
+			return nil, storageError(errs[i])
+		}
+		if infos[i].Tenant() != tenant {
+			return nil, apierror.New(apierror.KindNotFound, "object not found: "+key)
+		}
+	}
+	return infos, nil
+}
+
+// listZipObjects returns the objects under prefix that belong to tenant. The catalog lists only
+// the tenant's objects; a bucket listing includes those of other tenants, which are told apart
+// with HEAD requests and never count towards the limit. Objects that cannot be read, such as
+// SSE-C objects encrypted with another key, are left out.
+func (h handlers) listZipObjects(ctx context.Context, prefix, tenant string) ([]s3.ObjectInfo, error) {
+	keys, err := h.zipKeys(ctx, prefix, tenant)
+	if errors.Is(err, errTooManyObjects) || errors.Is(err, errTooManyKeys) {
+		return nil, apierror.Wrap(apierror.KindValidation, err.Error(), err)
+	}
+	if err != nil {
+		return nil, storageError(err)
+	}
+	infos, errs := h.headObjects(ctx, keys)
+	var objects []s3.ObjectInfo
+	skipped := 0
+	for i, info := range infos {
+		switch {
+		case errs[i] != nil && !unreadable(errs[i]):
+			return nil, storageError(errs[i])
+		case errs[i] != nil:
+			skipped++
+		case info.Tenant() == tenant:
+			objects = append(objects, info)
+		}
+	}
+	if len(objects) > maxZipObjects {
+		return nil, apierror.Wrap(apierror.KindValidation, errTooManyObjects.Error(), errTooManyObjects)
+	}
+	if skipped > 0 {
+		logging.AddAttrs(ctx, slog.Int("skipped_objects", skipped))
+	}
+	return objects, nil
+}
+
+// zipKeys lists the keys under prefix, from the catalog when there is one.
+func (h handlers) zipKeys(ctx context.Context, prefix, tenant string) ([]string, error) {
+	var keys []string
+	if h.catalog != nil {
+		query := catalog.Query{Tenant: tenant, Prefix: prefix, Limit: catalog.MaxPageSize}
+		for {
+			page, err := h.catalog.List(ctx, query)
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range page.Records {
+				keys = append(keys, record.Key)
+			}
+			if len(keys) > maxZipObjects {
+				return nil, errTooManyObjects
+			}
+			if page.NextCursor == "" {
+				return keys, nil
+			}
+			query.Cursor = page.NextCursor
+		}
+	}
+	err := h.s3Client.ListObjects(ctx, prefix, func(info s3.ObjectInfo) error {
+		if len(keys) == maxZipScan {
+			return errTooManyKeys
+		}
+		keys = append(keys, info.Key)
+		return nil
+	})
+	return keys, err
+}
+
+// headObjects runs up to zipHeadConcurrency HEAD requests at a time and returns their results in
+// the order of keys.
+func (h handlers) headObjects(ctx context.Context, keys []string) ([]s3.ObjectInfo, []error) {
+	infos := make([]s3.ObjectInfo, len(keys))
+	errs := make([]error, len(keys))
+	sem := make(chan struct{}, zipHeadConcurrency)
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			infos[i], errs[i] = h.s3Client.HeadObject(ctx, key)
+		}()
+	}
+	wg.Wait()
+	return infos, errs
+}
+
+// unreadable reports whether a HEAD request failed for the object rather than for storage: it was
+// deleted since it was listed, or is an SSE-C object the request has no key for.
+func unreadable(err error) bool {
+	var s3Err *s3.Error
+	if !errors.As(err, &s3Err) {
+		return false
+	}
+	switch s3Err.StatusCode {
+	case http.StatusNotFound, http.StatusBadRequest, http.StatusForbidden:
+		return true
+	}
+	return false
+}
+
+// zipEntryName names an object within the archive: its key, relative to prefix when there is
+// one. Keys that would escape the archive's directory are reduced to a plain file name.
+func zipEntryName(key, prefix string) string {
+	name := strings.TrimPrefix(key, prefix)
+	if name == "" {
+		name = key
+	}
+	clean, err := archive.CleanName(name)
+	if err != nil {
+		return objectkey.SanitizeFileName(name)
+	}
+	return clean
+}
+
+func (h handlers) writeZipEntry(ctx context.Context, zw *zip.Writer, name, key string) error {
+	body, info, err := h.s3Client.GetObject(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	content, err := h.openContent(body, info)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: info.LastModified})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, content)
+	return err
+}
@@ -0,0 +1,98 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// Check reports whether a dependency the service needs is reachable.
+type Check func(ctx context.Context) error
+
+type Health interface {
+	// Healthz reports liveness: the process is up and serving HTTP.
+	Healthz(w http.ResponseWriter, r *http.Request)
+	// Readyz reports whether the instance should receive traffic.
+	Readyz(w http.ResponseWriter, r *http.Request)
+	// Drain makes Readyz fail so load balancers stop routing new requests during shutdown.
+	Drain()
+}
+
+type health struct {
+	checks   map[string]Check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func (h *health) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, http.StatusOK, response{Status: StatusOK})
+}
+
+func (h *health) Readyz(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		writeResponse(w, http.StatusServiceUnavailable, response{Status: StatusDraining})
+		return
+	}
+
+	ctx := r.Context()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp := response{Status: StatusOK, Checks: map[string]string{}}
+	for _, name := range names {
+		if err := h.checks[name](ctx); err != nil {
+			// Errors can name buckets and hosts, so they are logged rather than shown to callers.
+			slog.WarnContext(ctx, "Readiness check failed", "check", name, "error", err)
+			resp.Status = StatusUnavailable
+			resp.Checks[name] = StatusUnavailable
+			continue
+		}
+		resp.Checks[name] = StatusOK
+	}
+
+	status := http.StatusOK
+	if resp.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeResponse(w, status, resp)
+}
+
+func (h *health) Drain() {
+	h.draining.Store(true)
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// NewHealth runs checks on every readiness probe. Together they must finish within timeout.
+func NewHealth(checks map[string]Check, timeout time.Duration) Health {
+	return &health{checks: checks, timeout: timeout}
+}
@@ -0,0 +1,76 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthz(t *testing.T) {
+	h := health.NewHealth(map[string]health.Check{
+		"s3": func(context.Context) error { return errors.New("unreachable") },
+	}, time.Second)
+	h.Drain()
+
+	rec := httptest.NewRecorder()
+	h.Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name           string
+		checkErr       error
+		drain          bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Ready", expectedStatus: http.StatusOK, expectedBody: `{"status":"ok","checks":{"s3":"ok"}}`},
+		{name: "Dependency down", checkErr: errors.New("error from S3, status code: 403"), expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: `{"status":"unavailable","checks":{"s3":"unavailable"}}`},
+		{name: "Draining", drain: true, expectedStatus: http.StatusServiceUnavailable, expectedBody: `{"status":"draining"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := health.NewHealth(map[string]health.Check{
+				"s3": func(context.Context) error { return tt.checkErr },
+			}, time.Second)
+			if tt.drain {
+				h.Drain()
+			}
+
+			rec := httptest.NewRecorder()
+			h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.JSONEq(t, tt.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestReadyz_Timeout(t *testing.T) {
+	h := health.NewHealth(map[string]health.Check{
+		"s3": func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}, 10*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var body map[string]any
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, "unavailable", body["status"])
+}
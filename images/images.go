@@ -0,0 +1,262 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+type Format string
+
+const (
+	JPEG Format = "jpeg"
+	PNG  Format = "png"
+	WebP Format = "webp"
+)
+
+// ContentType returns the media type of images encoded in f.
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// Extension returns the file extension for f, without the dot.
+func (f Format) Extension() string {
+	if f == JPEG {
+		return "jpg"
+	}
+	return string(f)
+}
+
+// DefaultPrefix is the key prefix under which derivatives are stored.
+const DefaultPrefix = "derivatives/"
+
+const (
+	// DefaultMaxPixels bounds the size of images that are decoded, so small files that expand
+	// to huge images are rejected before their pixels are allocated.
+	DefaultMaxPixels = 50_000_000
+
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported image format")
+	ErrTooLarge    = errors.New("image is too large")
+	ErrInvalid     = errors.New("invalid image")
+)
+
+// Supported reports whether derivatives can be rendered from images of contentType.
+func Supported(contentType string) bool {
+	_, ok := sourceFormat(contentType)
+	return ok
+}
+
+func sourceFormat(contentType string) (Format, bool) {
+	base, _, _ := mime.ParseMediaType(contentType)
+	switch base {
+	case "image/jpeg":
+		return JPEG, true
+	case "image/png", "image/gif":
+		return PNG, true
+	case "image/webp":
+		return WebP, true
+	}
+	return "", false
+}
+
+// Derivative describes an image rendered from an upload. The image is scaled down to fit within
+// Width x Height, keeping its aspect ratio. A zero Width or Height leaves that side unbounded.
+type Derivative struct {
+	Name   string
+	Width  int
+	Height int
+	// Format defaults to the format of the original; GIFs become PNGs.
+	Format Format
+}
+
+var derivativeName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ParseDerivatives reads a comma separated list such as "thumb=200x200:webp,large=1600x0".
+func ParseDerivatives(spec string) ([]Derivative, error) {
+	var derivatives []Derivative
+	seen := map[string]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(item, "=")
+		if !ok || !derivativeName.MatchString(name) || seen[name] {
+			return nil, fmt.Errorf("invalid derivative %q, expected a unique lowercase name=<width>x<height>[:format]", item)
+		}
+		seen[name] = true
+		size, format, _ := strings.Cut(rest, ":")
+		d := Derivative{Name: name, Format: Format(strings.ToLower(format))}
+		w, h, ok := strings.Cut(size, "x")
+		var errW, errH error
+		d.Width, errW = strconv.Atoi(w)
+		d.Height, errH = strconv.Atoi(h)
+		if !ok || errW != nil || errH != nil || d.Width < 0 || d.Height < 0 || d.Width+d.Height == 0 {
+			return nil, fmt.Errorf("invalid derivative size %q, expected <width>x<height>", size)
+		}
+		switch d.Format {
+		case "", JPEG, PNG, WebP:
+		default:
+			return nil, fmt.Errorf("invalid derivative format %q, expected jpeg, png or webp", format)
+		}
+		derivatives = append(derivatives, d)
+	}
+	return derivatives, nil
+}
+
+type Rendition struct {
+	Derivative
+	Data []byte
+}
+
+type Processor interface {
+	// Render produces every configured derivative of an image. EXIF orientation is applied, so
+	// derivatives are upright without metadata of their own.
+	Render(data []byte, contentType string) ([]Rendition, error)
+}
+
+type processor struct {
+	derivatives []Derivative
+	maxPixels   int64
+}
+
+func (p *processor) Render(data []byte, contentType string) ([]Rendition, error) {
+	original, ok := sourceFormat(contentType)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, contentType)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if int64(config.Width)*int64(config.Height) > p.maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d exceeds %d pixels", ErrTooLarge, config.Width, config.Height, p.maxPixels)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	orient := 1
+	if original == JPEG {
+		orient = orientation(data)
+	}
+
+	renditions := make([]Rendition, 0, len(p.derivatives))
+	for _, d := range p.derivatives {
+		if d.Format == "" {
+			d.Format = original
+		}
+		img := resize(src, d.Width, d.Height, orient)
+		var buf bytes.Buffer
+		switch d.Format {
+		case JPEG:
+			err = jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: jpegQuality})
+		case PNG:
+			err = png.Encode(&buf, img)
+		case WebP:
+			err = encodeWebP(&buf, img)
+		}
+		if err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, Rendition{Derivative: d, Data: buf.Bytes()})
+	}
+	return renditions, nil
+}
+
+// resize scales src to fit within maxWidth x maxHeight once orient is applied, and applies it.
+// Images are never scaled up.
+func resize(src image.Image, maxWidth, maxHeight, orient int) *image.NRGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if orient >= 5 {
+		// The image is displayed rotated by 90 degrees.
+		w, h = h, w
+	}
+	scale := 1.0
+	if maxWidth > 0 && w > maxWidth {
+		scale = float64(maxWidth) / float64(w)
+	}
+	if maxHeight > 0 && float64(h)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(h)
+	}
+	w, h = max(1, int(float64(w)*scale+0.5)), max(1, int(float64(h)*scale+0.5))
+	if orient >= 5 {
+		w, h = h, w
+	}
+	scaled := image.NewNRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), src, src.Bounds(), xdraw.Src, nil)
+	return applyOrientation(scaled, orient)
+}
+
+// applyOrientation turns an image stored with EXIF orientation orient upright.
+func applyOrientation(src *image.NRGBA, orient int) *image.NRGBA {
+	if orient < 2 || orient > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orient >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orient {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.SetNRGBA(x, y, src.NRGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
+
+// flatten composites transparent images onto white, since JPEG has no alpha channel.
+func flatten(img *image.NRGBA) image.Image {
+	if img.Opaque() {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+// NewProcessor renders derivatives of images with at most maxPixels pixels, DefaultMaxPixels
+// when zero.
+func NewProcessor(derivatives []Derivative, maxPixels int64) Processor {
+	if maxPixels <= 0 {
+		maxPixels = DefaultMaxPixels
+	}
+	return &processor{derivatives: derivatives, maxPixels: maxPixels}
+}
@@ -0,0 +1,192 @@
+package images_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/images"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/webp"
+)
+
+// newImage returns a w x h image whose left half is red and right half is blue.
+func newImage(w, h int, alpha uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: 255, A: alpha}
+			if x >= w/2 {
+				c = color.NRGBA{B: 255, A: alpha}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, nil))
+	return buf.Bytes()
+}
+
+// exifSegment returns an APP1 segment with an orientation and a GPS IFD pointer.
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 2)
+	tiff = append(tiff, 0x12, 0x01, 3, 0, 1, 0, 0, 0, byte(orientation), 0, 0, 0)
+	tiff = append(tiff, 0x25, 0x88, 4, 0, 1, 0, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, 0, 0, 0, 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xff, 0xe1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// withSegments inserts segments after a JPEG's start of image.
+func withSegments(data []byte, segments ...[]byte) []byte {
+	out := append([]byte{}, data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+func TestParseDerivatives(t *testing.T) {
+	derivatives, err := images.ParseDerivatives("thumb=200x200:webp, large=1600x0")
+	assert.NoError(t, err)
+	assert.Equal(t, []images.Derivative{
+		{Name: "thumb", Width: 200, Height: 200, Format: images.WebP},
+		{Name: "large", Width: 1600},
+	}, derivatives)
+
+	for _, spec := range []string{"thumb", "thumb=200", "thumb=0x0", "thumb=axb", "thumb=1x1:gif", "Thumb=1x1", "a=1x1,a=2x2", "../x=1x1"} {
+		_, err := images.ParseDerivatives(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestRender(t *testing.T) {
+	derivatives := []images.Derivative{
+		{Name: "thumb", Width: 40, Height: 40, Format: images.WebP},
+		{Name: "wide", Width: 50, Format: images.JPEG},
+		{Name: "same", Width: 1000, Height: 1000},
+	}
+	p := images.NewProcessor(derivatives, 0)
+
+	renditions, err := p.Render(encodeJPEG(t, newImage(200, 100, 255)), "image/jpeg")
+
+	assert.NoError(t, err)
+	assert.Len(t, renditions, 3)
+	thumb, err := webp.Decode(bytes.NewReader(renditions[0].Data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 40, 20), thumb.Bounds())
+	wide, err := jpeg.Decode(bytes.NewReader(renditions[1].Data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 50, 25), wide.Bounds())
+	// Images are never scaled up, and keep their format by default.
+	assert.Equal(t, images.JPEG, renditions[2].Format)
+	same, err := jpeg.Decode(bytes.NewReader(renditions[2].Data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 200, 100), same.Bounds())
+}
+
+func TestRender_Orientation(t *testing.T) {
+	// Orientation 6 means the stored image is displayed rotated clockwise.
+	data := withSegments(encodeJPEG(t, newImage(200, 100, 255)), exifSegment(6))
+	p := images.NewProcessor([]images.Derivative{{Name: "thumb", Width: 50, Height: 50, Format: images.PNG}}, 0)
+
+	renditions, err := p.Render(data, "image/jpeg")
+
+	assert.NoError(t, err)
+	thumb, err := png.Decode(bytes.NewReader(renditions[0].Data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 25, 50), thumb.Bounds())
+	// The red left half ends up on top.
+	r, _, b, _ := thumb.At(12, 5).RGBA()
+	assert.Greater(t, r, b)
+	r, _, b, _ = thumb.At(12, 45).RGBA()
+	assert.Greater(t, b, r)
+}
+
+func TestRender_Limits(t *testing.T) {
+	p := images.NewProcessor([]images.Derivative{{Name: "thumb", Width: 10}}, 100)
+
+	_, err := p.Render(encodeJPEG(t, newImage(20, 20, 255)), "image/jpeg")
+	assert.ErrorIs(t, err, images.ErrTooLarge)
+	_, err = p.Render([]byte("not an image"), "image/png")
+	assert.ErrorIs(t, err, images.ErrInvalid)
+	_, err = p.Render([]byte("%PDF"), "application/pdf")
+	assert.ErrorIs(t, err, images.ErrUnsupported)
+	assert.False(t, images.Supported("image/tiff"))
+	assert.True(t, images.Supported("image/gif"))
+}
+
+func TestStripMetadata_JPEG(t *testing.T) {
+	comment := []byte{0xff, 0xfe, 0, 7, 'h', 'e', 'l', 'l', 'o'}
+	data := withSegments(encodeJPEG(t, newImage(8, 8, 255)), exifSegment(6), comment)
+
+	stripped, err := images.StripMetadata(data, "image/jpeg")
+
+	assert.NoError(t, err)
+	assert.NotContains(t, string(stripped), "hello")
+	assert.NotContains(t, string(stripped), "\x25\x88", "the GPS pointer is removed")
+	assert.Less(t, len(stripped), len(data))
+	// The orientation is kept so the image still renders upright.
+	p := images.NewProcessor([]images.Derivative{{Name: "copy", Width: 100, Format: images.PNG}}, 0)
+	renditions, err := p.Render(stripped, "image/jpeg")
+	assert.NoError(t, err)
+	config, err := png.DecodeConfig(bytes.NewReader(renditions[0].Data))
+	assert.NoError(t, err)
+	assert.Equal(t, 8, config.Width)
+	_, err = jpeg.Decode(bytes.NewReader(stripped))
+	assert.NoError(t, err)
+
+	// Without an orientation nothing is added back.
+	plain := encodeJPEG(t, newImage(8, 8, 255))
+	stripped, err = images.StripMetadata(withSegments(plain, comment), "image/jpeg")
+	assert.NoError(t, err)
+	assert.Equal(t, plain, stripped)
+}
+
+func TestStripMetadata_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, newImage(4, 4, 255)))
+	data := buf.Bytes()
+	text := []byte("\x00\x00\x00\x0atEXtAuthor\x00Zoe\x00\x00\x00\x00")
+	// Insert the text chunk after IHDR, which is 8 + 25 bytes into the file.
+	withText := append(append(append([]byte{}, data[:33]...), text...), data[33:]...)
+
+	stripped, err := images.StripMetadata(withText, "image/png")
+
+	assert.NoError(t, err)
+	assert.Equal(t, data, stripped)
+}
+
+func TestStripMetadata_WebP(t *testing.T) {
+	p := images.NewProcessor([]images.Derivative{{Name: "copy", Width: 10, Format: images.WebP}}, 0)
+	renditions, err := p.Render(encodeJPEG(t, newImage(4, 4, 255)), "image/jpeg")
+	assert.NoError(t, err)
+	vp8l := renditions[0].Data[12:]
+	vp8x := []byte("VP8X\x0a\x00\x00\x00\x08\x00\x00\x00\x03\x00\x00\x03\x00\x00")
+	exif := []byte("EXIF\x03\x00\x00\x00GPS\x00")
+	data := append(append(append([]byte("RIFF\x00\x00\x00\x00WEBP"), vp8x...), vp8l...), exif...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+
+	stripped, err := images.StripMetadata(data, "image/webp")
+
+	assert.NoError(t, err)
+	assert.NotContains(t, string(stripped), "GPS")
+	assert.Equal(t, byte(0), stripped[20], "the EXIF flag is cleared")
+	assert.Equal(t, uint32(len(stripped)-8), binary.LittleEndian.Uint32(stripped[4:]))
+
+	_, err = images.StripMetadata(data, "image/gif")
+	assert.ErrorIs(t, err, images.ErrUnsupported)
+	_, err = images.StripMetadata([]byte("junk"), "image/jpeg")
+	assert.ErrorIs(t, err, images.ErrInvalid)
+}
@@ -0,0 +1,201 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"mime"
+)
+
+const orientationTag = 0x0112
+
+var (
+	exifHeader    = []byte("Exif\x00\x00")
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	droppedChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+)
+
+// StripMetadata removes EXIF, XMP, IPTC and comments from JPEG, PNG and WebP images without
+// re-encoding them. A JPEG's orientation is kept, so the image is still displayed upright.
+func StripMetadata(data []byte, contentType string) ([]byte, error) {
+	base, _, _ := mime.ParseMediaType(contentType)
+	switch base {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	}
+	return nil, fmt.Errorf("%w: metadata can only be stripped from JPEG, PNG and WebP images", ErrUnsupported)
+}
+
+// jpegSegments calls fn with the marker and payload of each segment before the image data, and
+// returns the offset where the image data starts.
+func jpegSegments(data []byte, fn func(marker byte, payload []byte)) (int, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 0, fmt.Errorf("%w: missing JPEG start of image", ErrInvalid)
+	}
+	for i := 2; ; {
+		if i+4 > len(data) || data[i] != 0xff {
+			return 0, fmt.Errorf("%w: malformed JPEG segment", ErrInvalid)
+		}
+		marker := data[i+1]
+		if marker == 0xda {
+			return i, nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 0, fmt.Errorf("%w: truncated JPEG segment", ErrInvalid)
+		}
+		fn(marker, data[i+4:i+2+length])
+		i += 2 + length
+	}
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	orient := orientation(data)
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	first := true
+	start, err := jpegSegments(data, func(marker byte, payload []byte) {
+		// The orientation goes straight after the start of image, or after JFIF, which must
+		// come first.
+		if first && orient != 1 && marker != 0xe0 {
+			writeSegment(out, 0xe1, orientationExif(orient))
+		}
+		switch marker {
+		case 0xe1, 0xed, 0xfe:
+			// EXIF, XMP, IPTC and comments.
+		default:
+			writeSegment(out, marker, payload)
+		}
+		if first && orient != 1 && marker == 0xe0 {
+			writeSegment(out, 0xe1, orientationExif(orient))
+		}
+		first = false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(out.Bytes(), data[start:]...), nil
+}
+
+func writeSegment(out *bytes.Buffer, marker byte, payload []byte) {
+	out.Write([]byte{0xff, marker})
+	binary.Write(out, binary.BigEndian, uint16(len(payload)+2))
+	out.Write(payload)
+}
+
+// orientationExif builds an EXIF payload holding nothing but an orientation.
+func orientationExif(orient int) []byte {
+	b := append([]byte{}, exifHeader...)
+	b = append(b, "MM\x00\x2a\x00\x00\x00\x08"...)
+	b = binary.BigEndian.AppendUint16(b, 1)
+	b = binary.BigEndian.AppendUint16(b, orientationTag)
+	b = binary.BigEndian.AppendUint16(b, 3)
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(orient))
+	b = append(b, 0, 0)
+	return binary.BigEndian.AppendUint32(b, 0)
+}
+
+// orientation returns a JPEG's EXIF orientation, 1 when it has none.
+func orientation(data []byte) int {
+	orient := 1
+	jpegSegments(data, func(marker byte, payload []byte) {
+		if marker == 0xe1 && bytes.HasPrefix(payload, exifHeader) {
+			orient = exifOrientation(payload[len(exifHeader):])
+		}
+	})
+	return orient
+}
+
+// exifOrientation reads the orientation tag from the first IFD of TIFF encoded EXIF data.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == orientationTag && order.Uint16(tiff[entry+2:]) == 3 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("%w: missing PNG signature", ErrInvalid)
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, fmt.Errorf("%w: truncated PNG chunk", ErrInvalid)
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i {
+			return nil, fmt.Errorf("%w: truncated PNG chunk", ErrInvalid)
+		}
+		if !droppedChunks[string(data[i+4:i+8])] {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return out.Bytes(), nil
+}
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("%w: missing WebP header", ErrInvalid)
+	}
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, fmt.Errorf("%w: truncated WebP chunk", ErrInvalid)
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size&1
+		if end > len(data) || end < i {
+			return nil, fmt.Errorf("%w: truncated WebP chunk", ErrInvalid)
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte{}, data[i:end]...)
+			if size > 0 {
+				// Clear the EXIF and XMP flags.
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
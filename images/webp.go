@@ -0,0 +1,287 @@
+package images
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math/bits"
+)
+
+// The WebP lossless (VP8L) format is described in RFC 9649.
+const (
+	vp8lSignature   = 0x2f
+	vp8lMaxSize     = 1 << 14
+	greenAlphabet   = 256 + 24
+	colorAlphabet   = 256
+	distAlphabet    = 40
+	maxCodeLength   = 15
+	maxLengthLength = 7
+)
+
+// codeLengthOrder is the order in which the lengths of the code length code are sent.
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// encodeWebP writes img as a lossless WebP. Every pixel is coded as a literal with a single set
+// of prefix codes. That gives up the format's transforms and backward references, but keeps the
+// encoder small and still suits derivatives, which are small images.
+func encodeWebP(w io.Writer, img *image.NRGBA) error {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if width > vp8lMaxSize || height > vp8lMaxSize {
+		return fmt.Errorf("%w: WebP images are at most %d pixels wide and high", ErrTooLarge, vp8lMaxSize)
+	}
+
+	green, red, blue, alpha := make([]int, greenAlphabet), make([]int, colorAlphabet), make([]int, colorAlphabet), make([]int, colorAlphabet)
+	pixels := func(fn func(r, g, b, a byte)) {
+		for y := 0; y < height; y++ {
+			row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+			for x := 0; x < len(row); x += 4 {
+				fn(row[x], row[x+1], row[x+2], row[x+3])
+			}
+		}
+	}
+	pixels(func(r, g, b, a byte) {
+		red[r]++
+		green[g]++
+		blue[b]++
+		alpha[a]++
+	})
+
+	bw := &bitWriter{}
+	bw.writeBits(vp8lSignature, 8)
+	bw.writeBits(uint64(width-1), 14)
+	bw.writeBits(uint64(height-1), 14)
+	if alpha[0xff] == width*height {
+		bw.writeBits(0, 1)
+	} else {
+		bw.writeBits(1, 1)
+	}
+	bw.writeBits(0, 3) // version
+	bw.writeBits(0, 1) // no transforms
+	bw.writeBits(0, 1) // no color cache
+	bw.writeBits(0, 1) // one group of prefix codes for the whole image
+
+	greenCode := writePrefixCode(bw, green)
+	redCode := writePrefixCode(bw, red)
+	blueCode := writePrefixCode(bw, blue)
+	alphaCode := writePrefixCode(bw, alpha)
+	writePrefixCode(bw, make([]int, distAlphabet))
+	pixels(func(r, g, b, a byte) {
+		greenCode.write(bw, int(g))
+		redCode.write(bw, int(r))
+		blueCode.write(bw, int(b))
+		alphaCode.write(bw, int(a))
+	})
+	data := bw.bytes()
+
+	padding := len(data) & 1
+	header := make([]byte, 0, 20)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(12+len(data)+padding))
+	header = append(header, "WEBPVP8L"...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if padding == 1 {
+		data = append(data, 0)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nBits uint
+}
+
+// writeBits appends the n low bits of v, least significant first.
+func (b *bitWriter) writeBits(v uint64, n uint) {
+	b.acc |= v << b.nBits
+	b.nBits += n
+	for b.nBits >= 8 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc >>= 8
+		b.nBits -= 8
+	}
+}
+
+func (b *bitWriter) bytes() []byte {
+	if b.nBits > 0 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc, b.nBits = 0, 0
+	}
+	return b.buf
+}
+
+type prefixCode struct {
+	lengths []uint8
+	// codes are bit reversed, since they are read starting from their most significant bit.
+	codes []uint16
+	// single is set when only one symbol is used. Decoders read no bits for it.
+	single bool
+}
+
+func (c prefixCode) write(bw *bitWriter, symbol int) {
+	if !c.single {
+		bw.writeBits(uint64(c.codes[symbol]), uint(c.lengths[symbol]))
+	}
+}
+
+// writePrefixCode writes a prefix code for symbols occurring counts times, and returns it.
+func writePrefixCode(bw *bitWriter, counts []int) prefixCode {
+	var used []int
+	for symbol, count := range counts {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) == 0 {
+		used = []int{0}
+	}
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		// A simple code: the symbols are sent directly, and get one bit each when there are two.
+		bw.writeBits(1, 1)
+		bw.writeBits(uint64(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.writeBits(0, 1)
+			bw.writeBits(uint64(used[0]), 1)
+		} else {
+			bw.writeBits(1, 1)
+			bw.writeBits(uint64(used[0]), 8)
+		}
+		lengths := make([]uint8, len(counts))
+		for _, symbol := range used {
+			lengths[symbol] = 1
+		}
+		if len(used) == 2 {
+			bw.writeBits(uint64(used[1]), 8)
+		}
+		return canonicalCode(lengths)
+	}
+
+	lengths := codeLengths(counts, maxCodeLength)
+	lengthCounts := make([]int, len(codeLengthOrder))
+	for _, length := range lengths {
+		lengthCounts[length]++
+	}
+	lengthLengths := codeLengths(lengthCounts, maxLengthLength)
+	n := len(codeLengthOrder)
+	for n > 4 && lengthLengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.writeBits(0, 1)
+	bw.writeBits(uint64(n-4), 4)
+	for _, symbol := range codeLengthOrder[:n] {
+		bw.writeBits(uint64(lengthLengths[symbol]), 3)
+	}
+	bw.writeBits(0, 1) // a length follows for every symbol
+	lengthCode := canonicalCode(lengthLengths)
+	for _, length := range lengths {
+		lengthCode.write(bw, int(length))
+	}
+	return canonicalCode(lengths)
+}
+
+// canonicalCode assigns codes to symbols in order of length, then symbol, as decoders expect.
+func canonicalCode(lengths []uint8) prefixCode {
+	var lengthCounts [maxCodeLength + 1]int
+	used := 0
+	for _, length := range lengths {
+		if length > 0 {
+			lengthCounts[length]++
+			used++
+		}
+	}
+	var next [maxCodeLength + 1]uint16
+	code := uint16(0)
+	for length := 1; length <= maxCodeLength; length++ {
+		code = (code + uint16(lengthCounts[length-1])) << 1
+		next[length] = code
+	}
+	c := prefixCode{lengths: lengths, codes: make([]uint16, len(lengths)), single: used == 1}
+	for symbol, length := range lengths {
+		if length > 0 {
+			c.codes[symbol] = bits.Reverse16(next[length]) >> (16 - length)
+			next[length]++
+		}
+	}
+	return c
+}
+
+// codeLengths returns Huffman code lengths for counts, limited to maxLength bits. When a code is
+// too long the counts are flattened until it fits.
+func codeLengths(counts []int, maxLength int) []uint8 {
+	counts = append([]int{}, counts...)
+	for {
+		lengths, longest := huffmanLengths(counts)
+		if longest <= maxLength {
+			return lengths
+		}
+		for i, count := range counts {
+			if count > 0 {
+				counts[i] = (count + 1) / 2
+			}
+		}
+	}
+}
+
+func huffmanLengths(counts []int) ([]uint8, int) {
+	lengths := make([]uint8, len(counts))
+	nodes := &nodeHeap{}
+	for symbol, count := range counts {
+		if count > 0 {
+			*nodes = append(*nodes, node{weight: count, id: symbol})
+		}
+	}
+	if nodes.Len() == 1 {
+		lengths[(*nodes)[0].id] = 1
+		return lengths, 1
+	}
+	leaves := append([]node{}, *nodes...)
+	// Leaves are identified by their symbol, and merged nodes by ids after the alphabet.
+	parent := make([]int, len(counts))
+	heap.Init(nodes)
+	for nodes.Len() > 1 {
+		a, b := heap.Pop(nodes).(node), heap.Pop(nodes).(node)
+		id := len(parent)
+		parent = append(parent, -1)
+		parent[a.id], parent[b.id] = id, id
+		heap.Push(nodes, node{weight: a.weight + b.weight, id: id})
+	}
+	longest := 0
+	for _, leaf := range leaves {
+		depth := 0
+		for id := leaf.id; parent[id] != -1; id = parent[id] {
+			depth++
+		}
+		lengths[leaf.id] = uint8(min(depth, 255))
+		longest = max(longest, depth)
+	}
+	return lengths, longest
+}
+
+type node struct {
+	weight int
+	id     int
+}
+
+type nodeHeap []node
+
+func (h nodeHeap) Len() int { return len(h) }
+func (h nodeHeap) Less(i, j int) bool {
+	if h[i].weight != h[j].weight {
+		return h[i].weight < h[j].weight
+	}
+	return h[i].id < h[j].id
+}
+func (h nodeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *nodeHeap) Push(x any)   { *h = append(*h, x.(node)) }
+func (h *nodeHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
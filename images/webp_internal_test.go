@@ -0,0 +1,66 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebP(t *testing.T) {
+	random := image.NewNRGBA(image.Rect(0, 0, 37, 23))
+	rand.New(rand.NewSource(1)).Read(random.Pix)
+	// Two colors and a single alpha value use simple prefix codes.
+	twoColors := image.NewNRGBA(image.Rect(0, 0, 5, 3))
+	for i := range twoColors.Pix {
+		twoColors.Pix[i] = 0xff
+	}
+	twoColors.Pix[0] = 0x10
+	// Fibonacci distributed values would get codes longer than the format allows.
+	skewed := image.NewNRGBA(image.Rect(0, 0, 300, 300))
+	fibonacci := fibonacciValues()
+	for i := range skewed.Pix {
+		skewed.Pix[i] = fibonacci[i%len(fibonacci)]
+	}
+	_, longest := huffmanLengths(histogram(fibonacci))
+	assert.Greater(t, longest, maxCodeLength)
+	assert.LessOrEqual(t, int(slices.Max(codeLengths(histogram(fibonacci), maxCodeLength))), maxCodeLength)
+
+	for name, img := range map[string]*image.NRGBA{"Random": random, "Two colors": twoColors, "Skewed": skewed} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, encodeWebP(&buf, img))
+
+			decoded, err := webp.Decode(&buf)
+			assert.NoError(t, err)
+			if assert.IsType(t, &image.NRGBA{}, decoded) {
+				assert.Equal(t, img.Pix, decoded.(*image.NRGBA).Pix)
+			}
+		})
+	}
+}
+
+// fibonacciValues returns values where k occurs as often as the k+1th Fibonacci number.
+func fibonacciValues() []byte {
+	var values []byte
+	a, b := 1, 1
+	for k := 0; k < 24; k++ {
+		for i := 0; i < a; i++ {
+			values = append(values, byte(k))
+		}
+		a, b = b, a+b
+	}
+	return values
+}
+
+func histogram(values []byte) []int {
+	counts := make([]int, 256)
+	for _, v := range values {
+		counts[v]++
+	}
+	return counts
+}
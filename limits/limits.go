@@ -0,0 +1,90 @@
+package limits
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTooLarge = errors.New("upload exceeds maximum allowed size")
+	ErrTooSmall = errors.New("upload is smaller than minimum allowed size")
+	ErrEmpty    = errors.New("empty uploads are not allowed")
+)
+
+type SizeLimits interface {
+	Resolve(route, tenant string) Limit
+}
+
+// Limit is the effective size policy for a single upload. A MaxBytes of zero means unlimited.
+type Limit struct {
+	MaxBytes    int64
+	MinBytes    int64
+	RejectEmpty bool
+}
+
+type sizeLimits struct {
+	maxBytes    int64
+	perTenant   map[string]int64
+	perRoute    map[string]int64
+	minBytes    int64
+	rejectEmpty bool
+}
+
+func (s sizeLimits) Resolve(route, tenant string) Limit {
+	limit := Limit{
+		MaxBytes:    s.maxBytes,
+		MinBytes:    s.minBytes,
+		RejectEmpty: s.rejectEmpty,
+	}
+	if max, ok := s.perRoute[route]; ok {
+		limit.MaxBytes = strictest(limit.MaxBytes, max)
+	}
+	if tenant != "" {
+		if max, ok := s.perTenant[tenant]; ok {
+			limit.MaxBytes = strictest(limit.MaxBytes, max)
+		}
+	}
+	return limit
+}
+
+// CheckContentLength validates the declared request size. A negative length means unknown and is
+// left to Check once the body has been read.
+func (l Limit) CheckContentLength(contentLength int64) error {
+	if contentLength < 0 {
+		return nil
+	}
+	return l.Check(contentLength)
+}
+
+func (l Limit) Check(size int64) error {
+	if l.MaxBytes > 0 && size > l.MaxBytes {
+		return fmt.Errorf("%w: %d > %d bytes", ErrTooLarge, size, l.MaxBytes)
+	}
+	if size == 0 && l.RejectEmpty {
+		return ErrEmpty
+	}
+	if size < l.MinBytes {
+		return fmt.Errorf("%w: %d < %d bytes", ErrTooSmall, size, l.MinBytes)
+	}
+	return nil
+}
+
+func strictest(current, candidate int64) int64 {
+	if candidate <= 0 {
+		return current
+	}
+	if current <= 0 || candidate < current {
+		return candidate
+	}
+	return current
+}
+
+func NewSizeLimits(maxBytes int64, perTenant, perRoute map[string]int64, minBytes int64, rejectEmpty bool) SizeLimits {
+	return &sizeLimits{
+		maxBytes:    maxBytes,
+		perTenant:   perTenant,
+		perRoute:    perRoute,
+		minBytes:    minBytes,
+		rejectEmpty: rejectEmpty,
+	}
+}
@@ -0,0 +1,59 @@
+package limits_test
+
+import (
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/limits"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	sizeLimits := limits.NewSizeLimits(
+		1000,
+		map[string]int64{"acme": 500, "globex": 5000},
+		map[string]int64{"/upload-to-s3": 800},
+		10,
+		true,
+	)
+
+	tests := []struct {
+		name     string
+		route    string
+		tenant   string
+		expected int64
+	}{
+		{name: "Global only", route: "/other", tenant: "", expected: 1000},
+		{name: "Route is stricter", route: "/upload-to-s3", tenant: "", expected: 800},
+		{name: "Tenant is strictest", route: "/upload-to-s3", tenant: "acme", expected: 500},
+		{name: "Tenant cannot raise global", route: "/other", tenant: "globex", expected: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := sizeLimits.Resolve(tt.route, tt.tenant)
+			assert.Equal(t, tt.expected, limit.MaxBytes)
+			assert.Equal(t, int64(10), limit.MinBytes)
+			assert.True(t, limit.RejectEmpty)
+		})
+	}
+}
+
+func TestResolve_Unlimited(t *testing.T) {
+	sizeLimits := limits.NewSizeLimits(0, nil, map[string]int64{"/upload-to-s3": 0}, 0, false)
+	assert.Equal(t, int64(0), sizeLimits.Resolve("/upload-to-s3", "acme").MaxBytes)
+}
+
+func TestCheck(t *testing.T) {
+	limit := limits.Limit{MaxBytes: 100, MinBytes: 10, RejectEmpty: true}
+
+	assert.NoError(t, limit.Check(50))
+	assert.ErrorIs(t, limit.Check(101), limits.ErrTooLarge)
+	assert.ErrorIs(t, limit.Check(5), limits.ErrTooSmall)
+	assert.ErrorIs(t, limit.Check(0), limits.ErrEmpty)
+	assert.NoError(t, limit.CheckContentLength(-1))
+	assert.ErrorIs(t, limit.CheckContentLength(200), limits.ErrTooLarge)
+
+	unlimited := limits.Limit{}
+	assert.NoError(t, unlimited.Check(0))
+	assert.NoError(t, unlimited.Check(1<<40))
+}
@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/metrics"
+	"github.com/haithamswe/multi-protocol-upload-api/requestid"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// New returns a JSON logger whose every attribute passes through redaction.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}))
+}
+
+// ParseLevel accepts debug, info, warn or error; an empty string means info.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+type contextKey struct{}
+
+type requestAttrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// AddAttrs attaches attributes to the access log line of the request carried by ctx. It is a no-op
+// outside of Middleware.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	ra, ok := ctx.Value(contextKey{}).(*requestAttrs)
+	if !ok {
+		return
+	}
+	ra.mu.Lock()
+	ra.attrs = append(ra.attrs, attrs...)
+	ra.mu.Unlock()
+}
+
+// Principal identifies the caller: a fingerprint of the API key when one is presented, the
+// client IP otherwise. The key itself never leaves this function.
+func Principal(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:6])
+	}
+	return "ip:" + ClientIP(r)
+}
+
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Middleware writes one access log line per request. It must run inside requestid.Middleware so
+// the line carries the request ID.
+func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ra := &requestAttrs{}
+			rw := &responseWriter{ResponseWriter: w}
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), contextKey{}, ra)))
+
+			status := rw.Status()
+			attrs := []slog.Attr{
+				slog.String("request_id", requestid.FromContext(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("query", r.URL.RawQuery),
+				slog.Int("status", status),
+				slog.String("outcome", metrics.Outcome(status)),
+				slog.Int64("bytes_written", rw.written),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("principal", Principal(r)),
+				slog.String("user_agent", r.UserAgent()),
+			}
+			ra.mu.Lock()
+			attrs = append(attrs, ra.attrs...)
+			ra.mu.Unlock()
+
+			level := slog.LevelInfo
+			if status >= 500 {
+				level = slog.LevelError
+			}
+			logger.LogAttrs(r.Context(), level, "request", attrs...)
+		})
+	}
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
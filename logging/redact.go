@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const Redacted = "REDACTED"
+
+var sensitiveHeaders = map[string]bool{
+	"authorization":        true,
+	"proxy-authorization":  true,
+	"cookie":               true,
+	"set-cookie":           true,
+	"x-api-key":            true,
+	"x-amz-security-token": true,
+	"x-amz-server-side-encryption-customer-key": true,
+}
+
+var sensitivePatterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	// Presigned URL query parameters, raw or percent-encoded.
+	{regexp.MustCompile(`(?i)(X-Amz-(?:Signature|Credential|Security-Token)(?:=|%3D))[^&\s"']*`), "${1}" + Redacted},
+	// SigV4 Authorization header values.
+	{regexp.MustCompile(`(?i)\b(Credential=|Signature=)[^,&\s"']*`), "${1}" + Redacted},
+	{regexp.MustCompile(`(?i)\b(Bearer|Basic)\s+[A-Za-z0-9._~+/=-]+`), "${1} " + Redacted},
+	// AWS access key IDs.
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`), Redacted},
+}
+
+// Redact removes signatures, credentials and tokens from s.
+func Redact(s string) string {
+	for _, p := range sensitivePatterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// RedactHeaders returns a copy of h in which credential carrying headers are replaced.
+func RedactHeaders(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for name, values := range h {
+		if sensitiveHeaders[strings.ToLower(name)] {
+			redacted[name] = []string{Redacted}
+			continue
+		}
+		redacted[name] = make([]string, len(values))
+		for i, v := range values {
+			redacted[name][i] = Redact(v)
+		}
+	}
+	return redacted
+}
+
+// redactAttr is installed as the handler's ReplaceAttr, so it sees every attribute of every log
+// line, including the message and attributes added through the standard log package.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveHeaders[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case http.Header:
+			return slog.Any(a.Key, RedactHeaders(v))
+		case *url.URL:
+			return slog.String(a.Key, Redact(v.String()))
+		case error:
+			return slog.String(a.Key, Redact(v.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, Redact(v.String()))
+		case []byte:
+			return slog.String(a.Key, Redact(string(v)))
+		}
+	}
+	return a
+}
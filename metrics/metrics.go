@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "upload_api"
+
+	OutcomeSuccess  = "success"
+	OutcomeRejected = "rejected"
+	OutcomeError    = "error"
+	OutcomeCanceled = "canceled"
+
+	noTenant    = "none"
+	otherTenant = "other"
+)
+
+type Metrics interface {
+	UploadStarted(route string) (done func())
+	ObserveUpload(route, tenant, outcome string, bytes int64, duration time.Duration)
+	ObservePresign(outcome string)
+	ObserveS3Request(operation string, statusCode int, duration time.Duration)
+	ObserveS3Retry(operation, reason string)
+	Handler() http.Handler
+}
+
+// Outcome buckets an HTTP status into the outcome label. 499 is the client-closed-request status
+// used when the caller disconnects.
+func Outcome(status int) string {
+	switch {
+	case status == 499:
+		return OutcomeCanceled
+	case status >= 500:
+		return OutcomeError
+	case status >= 400:
+		return OutcomeRejected
+	default:
+		return OutcomeSuccess
+	}
+}
+
+type prometheusMetrics struct {
+	registry        *prometheus.Registry
+	uploads         *prometheus.CounterVec
+	uploadBytes     *prometheus.CounterVec
+	uploadDuration  *prometheus.HistogramVec
+	uploadsInFlight *prometheus.GaugeVec
+	presigns        *prometheus.CounterVec
+	s3Requests      *prometheus.CounterVec
+	s3Duration      *prometheus.HistogramVec
+	s3Retries       *prometheus.CounterVec
+
+	// Tenants come from a client supplied header, so the label values are capped to keep a
+	// misbehaving client from creating unbounded series.
+	maxTenants int
+	tenantsMu  sync.Mutex
+	tenants    map[string]struct{}
+}
+
+func (m *prometheusMetrics) UploadStarted(route string) func() {
+	gauge := m.uploadsInFlight.WithLabelValues(route)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+func (m *prometheusMetrics) ObserveUpload(route, tenant, outcome string, bytes int64, duration time.Duration) {
+	tenant = m.tenantLabel(tenant)
+	m.uploads.WithLabelValues(route, tenant, outcome).Inc()
+	m.uploadDuration.WithLabelValues(route, tenant, outcome).Observe(duration.Seconds())
+	if outcome == OutcomeSuccess {
+		m.uploadBytes.WithLabelValues(route, tenant).Add(float64(bytes))
+	}
+}
+
+func (m *prometheusMetrics) ObservePresign(outcome string) {
+	m.presigns.WithLabelValues(outcome).Inc()
+}
+
+// ObserveS3Request records one attempt against S3. A statusCode of 0 means the request failed
+// before a response was received.
+func (m *prometheusMetrics) ObserveS3Request(operation string, statusCode int, duration time.Duration) {
+	status := "network_error"
+	if statusCode > 0 {
+		status = strconv.Itoa(statusCode)
+	}
+	m.s3Requests.WithLabelValues(operation, status).Inc()
+	m.s3Duration.WithLabelValues(operation, status).Observe(duration.Seconds())
+}
+
+func (m *prometheusMetrics) ObserveS3Retry(operation, reason string) {
+	m.s3Retries.WithLabelValues(operation, reason).Inc()
+}
+
+func (m *prometheusMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *prometheusMetrics) tenantLabel(tenant string) string {
+	if tenant == "" {
+		return noTenant
+	}
+	m.tenantsMu.Lock()
+	defer m.tenantsMu.Unlock()
+	if _, ok := m.tenants[tenant]; ok {
+		return tenant
+	}
+	if len(m.tenants) >= m.maxTenants {
+		return otherTenant
+	}
+	m.tenants[tenant] = struct{}{}
+	return tenant
+}
+
+func NewPrometheusMetrics(maxTenants int) Metrics {
+	m := &prometheusMetrics{
+		registry: prometheus.NewRegistry(),
+		uploads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "uploads_total",
+			Help:      "Upload requests by route, tenant and outcome.",
+		}, []string{"route", "tenant", "outcome"}),
+		uploadBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upload_bytes_total",
+			Help:      "Bytes successfully uploaded by route and tenant.",
+		}, []string{"route", "tenant"}),
+		uploadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upload_duration_seconds",
+			Help:      "End to end upload request latency.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		}, []string{"route", "tenant", "outcome"}),
+		uploadsInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "uploads_in_flight",
+			Help:      "Uploads currently being processed.",
+		}, []string{"route"}),
+		presigns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "presigns_total",
+			Help:      "Presigned URL requests by outcome.",
+		}, []string{"outcome"}),
+		s3Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "s3_requests_total",
+			Help:      "Requests sent to S3 by operation and response status, one per attempt.",
+		}, []string{"operation", "status"}),
+		s3Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "s3_request_duration_seconds",
+			Help:      "S3 upstream latency per attempt.",
+			Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"operation", "status"}),
+		s3Retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "s3_retries_total",
+			Help:      "Retried S3 requests by operation and reason.",
+		}, []string{"operation", "reason"}),
+		maxTenants: maxTenants,
+		tenants:    map[string]struct{}{},
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.uploads,
+		m.uploadBytes,
+		m.uploadDuration,
+		m.uploadsInFlight,
+		m.presigns,
+		m.s3Requests,
+		m.s3Duration,
+		m.s3Retries,
+	)
+	return m
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) UploadStarted(string) func()                                { return func() {} }
+func (noopMetrics) ObserveUpload(string, string, string, int64, time.Duration) {}
+func (noopMetrics) ObservePresign(string)                                      {}
+func (noopMetrics) ObserveS3Request(string, int, time.Duration)                {}
+func (noopMetrics) ObserveS3Retry(string, string)                              {}
+func (noopMetrics) Handler() http.Handler                                      { return http.NotFoundHandler() }
+
+func NewNoopMetrics() Metrics {
+	return noopMetrics{}
+}
@@ -0,0 +1,68 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(t *testing.T, m metrics.Metrics) string {
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := metrics.NewPrometheusMetrics(10)
+
+	done := m.UploadStarted("/upload-to-s3")
+	assert.Contains(t, scrape(t, m), `upload_api_uploads_in_flight{route="/upload-to-s3"} 1`)
+	done()
+
+	m.ObserveUpload("/upload-to-s3", "acme", metrics.OutcomeSuccess, 2048, 150*time.Millisecond)
+	m.ObserveUpload("/upload-to-s3", "", metrics.OutcomeRejected, 99999, time.Millisecond)
+	m.ObservePresign(metrics.OutcomeSuccess)
+	m.ObserveS3Request("PutObject", 503, 20*time.Millisecond)
+	m.ObserveS3Request("PutObject", 0, time.Second)
+	m.ObserveS3Retry("PutObject", "SlowDown")
+
+	output := scrape(t, m)
+	assert.Contains(t, output, `upload_api_uploads_in_flight{route="/upload-to-s3"} 0`)
+	assert.Contains(t, output, `upload_api_uploads_total{outcome="success",route="/upload-to-s3",tenant="acme"} 1`)
+	assert.Contains(t, output, `upload_api_uploads_total{outcome="rejected",route="/upload-to-s3",tenant="none"} 1`)
+	assert.Contains(t, output, `upload_api_upload_bytes_total{route="/upload-to-s3",tenant="acme"} 2048`)
+	assert.NotContains(t, output, `upload_api_upload_bytes_total{route="/upload-to-s3",tenant="none"}`)
+	assert.Contains(t, output, `upload_api_upload_duration_seconds_count{outcome="success",route="/upload-to-s3",tenant="acme"} 1`)
+	assert.Contains(t, output, `upload_api_presigns_total{outcome="success"} 1`)
+	assert.Contains(t, output, `upload_api_s3_requests_total{operation="PutObject",status="503"} 1`)
+	assert.Contains(t, output, `upload_api_s3_requests_total{operation="PutObject",status="network_error"} 1`)
+	assert.Contains(t, output, `upload_api_s3_request_duration_seconds_count{operation="PutObject",status="503"} 1`)
+	assert.Contains(t, output, `upload_api_s3_retries_total{operation="PutObject",reason="SlowDown"} 1`)
+	assert.Contains(t, output, `go_goroutines`)
+}
+
+func TestPrometheusMetrics_CapsTenantLabels(t *testing.T) {
+	m := metrics.NewPrometheusMetrics(1)
+	m.ObserveUpload("/upload-to-s3", "acme", metrics.OutcomeSuccess, 1, time.Millisecond)
+	m.ObserveUpload("/upload-to-s3", "globex", metrics.OutcomeSuccess, 1, time.Millisecond)
+	m.ObserveUpload("/upload-to-s3", "acme", metrics.OutcomeSuccess, 1, time.Millisecond)
+
+	output := scrape(t, m)
+	assert.Contains(t, output, `upload_api_uploads_total{outcome="success",route="/upload-to-s3",tenant="acme"} 2`)
+	assert.Contains(t, output, `upload_api_uploads_total{outcome="success",route="/upload-to-s3",tenant="other"} 1`)
+	assert.NotContains(t, output, `tenant="globex"`)
+}
+
+func TestOutcome(t *testing.T) {
+	assert.Equal(t, metrics.OutcomeSuccess, metrics.Outcome(http.StatusOK))
+	assert.Equal(t, metrics.OutcomeRejected, metrics.Outcome(http.StatusRequestEntityTooLarge))
+	assert.Equal(t, metrics.OutcomeError, metrics.Outcome(http.StatusServiceUnavailable))
+	assert.Equal(t, metrics.OutcomeCanceled, metrics.Outcome(499))
+}
@@ -13,11 +13,46 @@ type Handlers struct {
 	mock.Mock
 }
 
+// DeleteFromS3 provides a mock function with given fields: w, r
+func (_m *Handlers) DeleteFromS3(w http.ResponseWriter, r *http.Request) {
+	_m.Called(w, r)
+}
+
+// Download provides a mock function with given fields: w, r
+func (_m *Handlers) Download(w http.ResponseWriter, r *http.Request) {
+	_m.Called(w, r)
+}
+
+// DownloadZip provides a mock function with given fields: w, r
+func (_m *Handlers) DownloadZip(w http.ResponseWriter, r *http.Request) {
+	_m.Called(w, r)
+}
+
+// GetFile provides a mock function with given fields: w, r
+func (_m *Handlers) GetFile(w http.ResponseWriter, r *http.Request) {
+	_m.Called(w, r)
+}
+
+// GetMetadata provides a mock function with given fields: w, r
+func (_m *Handlers) GetMetadata(w http.ResponseWriter, r *http.Request) {
+	_m.Called(w, r)
+}
+
 // GetPresignedS3Url provides a mock function with given fields: w, r
 func (_m *Handlers) GetPresignedS3Url(w http.ResponseWriter, r *http.Request) {
 	_m.Called(w, r)
 }
 
+// GetUsage provides a mock function with given fields: w, r
+func (_m *Handlers) GetUsage(w http.ResponseWriter, r *http.Request) {
+	_m.Called(w, r)
+}
+
+// ListFiles provides a mock function with given fields: w, r
+func (_m *Handlers) ListFiles(w http.ResponseWriter, r *http.Request) {
+	_m.Called(w, r)
+}
+
 // UploadToS3 provides a mock function with given fields: w, r
 func (_m *Handlers) UploadToS3(w http.ResponseWriter, r *http.Request) {
 	_m.Called(w, r)
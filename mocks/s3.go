@@ -2,24 +2,180 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	context "context"
+
+	io "io"
+
+	s3 "github.com/haithamswe/multi-protocol-upload-api/s3"
+	mock "github.com/stretchr/testify/mock"
+)
 
 // S3 is an autogenerated mock type for the S3 type
 type S3 struct {
 	mock.Mock
 }
 
-// PresignUrl provides a mock function with given fields: objectKey, expires
-func (_m *S3) PresignUrl(objectKey string, expires int64) string {
-	ret := _m.Called(objectKey, expires)
+// DeleteObject provides a mock function with given fields: ctx, objectKey
+func (_m *S3) DeleteObject(ctx context.Context, objectKey string) error {
+	ret := _m.Called(ctx, objectKey)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteObject")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, objectKey)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetObject provides a mock function with given fields: ctx, objectKey
+func (_m *S3) GetObject(ctx context.Context, objectKey string) (io.ReadCloser, s3.ObjectInfo, error) {
+	ret := _m.Called(ctx, objectKey)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetObject")
+	}
+
+	var r0 io.ReadCloser
+	var r1 s3.ObjectInfo
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (io.ReadCloser, s3.ObjectInfo, error)); ok {
+		return rf(ctx, objectKey)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) io.ReadCloser); ok {
+		r0 = rf(ctx, objectKey)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(io.ReadCloser)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) s3.ObjectInfo); ok {
+		r1 = rf(ctx, objectKey)
+	} else {
+		r1 = ret.Get(1).(s3.ObjectInfo)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string) error); ok {
+		r2 = rf(ctx, objectKey)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetObjectTagging provides a mock function with given fields: ctx, objectKey
+func (_m *S3) GetObjectTagging(ctx context.Context, objectKey string) (map[string]string, error) {
+	ret := _m.Called(ctx, objectKey)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetObjectTagging")
+	}
+
+	var r0 map[string]string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (map[string]string, error)); ok {
+		return rf(ctx, objectKey)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) map[string]string); ok {
+		r0 = rf(ctx, objectKey)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, objectKey)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// HeadBucket provides a mock function with given fields: ctx
+func (_m *S3) HeadBucket(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for HeadBucket")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// HeadObject provides a mock function with given fields: ctx, objectKey
+func (_m *S3) HeadObject(ctx context.Context, objectKey string) (s3.ObjectInfo, error) {
+	ret := _m.Called(ctx, objectKey)
+
+	if len(ret) == 0 {
+		panic("no return value specified for HeadObject")
+	}
+
+	var r0 s3.ObjectInfo
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (s3.ObjectInfo, error)); ok {
+		return rf(ctx, objectKey)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) s3.ObjectInfo); ok {
+		r0 = rf(ctx, objectKey)
+	} else {
+		r0 = ret.Get(0).(s3.ObjectInfo)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, objectKey)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListObjects provides a mock function with given fields: ctx, prefix, fn
+func (_m *S3) ListObjects(ctx context.Context, prefix string, fn func(s3.ObjectInfo) error) error {
+	ret := _m.Called(ctx, prefix, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListObjects")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, func(s3.ObjectInfo) error) error); ok {
+		r0 = rf(ctx, prefix, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PresignUrl provides a mock function with given fields: ctx, objectKey, expires
+func (_m *S3) PresignUrl(ctx context.Context, objectKey string, expires int64) string {
+	ret := _m.Called(ctx, objectKey, expires)
 
 	if len(ret) == 0 {
 		panic("no return value specified for PresignUrl")
 	}
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(string, int64) string); ok {
-		r0 = rf(objectKey, expires)
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) string); ok {
+		r0 = rf(ctx, objectKey, expires)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
@@ -27,27 +183,27 @@ func (_m *S3) PresignUrl(objectKey string, expires int64) string {
 	return r0
 }
 
-// Upload provides a mock function with given fields: fileData, fileName
-func (_m *S3) Upload(fileData []byte, fileName string) (string, error) {
-	ret := _m.Called(fileData, fileName)
+// Upload provides a mock function with given fields: ctx, fileData, fileName, opts
+func (_m *S3) Upload(ctx context.Context, fileData []byte, fileName string, opts s3.UploadOptions) (s3.UploadResult, error) {
+	ret := _m.Called(ctx, fileData, fileName, opts)
 
 	if len(ret) == 0 {
 		panic("no return value specified for Upload")
 	}
 
-	var r0 string
+	var r0 s3.UploadResult
 	var r1 error
-	if rf, ok := ret.Get(0).(func([]byte, string) (string, error)); ok {
-		return rf(fileData, fileName)
+	if rf, ok := ret.Get(0).(func(context.Context, []byte, string, s3.UploadOptions) (s3.UploadResult, error)); ok {
+		return rf(ctx, fileData, fileName, opts)
 	}
-	if rf, ok := ret.Get(0).(func([]byte, string) string); ok {
-		r0 = rf(fileData, fileName)
+	if rf, ok := ret.Get(0).(func(context.Context, []byte, string, s3.UploadOptions) s3.UploadResult); ok {
+		r0 = rf(ctx, fileData, fileName, opts)
 	} else {
-		r0 = ret.Get(0).(string)
+		r0 = ret.Get(0).(s3.UploadResult)
 	}
 
-	if rf, ok := ret.Get(1).(func([]byte, string) error); ok {
-		r1 = rf(fileData, fileName)
+	if rf, ok := ret.Get(1).(func(context.Context, []byte, string, s3.UploadOptions) error); ok {
+		r1 = rf(ctx, fileData, fileName, opts)
 	} else {
 		r1 = ret.Error(1)
 	}
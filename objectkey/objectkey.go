@@ -0,0 +1,187 @@
+package objectkey
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/haithamswe/multi-protocol-upload-api/utils/hashutil"
+	"github.com/haithamswe/multi-protocol-upload-api/utils/timeutil"
+	"github.com/haithamswe/multi-protocol-upload-api/utils/uuidutil"
+)
+
+const (
+	DefaultFileName = "default_filename"
+	DefaultTenant   = "default"
+
+	maxFileNameLength = 200
+
+	UUIDTemplate        = "{uuid}_{filename}"
+	DatePrefixTemplate  = "{yyyy}/{mm}/{dd}/{uuid}_{filename}"
+	ContentHashTemplate = "{tenant}/{sha256}{ext}"
+)
+
+var dateLayouts = map[string]string{
+	"{yyyy}": "2006",
+	"{mm}":   "01",
+	"{dd}":   "02",
+}
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+	unsafeCharacters   = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	repeatedSeparators = regexp.MustCompile(`[_]{2,}`)
+	tenantPattern      = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+)
+
+var ErrInvalidTenant = errors.New("tenant ID must be 1 to 64 characters of [A-Za-z0-9._-] starting with a letter or digit")
+
+// ValidateTenant reports ErrInvalidTenant for tenant IDs that are not a single safe key segment.
+// Such IDs are rejected rather than sanitised, since sanitising could map one tenant onto
+// another's keys. An empty tenant is valid and stands for DefaultTenant.
+func ValidateTenant(tenant string) error {
+	if tenant != "" && !tenantPattern.MatchString(tenant) {
+		return fmt.Errorf("%w: %q", ErrInvalidTenant, tenant)
+	}
+	return nil
+}
+
+type Strategy interface {
+	Key(input Input) string
+}
+
+type Input struct {
+	FileName string
+	Tenant   string
+	Data     []byte
+}
+
+type templateStrategy struct {
+	template string
+	timeUtil timeutil.TimeUtil
+	uuidUtil uuidutil.UUIDUtil
+}
+
+func (s templateStrategy) Key(input Input) string {
+	fileName := SanitizeFileName(input.FileName)
+	ext := path.Ext(fileName)
+	tenant := input.Tenant
+	switch {
+	case tenant == "":
+		tenant = DefaultTenant
+	case ValidateTenant(tenant) != nil:
+		// Callers validate tenants first. Should an invalid one get through, it gets a segment of
+		// its own that no valid tenant ID can produce.
+		tenant = "_" + hashutil.HashSHA256([]byte(tenant))[:16]
+	}
+
+	var uuid, sha256 string
+	var now time.Time
+	return placeholderPattern.ReplaceAllStringFunc(s.template, func(placeholder string) string {
+		switch placeholder {
+		case "{uuid}":
+			if uuid == "" {
+				uuid = s.uuidUtil.Generate()
+			}
+			return uuid
+		case "{filename}":
+			return fileName
+		case "{name}":
+			return strings.TrimSuffix(fileName, ext)
+		case "{ext}":
+			return ext
+		case "{tenant}":
+			return tenant
+		case "{sha256}":
+			if sha256 == "" {
+				sha256 = hashutil.HashSHA256(input.Data)
+			}
+			return sha256
+		case "{yyyy}", "{mm}", "{dd}":
+			if now.IsZero() {
+				now = s.timeUtil.Now().UTC()
+			}
+			return now.Format(dateLayouts[placeholder])
+		}
+		return placeholder
+	})
+}
+
+// NewStrategy accepts one of the named strategies "uuid", "date-prefix" and "content-hash", or a
+// template such as "{tenant}/{yyyy}/{mm}/{uuid}{ext}".
+func NewStrategy(spec string, timeUtil timeutil.TimeUtil, uuidUtil uuidutil.UUIDUtil) (Strategy, error) {
+	template := spec
+	switch spec {
+	case "", "uuid":
+		template = UUIDTemplate
+	case "date-prefix":
+		template = DatePrefixTemplate
+	case "content-hash":
+		template = ContentHashTemplate
+	}
+
+	for _, placeholder := range placeholderPattern.FindAllString(template, -1) {
+		switch placeholder {
+		case "{uuid}", "{filename}", "{name}", "{ext}", "{tenant}", "{sha256}", "{yyyy}", "{mm}", "{dd}":
+		default:
+			return nil, fmt.Errorf("unknown placeholder %s in key template %q", placeholder, template)
+		}
+	}
+	if strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("key template %q must not start with /", template)
+	}
+	tenantSegment := false
+	for _, segment := range strings.Split(template, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("key template %q contains an empty or relative path segment", template)
+		}
+		tenantSegment = tenantSegment || segment == "{tenant}"
+	}
+	// No placeholder expands to a "/", so a {tenant} segment sits at the same depth in every key
+	// and keys of different tenants never meet.
+	if !tenantSegment && !strings.Contains(template, "{uuid}") {
+		return nil, fmt.Errorf("key template %q must contain {uuid} or a {tenant} path segment, so tenants cannot overwrite each other's objects", template)
+	}
+
+	return &templateStrategy{
+		template: template,
+		timeUtil: timeUtil,
+		uuidUtil: uuidUtil,
+	}, nil
+}
+
+// Unique reports whether strategy generates a new key for every upload, so that no upload
+// replaces an existing object.
+func Unique(strategy Strategy) bool {
+	s, ok := strategy.(*templateStrategy)
+	return ok && strings.Contains(s.template, "{uuid}")
+}
+
+// SanitizeFileName reduces a user supplied name to a single safe path segment made of
+// [A-Za-z0-9._-], so it can be embedded in an object key without escaping surprises.
+func SanitizeFileName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ToValidUTF8(name, "")
+	name = unsafeCharacters.ReplaceAllString(name, "_")
+	name = repeatedSeparators.ReplaceAllString(name, "_")
+	name = strings.TrimLeft(name, "._-")
+	name = strings.TrimRight(name, "._-")
+
+	if len(name) > maxFileNameLength {
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = name[:maxFileNameLength-len(ext)] + ext
+	}
+	if name == "" || !utf8.ValidString(name) {
+		return DefaultFileName
+	}
+	return name
+}
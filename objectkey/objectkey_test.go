@@ -0,0 +1,129 @@
+package objectkey_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/mocks"
+	"github.com/haithamswe/multi-protocol-upload-api/objectkey"
+	"github.com/haithamswe/multi-protocol-upload-api/utils/hashutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "report.pdf", expected: "report.pdf"},
+		{input: "", expected: objectkey.DefaultFileName},
+		{input: "../../etc/passwd", expected: "passwd"},
+		{input: `C:\Users\me\photo.jpg`, expected: "photo.jpg"},
+		{input: "..", expected: objectkey.DefaultFileName},
+		{input: ".htaccess", expected: "htaccess"},
+		{input: "my file (1).txt", expected: "my_file_1_.txt"},
+		{input: "résumé.pdf", expected: "r_sum_.pdf"},
+		{input: "a+b&c=d?e#f%20.txt", expected: "a_b_c_d_e_f_20.txt"},
+		{input: "日本語", expected: objectkey.DefaultFileName},
+		{input: "bad\xffutf8.txt", expected: "badutf8.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, objectkey.SanitizeFileName(tt.input))
+		})
+	}
+}
+
+func TestSanitizeFileName_Truncates(t *testing.T) {
+	name := objectkey.SanitizeFileName(strings.Repeat("a", 500) + ".txt")
+	assert.Len(t, name, 200)
+	assert.True(t, strings.HasSuffix(name, ".txt"))
+}
+
+func TestValidateTenant(t *testing.T) {
+	for _, tenant := range []string{"", "acme", "acme-eu.1", "A_b"} {
+		assert.NoError(t, objectkey.ValidateTenant(tenant), tenant)
+	}
+	for _, tenant := range []string{"evil/acme", `evil\acme`, "..", ".acme", "-acme", "ac me", "acmé", strings.Repeat("a", 65)} {
+		assert.ErrorIs(t, objectkey.ValidateTenant(tenant), objectkey.ErrInvalidTenant, tenant)
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	fixedTime := time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		spec     string
+		input    objectkey.Input
+		expected string
+	}{
+		{
+			name:     "UUID",
+			spec:     "uuid",
+			input:    objectkey.Input{FileName: "../notes.txt"},
+			expected: "fixed-uuid_notes.txt",
+		},
+		{
+			name:     "Date prefix",
+			spec:     "date-prefix",
+			input:    objectkey.Input{FileName: "notes.txt"},
+			expected: "2025/02/24/fixed-uuid_notes.txt",
+		},
+		{
+			name:     "Content hash",
+			spec:     "content-hash",
+			input:    objectkey.Input{FileName: "hello.txt", Data: []byte("hello")},
+			expected: "default/2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824.txt",
+		},
+		{
+			name:     "Template with tenant",
+			spec:     "{tenant}/{yyyy}/{mm}/{uuid}{ext}",
+			input:    objectkey.Input{FileName: "photo.JPG", Tenant: "acme"},
+			expected: "acme/2025/02/fixed-uuid.JPG",
+		},
+		{
+			name:     "Template with an invalid tenant",
+			spec:     "{tenant}/{uuid}{ext}",
+			input:    objectkey.Input{FileName: "photo.JPG", Tenant: "evil/acme"},
+			expected: "_" + hashutil.HashSHA256([]byte("evil/acme"))[:16] + "/fixed-uuid.JPG",
+		},
+		{
+			name:     "Template without tenant",
+			spec:     "{tenant}/{name}-{uuid}{ext}",
+			input:    objectkey.Input{FileName: "photo.png"},
+			expected: "default/photo-fixed-uuid.png",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTimeUtil := mocks.NewTimeUtil(t)
+			mockTimeUtil.On("Now").Return(fixedTime).Maybe()
+			mockUUIDUtil := mocks.NewUUIDUtil(t)
+			mockUUIDUtil.On("Generate").Return("fixed-uuid").Maybe()
+
+			strategy, err := objectkey.NewStrategy(tt.spec, mockTimeUtil, mockUUIDUtil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, strategy.Key(tt.input))
+		})
+	}
+}
+
+func TestNewStrategy_InvalidTemplate(t *testing.T) {
+	for _, spec := range []string{"{unknown}/{uuid}", "/{uuid}", "{tenant}//{uuid}", "{tenant}/../{uuid}", "{sha256}{ext}", "{tenant}-{sha256}", "{yyyy}/{filename}"} {
+		_, err := objectkey.NewStrategy(spec, nil, nil)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestUnique(t *testing.T) {
+	for spec, unique := range map[string]bool{"uuid": true, "date-prefix": true, "content-hash": false, "{tenant}/{filename}": false} {
+		strategy, err := objectkey.NewStrategy(spec, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, unique, objectkey.Unique(strategy), spec)
+	}
+	assert.False(t, objectkey.Unique(mocks.NewStrategy(t)))
+}
@@ -0,0 +1,93 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+)
+
+// S3Lister lists the bucket and reads the tenant of every object with a HEAD request, since
+// listings do not carry object metadata. Up to concurrency HEAD requests run at a time.
+func S3Lister(client s3.S3, concurrency int) Lister {
+	return func(ctx context.Context, fn func(Object) error) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		keys := make(chan s3.ObjectInfo)
+		results := make(chan Object)
+		var wg sync.WaitGroup
+		var headErr error
+		var once sync.Once
+		fail := func(err error) {
+			once.Do(func() {
+				headErr = err
+				cancel()
+			})
+		}
+
+		for i := 0; i < max(concurrency, 1); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for listed := range keys {
+					tenant, err := objectTenant(ctx, client, listed.Key)
+					var s3Err *s3.Error
+					if errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusNotFound {
+						// Deleted since it was listed.
+						continue
+					}
+					if err != nil {
+						fail(err)
+						continue
+					}
+					select {
+					case results <- Object{Key: listed.Key, Tenant: tenant, Size: listed.Size}:
+					case <-ctx.Done():
+					}
+				}
+			}()
+		}
+
+		listErr := make(chan error, 1)
+		go func() {
+			defer close(keys)
+			listErr <- client.ListObjects(ctx, "", func(info s3.ObjectInfo) error {
+				select {
+				case keys <- info:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}()
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		for o := range results {
+			if err := fn(o); err != nil {
+				fail(err)
+			}
+		}
+		if headErr != nil {
+			return headErr
+		}
+		return <-listErr
+	}
+}
+
+// objectTenant reads the tenant recorded on an object. S3 refuses HEAD requests for SSE-C objects
+// without their key, so the tenant of those is read from the object's tags instead.
+func objectTenant(ctx context.Context, client s3.S3, key string) (string, error) {
+	info, err := client.HeadObject(ctx, key)
+	var s3Err *s3.Error
+	if errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusBadRequest {
+		tags, err := client.GetObjectTagging(ctx, key)
+		return tags[s3.TenantTag], err
+	}
+	return info.Tenant(), err
+}
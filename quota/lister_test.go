@@ -0,0 +1,54 @@
+package quota_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/mocks"
+	"github.com/haithamswe/multi-protocol-upload-api/quota"
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestS3Lister(t *testing.T) {
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("ListObjects", mock.Anything, "", mock.Anything).
+		Return(func(ctx context.Context, prefix string, fn func(s3.ObjectInfo) error) error {
+			for _, info := range []s3.ObjectInfo{{Key: "a", Size: 10}, {Key: "b", Size: 20}, {Key: "gone", Size: 5}, {Key: "c", Size: 1}, {Key: "sse-c", Size: 7}} {
+				if err := fn(info); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	mockS3.On("HeadObject", mock.Anything, "a").Return(s3.ObjectInfo{Metadata: map[string]string{"tenant": "acme"}}, nil)
+	mockS3.On("HeadObject", mock.Anything, "b").Return(s3.ObjectInfo{Metadata: map[string]string{"tenant": "acme"}}, nil)
+	mockS3.On("HeadObject", mock.Anything, "c").Return(s3.ObjectInfo{Metadata: map[string]string{}}, nil)
+	mockS3.On("HeadObject", mock.Anything, "gone").Return(s3.ObjectInfo{}, &s3.Error{StatusCode: http.StatusNotFound})
+	// SSE-C objects cannot be read without their key, so the tenant comes from the tags.
+	mockS3.On("HeadObject", mock.Anything, "sse-c").Return(s3.ObjectInfo{}, &s3.Error{StatusCode: http.StatusBadRequest})
+	mockS3.On("GetObjectTagging", mock.Anything, "sse-c").Return(map[string]string{s3.TenantTag: "acme"}, nil)
+
+	q := quota.NewQuotas(quota.Limit{}, nil, quota.NewMemoryStore())
+	assert.NoError(t, q.Rebuild(context.Background(), quota.S3Lister(mockS3, 2)))
+
+	assert.Equal(t, quota.Usage{Bytes: 37, Objects: 3}, usageOf(t, q, "acme"))
+	assert.Equal(t, quota.Usage{Bytes: 1, Objects: 1}, usageOf(t, q, ""))
+}
+
+func TestS3Lister_HeadError(t *testing.T) {
+	mockS3 := mocks.NewS3(t)
+	mockS3.On("ListObjects", mock.Anything, "", mock.Anything).
+		Return(func(ctx context.Context, prefix string, fn func(s3.ObjectInfo) error) error {
+			return fn(s3.ObjectInfo{Key: "a", Size: 10})
+		})
+	headErr := &s3.Error{StatusCode: http.StatusForbidden, Code: "AccessDenied"}
+	mockS3.On("HeadObject", mock.Anything, "a").Return(s3.ObjectInfo{}, headErr)
+
+	err := quota.S3Lister(mockS3, 2)(context.Background(), func(quota.Object) error { return nil })
+
+	assert.True(t, errors.Is(err, headErr))
+}
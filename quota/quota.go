@@ -0,0 +1,252 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrBytesExceeded   = errors.New("storage quota exceeded")
+	ErrObjectsExceeded = errors.New("object count quota exceeded")
+)
+
+type Usage struct {
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+}
+
+// Limit caps what a tenant may store. Zero means unlimited.
+type Limit struct {
+	MaxBytes   int64 `json:"maxBytes,omitempty"`
+	MaxObjects int64 `json:"maxObjects,omitempty"`
+}
+
+// Object is a stored object as seen by a bucket listing.
+type Object struct {
+	Key    string
+	Tenant string
+	Size   int64
+}
+
+// Lister walks every object in the bucket.
+type Lister func(ctx context.Context, fn func(Object) error) error
+
+type Reservation interface {
+	// Commit records the upload as stored under objectKey, replacing whatever was recorded for
+	// that key before.
+	Commit(ctx context.Context, objectKey string) error
+	// Cancel gives the reserved space back after a failed upload.
+	Cancel()
+}
+
+type Quotas interface {
+	// Check reports whether size more bytes would fit, without reserving them.
+	Check(ctx context.Context, tenant string, size int64) error
+	// Reserve holds size bytes and one object for an upload in progress, so concurrent uploads
+	// cannot overshoot the quota together.
+	Reserve(ctx context.Context, tenant string, size int64) (Reservation, error)
+	// Release records that an object was deleted.
+	Release(ctx context.Context, objectKey string) error
+	Usage(ctx context.Context, tenant string) (Usage, error)
+	Limit(tenant string) Limit
+	// Rebuild replaces the accounting with the contents of the bucket. Uploads and deletes that
+	// happen while the listing runs are reconciled afterwards.
+	Rebuild(ctx context.Context, list Lister) error
+}
+
+// Store keeps the size and tenant of every stored object. A store shared by several instances,
+// such as the file catalog, lets them enforce one quota together.
+type Store interface {
+	// PutUsage records an object, replacing the entry for the same key, whichever tenant it was
+	// recorded for.
+	PutUsage(ctx context.Context, objectKey, tenant string, size int64) error
+	// DeleteUsage forgets an object. Unknown keys are ignored.
+	DeleteUsage(ctx context.Context, objectKey string) error
+	// TenantUsage returns the bytes and objects recorded for tenant.
+	TenantUsage(ctx context.Context, tenant string) (bytes, objects int64, err error)
+	// UsageKeys returns every recorded key.
+	UsageKeys(ctx context.Context) ([]string, error)
+}
+
+type event struct {
+	object  Object
+	removed bool
+}
+
+type quotas struct {
+	mu        sync.Mutex
+	limit     Limit
+	perTenant map[string]Limit
+	store     Store
+	// pending holds this instance's reservations; they are not shared with other instances.
+	pending map[string]Usage
+	// journal collects the last change to each key made while a rebuild is listing the bucket.
+	journal map[string]event
+}
+
+func (q *quotas) Check(ctx context.Context, tenant string, size int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.check(ctx, tenant, size)
+}
+
+// check must be called with q.mu held.
+func (q *quotas) check(ctx context.Context, tenant string, size int64) error {
+	limit := q.limitFor(tenant)
+	if limit == (Limit{}) {
+		return nil
+	}
+	used, err := q.usage(ctx, tenant)
+	if err != nil {
+		return err
+	}
+	pending := q.pending[tenant]
+	if limit.MaxBytes > 0 && used.Bytes+pending.Bytes+size > limit.MaxBytes {
+		return fmt.Errorf("%w: %d of %d bytes used", ErrBytesExceeded, used.Bytes+pending.Bytes, limit.MaxBytes)
+	}
+	if limit.MaxObjects > 0 && used.Objects+pending.Objects+1 > limit.MaxObjects {
+		return fmt.Errorf("%w: %d of %d objects used", ErrObjectsExceeded, used.Objects+pending.Objects, limit.MaxObjects)
+	}
+	return nil
+}
+
+func (q *quotas) Reserve(ctx context.Context, tenant string, size int64) (Reservation, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.check(ctx, tenant, size); err != nil {
+		return nil, err
+	}
+	q.pending[tenant] = add(q.pending[tenant], size, 1)
+	return &reservation{q: q, tenant: tenant, size: size}, nil
+}
+
+func (q *quotas) Release(ctx context.Context, objectKey string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.journal != nil {
+		q.journal[objectKey] = event{object: Object{Key: objectKey}, removed: true}
+	}
+	return q.store.DeleteUsage(context.WithoutCancel(ctx), objectKey)
+}
+
+func (q *quotas) Usage(ctx context.Context, tenant string) (Usage, error) {
+	return q.usage(ctx, tenant)
+}
+
+func (q *quotas) usage(ctx context.Context, tenant string) (Usage, error) {
+	bytes, objects, err := q.store.TenantUsage(ctx, tenant)
+	if err != nil {
+		return Usage{}, fmt.Errorf("quota: reading usage: %w", err)
+	}
+	return clamp(Usage{Bytes: bytes, Objects: objects}), nil
+}
+
+func (q *quotas) Limit(tenant string) Limit {
+	return q.limitFor(tenant)
+}
+
+func (q *quotas) limitFor(tenant string) Limit {
+	if limit, ok := q.perTenant[tenant]; ok {
+		return limit
+	}
+	return q.limit
+}
+
+func (q *quotas) Rebuild(ctx context.Context, list Lister) error {
+	q.mu.Lock()
+	if q.journal != nil {
+		q.mu.Unlock()
+		return errors.New("quota: rebuild already in progress")
+	}
+	q.journal = map[string]event{}
+	q.mu.Unlock()
+
+	listed := map[string]bool{}
+	err := list(ctx, func(o Object) error {
+		listed[o.Key] = true
+		return q.store.PutUsage(ctx, o.Key, o.Tenant, o.Size)
+	})
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	journal := q.journal
+	q.journal = nil
+	if err != nil {
+		return err
+	}
+	// The listing may or may not have seen objects that changed while it ran, so the last change
+	// to each of them is applied again.
+	for key, e := range journal {
+		if e.removed {
+			err = q.store.DeleteUsage(ctx, key)
+		} else {
+			err = q.store.PutUsage(ctx, key, e.object.Tenant, e.object.Size)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	keys, err := q.store.UsageKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, changed := journal[key]; !listed[key] && !changed {
+			if err := q.store.DeleteUsage(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type reservation struct {
+	q      *quotas
+	tenant string
+	size   int64
+	once   sync.Once
+}
+
+func (r *reservation) Commit(ctx context.Context, objectKey string) error {
+	var err error
+	r.once.Do(func() {
+		r.q.mu.Lock()
+		defer r.q.mu.Unlock()
+		r.q.pending[r.tenant] = add(r.q.pending[r.tenant], -r.size, -1)
+		if r.q.journal != nil {
+			r.q.journal[objectKey] = event{object: Object{Key: objectKey, Tenant: r.tenant, Size: r.size}}
+		}
+		// The object is stored by now, so the request ending must not lose track of it.
+		err = r.q.store.PutUsage(context.WithoutCancel(ctx), objectKey, r.tenant, r.size)
+	})
+	return err
+}
+
+func (r *reservation) Cancel() {
+	r.once.Do(func() {
+		r.q.mu.Lock()
+		defer r.q.mu.Unlock()
+		r.q.pending[r.tenant] = add(r.q.pending[r.tenant], -r.size, -1)
+	})
+}
+
+func add(u Usage, bytes, objects int64) Usage {
+	return Usage{Bytes: u.Bytes + bytes, Objects: u.Objects + objects}
+}
+
+func clamp(u Usage) Usage {
+	return Usage{Bytes: max(u.Bytes, 0), Objects: max(u.Objects, 0)}
+}
+
+// NewQuotas enforces limit for every tenant without an entry in perTenant, against the usage
+// recorded in store.
+func NewQuotas(limit Limit, perTenant map[string]Limit, store Store) Quotas {
+	return &quotas{
+		limit:     limit,
+		perTenant: perTenant,
+		store:     store,
+		pending:   map[string]Usage{},
+	}
+}
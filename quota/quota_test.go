@@ -0,0 +1,172 @@
+package quota_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/quota"
+	"github.com/stretchr/testify/assert"
+)
+
+func usageOf(t *testing.T, q quota.Quotas, tenant string) quota.Usage {
+	usage, err := q.Usage(context.Background(), tenant)
+	assert.NoError(t, err)
+	return usage
+}
+
+func TestReserve(t *testing.T) {
+	q := quota.NewQuotas(quota.Limit{MaxBytes: 100, MaxObjects: 3}, map[string]quota.Limit{
+		"globex": {MaxBytes: 10},
+	}, quota.NewMemoryStore())
+
+	r, err := q.Reserve(context.Background(), "acme", 60)
+	assert.NoError(t, err)
+	// The pending reservation counts against the quota.
+	_, err = q.Reserve(context.Background(), "acme", 50)
+	assert.ErrorIs(t, err, quota.ErrBytesExceeded)
+	assert.ErrorIs(t, q.Check(context.Background(), "acme", 50), quota.ErrBytesExceeded)
+
+	r.Commit(context.Background(), "a")
+	r.Commit(context.Background(), "a")
+	assert.Equal(t, quota.Usage{Bytes: 60, Objects: 1}, usageOf(t, q, "acme"))
+
+	r, err = q.Reserve(context.Background(), "acme", 40)
+	assert.NoError(t, err)
+	r.Cancel()
+	assert.Equal(t, quota.Usage{Bytes: 60, Objects: 1}, usageOf(t, q, "acme"))
+
+	_, err = q.Reserve(context.Background(), "globex", 11)
+	assert.ErrorIs(t, err, quota.ErrBytesExceeded)
+	assert.Equal(t, quota.Limit{MaxBytes: 10}, q.Limit("globex"))
+	assert.Equal(t, quota.Limit{MaxBytes: 100, MaxObjects: 3}, q.Limit("initech"))
+}
+
+func TestReserve_ObjectCount(t *testing.T) {
+	q := quota.NewQuotas(quota.Limit{MaxObjects: 2}, nil, quota.NewMemoryStore())
+	for _, key := range []string{"a", "b"} {
+		r, err := q.Reserve(context.Background(), "acme", 1)
+		assert.NoError(t, err)
+		r.Commit(context.Background(), key)
+	}
+	_, err := q.Reserve(context.Background(), "acme", 1)
+	assert.ErrorIs(t, err, quota.ErrObjectsExceeded)
+
+	q.Release(context.Background(), "a")
+	_, err = q.Reserve(context.Background(), "acme", 1)
+	assert.NoError(t, err)
+}
+
+func TestReserve_Concurrent(t *testing.T) {
+	q := quota.NewQuotas(quota.Limit{MaxBytes: 1000}, nil, quota.NewMemoryStore())
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	admitted := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, err := q.Reserve(context.Background(), "acme", 30)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			admitted++
+			mu.Unlock()
+			if i%2 == 0 {
+				r.Commit(context.Background(), string(rune('a'+i)))
+				return
+			}
+			r.Cancel()
+		}(i)
+	}
+	wg.Wait()
+
+	usage := usageOf(t, q, "acme")
+	assert.LessOrEqual(t, usage.Bytes, int64(1000))
+	assert.Equal(t, usage.Bytes, usage.Objects*30)
+	assert.GreaterOrEqual(t, admitted, 33)
+}
+
+func TestCommit_Overwrite(t *testing.T) {
+	ctx := context.Background()
+	q := quota.NewQuotas(quota.Limit{MaxBytes: 100}, nil, quota.NewMemoryStore())
+	for _, size := range []int64{60, 30} {
+		r, err := q.Reserve(ctx, "acme", size)
+		assert.NoError(t, err)
+		assert.NoError(t, r.Commit(ctx, "a"))
+	}
+	// The second upload replaced the first instead of adding to it.
+	assert.Equal(t, quota.Usage{Bytes: 30, Objects: 1}, usageOf(t, q, "acme"))
+
+	r, err := q.Reserve(ctx, "globex", 5)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Commit(ctx, "a"))
+	assert.Equal(t, quota.Usage{}, usageOf(t, q, "acme"))
+	assert.Equal(t, quota.Usage{Bytes: 5, Objects: 1}, usageOf(t, q, "globex"))
+}
+
+func TestQuotas_SharedStore(t *testing.T) {
+	ctx := context.Background()
+	store := quota.NewMemoryStore()
+	first := quota.NewQuotas(quota.Limit{MaxBytes: 100}, nil, store)
+	second := quota.NewQuotas(quota.Limit{MaxBytes: 100}, nil, store)
+
+	r, err := first.Reserve(ctx, "acme", 70)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Commit(ctx, "a"))
+
+	// Instances sharing a store see each other's uploads.
+	_, err = second.Reserve(ctx, "acme", 40)
+	assert.ErrorIs(t, err, quota.ErrBytesExceeded)
+	assert.NoError(t, second.Release(ctx, "a"))
+	assert.NoError(t, first.Check(ctx, "acme", 100))
+}
+
+func TestRelease_NeverNegative(t *testing.T) {
+	q := quota.NewQuotas(quota.Limit{}, nil, quota.NewMemoryStore())
+	q.Release(context.Background(), "unknown")
+	assert.Equal(t, quota.Usage{}, usageOf(t, q, "acme"))
+}
+
+func TestRebuild(t *testing.T) {
+	q := quota.NewQuotas(quota.Limit{}, nil, quota.NewMemoryStore())
+	r, _ := q.Reserve(context.Background(), "acme", 999)
+	r.Commit(context.Background(), "stale")
+
+	err := q.Rebuild(context.Background(), func(ctx context.Context, fn func(quota.Object) error) error {
+		fn(quota.Object{Key: "a", Tenant: "acme", Size: 10})
+		fn(quota.Object{Key: "b", Tenant: "acme", Size: 20})
+
+		// Changes while the listing runs: "c" is uploaded after the listing passed it, "d" before,
+		// "a" is deleted after being listed and "e" is deleted before it could be listed.
+		for _, key := range []string{"c", "d"} {
+			r, _ := q.Reserve(context.Background(), "acme", 5)
+			r.Commit(context.Background(), key)
+		}
+		q.Release(context.Background(), "a")
+		q.Release(context.Background(), "e")
+
+		fn(quota.Object{Key: "d", Tenant: "acme", Size: 5})
+		return fn(quota.Object{Key: "x", Tenant: "globex", Size: 1})
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, quota.Usage{Bytes: 30, Objects: 3}, usageOf(t, q, "acme"))
+	assert.Equal(t, quota.Usage{Bytes: 1, Objects: 1}, usageOf(t, q, "globex"))
+}
+
+func TestRebuild_KeepsUsageOnError(t *testing.T) {
+	q := quota.NewQuotas(quota.Limit{}, nil, quota.NewMemoryStore())
+	r, _ := q.Reserve(context.Background(), "acme", 10)
+	r.Commit(context.Background(), "a")
+
+	err := q.Rebuild(context.Background(), func(ctx context.Context, fn func(quota.Object) error) error {
+		return errors.New("listing failed")
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, quota.Usage{Bytes: 10, Objects: 1}, usageOf(t, q, "acme"))
+}
@@ -0,0 +1,65 @@
+package quota
+
+import (
+	"context"
+	"sync"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	objects map[string]Object
+	tenants map[string]Usage
+}
+
+func (m *memoryStore) PutUsage(ctx context.Context, objectKey, tenant string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(objectKey)
+	m.objects[objectKey] = Object{Key: objectKey, Tenant: tenant, Size: size}
+	m.tenants[tenant] = add(m.tenants[tenant], size, 1)
+	return nil
+}
+
+func (m *memoryStore) DeleteUsage(ctx context.Context, objectKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(objectKey)
+	return nil
+}
+
+// remove must be called with m.mu held.
+func (m *memoryStore) remove(objectKey string) {
+	old, ok := m.objects[objectKey]
+	if !ok {
+		return
+	}
+	delete(m.objects, objectKey)
+	if usage := add(m.tenants[old.Tenant], -old.Size, -1); usage.Objects > 0 {
+		m.tenants[old.Tenant] = usage
+	} else {
+		delete(m.tenants, old.Tenant)
+	}
+}
+
+func (m *memoryStore) TenantUsage(ctx context.Context, tenant string) (int64, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := m.tenants[tenant]
+	return usage.Bytes, usage.Objects, nil
+}
+
+func (m *memoryStore) UsageKeys(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// NewMemoryStore keeps usage in this process only. It starts empty, so it only knows objects
+// uploaded since the process started unless a Rebuild fills it in.
+func NewMemoryStore() Store {
+	return &memoryStore{objects: map[string]Object{}, tenants: map[string]Usage{}}
+}
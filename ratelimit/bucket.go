@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// bucket is a token bucket that may go into debt: a request that needs more tokens than are
+// available is admitted as long as the bucket is not already in debt, and later requests wait
+// until the debt is repaid. This lets a single large upload through without letting a client
+// exceed the configured rate on average.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate, burst float64, now time.Time) *bucket {
+	return &bucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+}
+
+// take removes n tokens when the bucket has at least one token left (or n, if that is smaller).
+// Otherwise it returns how long the caller has to wait before trying again.
+func (b *bucket) take(n float64, now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	need := math.Min(n, 1)
+	if b.tokens < need {
+		return false, b.wait(need)
+	}
+	b.tokens -= n
+	return true, 0
+}
+
+// charge adjusts the bucket for usage that is only known after the fact. A negative n refunds
+// tokens that were reserved but not used.
+func (b *bucket) charge(n float64, now time.Time) {
+	b.refill(now)
+	b.tokens = math.Min(b.burst, b.tokens-n)
+}
+
+func (b *bucket) wait(n float64) time.Duration {
+	missing := n - b.tokens
+	return time.Duration(math.Ceil(missing / b.rate * float64(time.Second)))
+}
+
+func (b *bucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
@@ -0,0 +1,214 @@
+package ratelimit
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/apierror"
+	"github.com/haithamswe/multi-protocol-upload-api/logging"
+	"github.com/haithamswe/multi-protocol-upload-api/utils/timeutil"
+)
+
+const (
+	KeyAPIKey = "api-key"
+	KeyTenant = "tenant"
+	KeyIP     = "ip"
+
+	apiKeyHeader = "X-API-Key"
+	tenantHeader = "X-Tenant-ID"
+
+	// Idle clients whose buckets have refilled are forgotten after this long.
+	sweepInterval = time.Minute
+)
+
+// Config sets the limits applied to every client. A zero rate or cap disables that limit.
+type Config struct {
+	RequestsPerSecond    float64
+	RequestBurst         int
+	BytesPerSecond       float64
+	ByteBurst            int64
+	MaxConcurrentUploads int
+}
+
+type KeyFunc func(r *http.Request) string
+
+// NewKeyFunc identifies clients by API key, tenant or IP, and by IP when mode is empty. The API
+// key and tenant headers are not authenticated here, so those modes only trust the values listed
+// in known: anyone else shares the bucket of their client IP, rather than getting a fresh bucket
+// for every header value they make up.
+func NewKeyFunc(mode string, known []string) (KeyFunc, error) {
+	ipKey := func(r *http.Request) string {
+		return "ip:" + logging.ClientIP(r)
+	}
+	switch mode {
+	case "", KeyIP:
+		return ipKey, nil
+	case KeyAPIKey, KeyTenant:
+		if len(known) == 0 {
+			return nil, fmt.Errorf("rate limit key %q needs a list of known clients", mode)
+		}
+	default:
+		return nil, fmt.Errorf("unknown rate limit key %q", mode)
+	}
+
+	trusted := make(map[string]bool, len(known))
+	for _, value := range known {
+		trusted[value] = true
+	}
+	if mode == KeyAPIKey {
+		return func(r *http.Request) string {
+			if trusted[r.Header.Get(apiKeyHeader)] {
+				return logging.Principal(r)
+			}
+			return ipKey(r)
+		}, nil
+	}
+	return func(r *http.Request) string {
+		if tenant := r.Header.Get(tenantHeader); trusted[tenant] {
+			return "tenant:" + tenant
+		}
+		return ipKey(r)
+	}, nil
+}
+
+type Limiter interface {
+	// Requests limits the request rate of every route it wraps.
+	Requests(next http.Handler) http.Handler
+	// Uploads limits the upload bandwidth and the number of concurrent uploads per client.
+	Uploads(next http.Handler) http.Handler
+}
+
+type client struct {
+	requests *bucket
+	bytes    *bucket
+	inFlight int
+}
+
+type limiter struct {
+	cfg       Config
+	keyFunc   KeyFunc
+	timeUtil  timeutil.TimeUtil
+	mu        sync.Mutex
+	clients   map[string]*client
+	lastSweep time.Time
+}
+
+func (l *limiter) Requests(next http.Handler) http.Handler {
+	if l.cfg.RequestsPerSecond <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		now := l.timeUtil.Now()
+		ok, wait := l.client(l.keyFunc(r), now).requests.take(1, now)
+		l.mu.Unlock()
+		if !ok {
+			reject(w, r, wait, "request rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *limiter) Uploads(next http.Handler) http.Handler {
+	if l.cfg.BytesPerSecond <= 0 && l.cfg.MaxConcurrentUploads <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := l.keyFunc(r)
+		reserved := max(r.ContentLength, 0)
+
+		l.mu.Lock()
+		now := l.timeUtil.Now()
+		c := l.client(key, now)
+		if l.cfg.MaxConcurrentUploads > 0 && c.inFlight >= l.cfg.MaxConcurrentUploads {
+			l.mu.Unlock()
+			reject(w, r, time.Second, "too many concurrent uploads")
+			return
+		}
+		if c.bytes != nil {
+			if ok, wait := c.bytes.take(float64(reserved), now); !ok {
+				l.mu.Unlock()
+				reject(w, r, wait, "upload bandwidth limit exceeded")
+				return
+			}
+		}
+		c.inFlight++
+		l.mu.Unlock()
+
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		defer func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			c.inFlight--
+			// Settle the reservation against what was actually read: chunked uploads have no
+			// Content-Length, and rejected uploads may have read less than they announced.
+			if c.bytes != nil && body.n != reserved {
+				c.bytes.charge(float64(body.n-reserved), l.timeUtil.Now())
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// client returns the state for key, creating it when needed. l.mu must be held.
+func (l *limiter) client(key string, now time.Time) *client {
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{}
+		if l.cfg.RequestsPerSecond > 0 {
+			c.requests = newBucket(l.cfg.RequestsPerSecond, float64(max(l.cfg.RequestBurst, 1)), now)
+		}
+		if l.cfg.BytesPerSecond > 0 {
+			c.bytes = newBucket(l.cfg.BytesPerSecond, float64(max(l.cfg.ByteBurst, 1)), now)
+		}
+		l.clients[key] = c
+	}
+	return c
+}
+
+// sweep forgets clients that are idle and fully refilled; recreating them is equivalent.
+func (l *limiter) sweep(now time.Time) {
+	for key, c := range l.clients {
+		if c.inFlight == 0 && (c.requests == nil || c.requests.full(now)) && (c.bytes == nil || c.bytes.full(now)) {
+			delete(l.clients, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func reject(w http.ResponseWriter, r *http.Request, wait time.Duration, message string) {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.FormatInt(max(seconds, 1), 10))
+	apierror.Write(w, r, apierror.New(apierror.KindTooManyRequests, message))
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func NewLimiter(cfg Config, keyFunc KeyFunc, timeUtil timeutil.TimeUtil) Limiter {
+	return &limiter{
+		cfg:       cfg,
+		keyFunc:   keyFunc,
+		timeUtil:  timeUtil,
+		clients:   map[string]*client{},
+		lastSweep: timeUtil.Now(),
+	}
+}
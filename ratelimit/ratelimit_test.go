@@ -0,0 +1,164 @@
+package ratelimit_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/mocks"
+	"github.com/haithamswe/multi-protocol-upload-api/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newClock(t *testing.T) (*clock, *mocks.TimeUtil) {
+	c := &clock{now: time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC)}
+	mockTimeUtil := mocks.NewTimeUtil(t)
+	mockTimeUtil.On("Now").Return(func() time.Time { return c.now })
+	return c, mockTimeUtil
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func newRequest(ip string, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/upload-to-s3", strings.NewReader(body))
+	req.RemoteAddr = ip + ":1234"
+	return req
+}
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestRequests(t *testing.T) {
+	c, timeUtil := newClock(t)
+	keyFunc, _ := ratelimit.NewKeyFunc(ratelimit.KeyIP, nil)
+	h := ratelimit.NewLimiter(ratelimit.Config{RequestsPerSecond: 2, RequestBurst: 2}, keyFunc, timeUtil).Requests(ok)
+
+	assert.Equal(t, http.StatusOK, serve(h, newRequest("192.0.2.1", "")).Code)
+	assert.Equal(t, http.StatusOK, serve(h, newRequest("192.0.2.1", "")).Code)
+
+	rec := serve(h, newRequest("192.0.2.1", ""))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	var problem map[string]any
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+	assert.Equal(t, "rate_limited", problem["code"])
+
+	// Other clients have their own bucket.
+	assert.Equal(t, http.StatusOK, serve(h, newRequest("192.0.2.2", "")).Code)
+
+	c.advance(500 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, serve(h, newRequest("192.0.2.1", "")).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(h, newRequest("192.0.2.1", "")).Code)
+}
+
+func TestUploads_Bandwidth(t *testing.T) {
+	c, timeUtil := newClock(t)
+	keyFunc, _ := ratelimit.NewKeyFunc(ratelimit.KeyIP, nil)
+	h := ratelimit.NewLimiter(ratelimit.Config{BytesPerSecond: 100, ByteBurst: 100}, keyFunc, timeUtil).Uploads(ok)
+
+	// A single upload larger than the burst is admitted, but puts the client into debt.
+	assert.Equal(t, http.StatusOK, serve(h, newRequest("192.0.2.1", strings.Repeat("a", 400))).Code)
+
+	rec := serve(h, newRequest("192.0.2.1", "small"))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "4", rec.Header().Get("Retry-After"))
+
+	c.advance(4 * time.Second)
+	assert.Equal(t, http.StatusOK, serve(h, newRequest("192.0.2.1", "small")).Code)
+}
+
+func TestUploads_ChargesChunkedBodies(t *testing.T) {
+	_, timeUtil := newClock(t)
+	keyFunc, _ := ratelimit.NewKeyFunc(ratelimit.KeyIP, nil)
+	h := ratelimit.NewLimiter(ratelimit.Config{BytesPerSecond: 100, ByteBurst: 100}, keyFunc, timeUtil).Uploads(ok)
+
+	req := newRequest("192.0.2.1", "")
+	req.Body = io.NopCloser(bytes.NewReader(make([]byte, 300)))
+	req.ContentLength = -1
+	assert.Equal(t, http.StatusOK, serve(h, req).Code)
+
+	rec := serve(h, newRequest("192.0.2.1", "small"))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "3", rec.Header().Get("Retry-After"))
+}
+
+func TestUploads_Concurrency(t *testing.T) {
+	_, timeUtil := newClock(t)
+	keyFunc, _ := ratelimit.NewKeyFunc(ratelimit.KeyAPIKey, []string{"key-1", "key-2"})
+	limiter := ratelimit.NewLimiter(ratelimit.Config{MaxConcurrentUploads: 1}, keyFunc, timeUtil)
+
+	var nested *httptest.ResponseRecorder
+	var h http.Handler
+	h = limiter.Uploads(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if nested == nil {
+			// Issued while the first upload of the same API key is still in flight.
+			req := newRequest("192.0.2.9", "")
+			req.Header.Set("X-API-Key", "key-1")
+			nested = serve(h, req)
+			other := newRequest("192.0.2.9", "")
+			other.Header.Set("X-API-Key", "key-2")
+			assert.Equal(t, http.StatusOK, serve(h, other).Code)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := newRequest("192.0.2.1", "")
+	req.Header.Set("X-API-Key", "key-1")
+	assert.Equal(t, http.StatusOK, serve(h, req).Code)
+	assert.Equal(t, http.StatusTooManyRequests, nested.Code)
+	assert.Equal(t, "1", nested.Header().Get("Retry-After"))
+
+	// The slot is released once the upload finishes.
+	req = newRequest("192.0.2.1", "")
+	req.Header.Set("X-API-Key", "key-1")
+	assert.Equal(t, http.StatusOK, serve(h, req).Code)
+}
+
+func TestNewKeyFunc(t *testing.T) {
+	req := newRequest("192.0.2.1", "")
+	req.Header.Set("X-Tenant-ID", "acme")
+	req.Header.Set("X-API-Key", "key-1")
+	unknown := newRequest("192.0.2.2", "")
+	unknown.Header.Set("X-Tenant-ID", "random-1")
+	unknown.Header.Set("X-API-Key", "random-1")
+
+	tenant, err := ratelimit.NewKeyFunc(ratelimit.KeyTenant, []string{"acme"})
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant:acme", tenant(req))
+	assert.Equal(t, "ip:192.0.2.2", tenant(unknown))
+
+	apiKey, err := ratelimit.NewKeyFunc(ratelimit.KeyAPIKey, []string{"key-1"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, "ip:192.0.2.1", apiKey(req))
+	assert.Equal(t, "ip:192.0.2.2", apiKey(unknown))
+
+	for _, mode := range []string{"", ratelimit.KeyIP} {
+		ip, err := ratelimit.NewKeyFunc(mode, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "ip:192.0.2.1", ip(req))
+	}
+
+	_, err = ratelimit.NewKeyFunc(ratelimit.KeyTenant, nil)
+	assert.Error(t, err)
+	_, err = ratelimit.NewKeyFunc("cookie", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/haithamswe/multi-protocol-upload-api/utils/uuidutil"
+)
+
+const (
+	Header    = "X-Request-ID"
+	maxLength = 128
+)
+
+type contextKey struct{}
+
+// Middleware propagates a well-formed X-Request-ID from the client, or generates one, and makes it
+// available to handlers through FromContext and to the client through the response header.
+func Middleware(uuidUtil uuidutil.UUIDUtil) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(Header)
+			if !valid(id) {
+				id = uuidUtil.Generate()
+			}
+			w.Header().Set(Header, id)
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+		})
+	}
+}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package requestid_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/mocks"
+	"github.com/haithamswe/multi-protocol-upload-api/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		expected string
+	}{
+		{name: "Generates ID", incoming: "", expected: "generated-id"},
+		{name: "Propagates client ID", incoming: "client-id-123", expected: "client-id-123"},
+		{name: "Replaces ID with spaces", incoming: "client id", expected: "generated-id"},
+		{name: "Replaces oversized ID", incoming: strings.Repeat("a", 200), expected: "generated-id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUUIDUtil := mocks.NewUUIDUtil(t)
+			mockUUIDUtil.On("Generate").Return("generated-id").Maybe()
+
+			var seen string
+			handler := requestid.Middleware(mockUUIDUtil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = requestid.FromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(requestid.Header, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expected, seen)
+			assert.Equal(t, tt.expected, rec.Header().Get(requestid.Header))
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	contentMD5Header     = "Content-MD5"
+	checksumSHA256Header = "x-amz-checksum-sha256"
+	checksumCRC32CHeader = "x-amz-checksum-crc32c"
+)
+
+// ErrBadDigest reports that content does not match a checksum supplied for it.
+var ErrBadDigest = errors.New("checksum mismatch")
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksums holds raw digests. They marshal to base64, the encoding S3 uses for checksum headers.
+type Checksums struct {
+	MD5    []byte `json:"md5,omitempty"`
+	SHA256 []byte `json:"sha256,omitempty"`
+	CRC32C []byte `json:"crc32c,omitempty"`
+}
+
+func ComputeChecksums(data []byte) Checksums {
+	md5Sum := md5.Sum(data)
+	sha256Sum := sha256.Sum256(data)
+	return Checksums{
+		MD5:    md5Sum[:],
+		SHA256: sha256Sum[:],
+		CRC32C: binary.BigEndian.AppendUint32(nil, crc32.Checksum(data, crc32cTable)),
+	}
+}
+
+// Verify compares c with every checksum set in expected.
+func (c Checksums) Verify(expected Checksums) error {
+	checks := []struct {
+		name             string
+		actual, expected []byte
+	}{
+		{"MD5", c.MD5, expected.MD5},
+		{"SHA-256", c.SHA256, expected.SHA256},
+		{"CRC32C", c.CRC32C, expected.CRC32C},
+	}
+	for _, check := range checks {
+		if check.expected != nil && !bytes.Equal(check.actual, check.expected) {
+			return fmt.Errorf("%w: %s of the content is %s, expected %s", ErrBadDigest, check.name,
+				base64.StdEncoding.EncodeToString(check.actual), base64.StdEncoding.EncodeToString(check.expected))
+		}
+	}
+	return nil
+}
+
+// ParseChecksum decodes a base64 checksum header value and checks its length against the algorithm:
+// 16 bytes for MD5, 32 for SHA-256 and 4 for CRC32C.
+func ParseChecksum(value string, size int) ([]byte, error) {
+	sum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(sum) != size {
+		return nil, fmt.Errorf("expected a base64 encoded %d byte digest", size)
+	}
+	return sum, nil
+}
+
+// checksumHeaders sets Content-MD5, so S3 rejects corrupted uploads, and one x-amz-checksum-*
+// header, which S3 verifies as well and stores with the object. CRC32C is used when the client
+// supplied one, since S3 accepts a single additional checksum per request.
+func checksumHeaders(headers map[string]string, computed, expected Checksums) {
+	headers[contentMD5Header] = base64.StdEncoding.EncodeToString(computed.MD5)
+	if expected.CRC32C != nil {
+		headers[checksumCRC32CHeader] = base64.StdEncoding.EncodeToString(computed.CRC32C)
+		return
+	}
+	headers[checksumSHA256Header] = base64.StdEncoding.EncodeToString(computed.SHA256)
+}
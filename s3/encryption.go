@@ -0,0 +1,203 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	sseHeader                  = "x-amz-server-side-encryption"
+	sseKMSKeyIDHeader          = "x-amz-server-side-encryption-aws-kms-key-id"
+	sseContextHeader           = "x-amz-server-side-encryption-context"
+	sseCustomerAlgorithmHeader = "x-amz-server-side-encryption-customer-algorithm"
+	sseCustomerKeyHeader       = "x-amz-server-side-encryption-customer-key"
+	sseCustomerKeyMD5Header    = "x-amz-server-side-encryption-customer-key-md5"
+
+	// CustomerKeySize is the size of an SSE-C key, which S3 uses for AES-256.
+	CustomerKeySize = 32
+
+	// TenantTag records the tenant of SSE-C objects as an object tag, because their metadata
+	// cannot be read without the customer's key.
+	TenantTag = "upload-tenant"
+)
+
+type EncryptionMode string
+
+const (
+	EncryptionNone     EncryptionMode = ""
+	EncryptionS3       EncryptionMode = "SSE-S3"
+	EncryptionKMS      EncryptionMode = "SSE-KMS"
+	EncryptionCustomer EncryptionMode = "SSE-C"
+)
+
+var ErrInvalidEncryption = errors.New("invalid encryption")
+
+type Encryption struct {
+	Mode EncryptionMode
+	// KMSKeyID selects the key for SSE-KMS. S3 uses its AWS managed key when it is empty.
+	KMSKeyID   string
+	KMSContext map[string]string
+	// CustomerKey is the raw SSE-C key. S3 does not store it, so every read needs it again.
+	CustomerKey []byte
+}
+
+// ParseEncryptionMode accepts the mode names and the values of S3's x-amz-server-side-encryption
+// header, case-insensitively. Empty and "none" mean no requested encryption.
+func ParseEncryptionMode(value string) (EncryptionMode, error) {
+	switch strings.ToLower(value) {
+	case "", "none":
+		return EncryptionNone, nil
+	case "sse-s3", "aes256":
+		return EncryptionS3, nil
+	case "sse-kms", "aws:kms":
+		return EncryptionKMS, nil
+	case "sse-c":
+		return EncryptionCustomer, nil
+	}
+	return EncryptionNone, fmt.Errorf("%w: unknown mode %q, expected none, SSE-S3, SSE-KMS or SSE-C", ErrInvalidEncryption, value)
+}
+
+func (e Encryption) Validate() error {
+	switch e.Mode {
+	case EncryptionNone, EncryptionS3, EncryptionKMS:
+		if e.CustomerKey != nil {
+			return fmt.Errorf("%w: a customer key requires SSE-C", ErrInvalidEncryption)
+		}
+	case EncryptionCustomer:
+		if len(e.CustomerKey) != CustomerKeySize {
+			return fmt.Errorf("%w: SSE-C requires a %d byte customer key", ErrInvalidEncryption, CustomerKeySize)
+		}
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidEncryption, e.Mode)
+	}
+	return nil
+}
+
+// headers sets the request headers that make S3 encrypt an uploaded object.
+func (e Encryption) headers(headers map[string]string) {
+	switch e.Mode {
+	case EncryptionS3:
+		headers[sseHeader] = "AES256"
+	case EncryptionKMS:
+		headers[sseHeader] = "aws:kms"
+		if e.KMSKeyID != "" {
+			headers[sseKMSKeyIDHeader] = e.KMSKeyID
+		}
+		if len(e.KMSContext) > 0 {
+			// encoding/json sorts map keys, so the header is stable across requests.
+			encoded, _ := json.Marshal(e.KMSContext)
+			headers[sseContextHeader] = base64.StdEncoding.EncodeToString(encoded)
+		}
+	case EncryptionCustomer:
+		customerKeyHeaders(headers, e.CustomerKey)
+	}
+}
+
+func customerKeyHeaders(headers map[string]string, key []byte) {
+	sum := md5.Sum(key)
+	headers[sseCustomerAlgorithmHeader] = "AES256"
+	headers[sseCustomerKeyHeader] = base64.StdEncoding.EncodeToString(key)
+	headers[sseCustomerKeyMD5Header] = base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// encryptionMode reads how an object is encrypted from the headers of a HEAD or GET response.
+func encryptionMode(header http.Header) EncryptionMode {
+	if header.Get(sseCustomerAlgorithmHeader) != "" {
+		return EncryptionCustomer
+	}
+	switch sse := header.Get(sseHeader); {
+	case sse == "AES256":
+		return EncryptionS3
+	case strings.HasPrefix(sse, "aws:kms"):
+		return EncryptionKMS
+	}
+	return EncryptionNone
+}
+
+type customerKeyContextKey struct{}
+
+// WithCustomerKey attaches an SSE-C key to ctx. HeadObject and PresignUrl send it along, since S3
+// only serves SSE-C objects to requests that present the key they were stored with.
+func WithCustomerKey(ctx context.Context, key []byte) context.Context {
+	return context.WithValue(ctx, customerKeyContextKey{}, key)
+}
+
+func customerKey(ctx context.Context) []byte {
+	key, _ := ctx.Value(customerKeyContextKey{}).([]byte)
+	return key
+}
+
+// EncryptionPolicy decides how each tenant's uploads are encrypted.
+type EncryptionPolicy interface {
+	// Resolve combines the tenant's configured encryption with the encryption a request asked for,
+	// which may be zero. Requests may only choose a different mode or KMS key when the policy
+	// allows overrides.
+	Resolve(tenant string, requested Encryption) (Encryption, error)
+}
+
+type encryptionPolicy struct {
+	defaultEncryption Encryption
+	perTenant         map[string]Encryption
+	allowOverride     bool
+}
+
+func (p encryptionPolicy) Resolve(tenant string, requested Encryption) (Encryption, error) {
+	resolved, ok := p.perTenant[tenant]
+	if !ok {
+		resolved = p.defaultEncryption
+	}
+	if requested.Mode != EncryptionNone && requested.Mode != resolved.Mode {
+		if !p.allowOverride {
+			return Encryption{}, fmt.Errorf("%w: uploads must use %s", ErrInvalidEncryption, describeMode(resolved.Mode))
+		}
+		resolved = Encryption{Mode: requested.Mode}
+	}
+	if requested.KMSKeyID != "" && requested.KMSKeyID != resolved.KMSKeyID {
+		if !p.allowOverride {
+			return Encryption{}, fmt.Errorf("%w: the KMS key is set by the server", ErrInvalidEncryption)
+		}
+		resolved.KMSKeyID = requested.KMSKeyID
+	}
+	// Requests may add to the encryption context, but not replace the configured entries.
+	if len(requested.KMSContext) > 0 {
+		kmsContext := maps.Clone(requested.KMSContext)
+		maps.Copy(kmsContext, resolved.KMSContext)
+		resolved.KMSContext = kmsContext
+	}
+	resolved.CustomerKey = requested.CustomerKey
+	if resolved.Mode != EncryptionKMS {
+		resolved.KMSKeyID, resolved.KMSContext = "", nil
+	}
+	return resolved, resolved.Validate()
+}
+
+func describeMode(mode EncryptionMode) string {
+	if mode == EncryptionNone {
+		return "the bucket's default encryption"
+	}
+	return string(mode)
+}
+
+// NewEncryptionPolicy applies perTenant encryption, or defaultEncryption for other tenants. SSE-C
+// entries carry no key; requests must supply it.
+func NewEncryptionPolicy(defaultEncryption Encryption, perTenant map[string]Encryption, allowOverride bool) EncryptionPolicy {
+	return encryptionPolicy{defaultEncryption: defaultEncryption, perTenant: perTenant, allowOverride: allowOverride}
+}
+
+// sortedKeys is used to build the signed header list of presigned URLs.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,46 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const maxErrorBodySize = 64 * 1024
+
+// Error is an error document returned by S3, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/ErrorResponses.html
+type Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestID  string `xml:"RequestId"`
+	HostID     string `xml:"HostId"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("error from S3, status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("error from S3, status code: %d, code: %s, message: %s, request id: %s",
+		e.StatusCode, e.Code, e.Message, e.RequestID)
+}
+
+// parseError reads the XML error document from a failed response. Responses without a body, such
+// as HEAD requests, fall back to the request ID headers.
+func parseError(resp *http.Response) *Error {
+	s3Err := &Error{}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if len(body) > 0 {
+		xml.Unmarshal(body, s3Err)
+	}
+	s3Err.StatusCode = resp.StatusCode
+	if s3Err.RequestID == "" {
+		s3Err.RequestID = resp.Header.Get("x-amz-request-id")
+	}
+	if s3Err.HostID == "" {
+		s3Err.HostID = resp.Header.Get("x-amz-id-2")
+	}
+	return s3Err
+}
@@ -0,0 +1,162 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// S3 limits for user-defined metadata and object tags.
+const (
+	MaxMetadataBytes  = 2048
+	MaxTags           = 10
+	MaxTagKeyLength   = 128
+	MaxTagValueLength = 256
+
+	taggingHeader      = "x-amz-tagging"
+	taggingCountHeader = "x-amz-tagging-count"
+)
+
+var (
+	ErrInvalidMetadata = errors.New("invalid metadata")
+	ErrInvalidTags     = errors.New("invalid tags")
+)
+
+// reservedMetadata are metadata names the API sets itself.
+var reservedMetadata = map[string]bool{
+	"original-filename": true,
+	"tenant":            true,
+	// Set by envelope encryption.
+	"envelope-key":    true,
+	"envelope-key-id": true,
+	// Set by compression.
+	"uncompressed-size": true,
+}
+
+// ValidateMetadata checks user-defined metadata before it is sent as x-amz-meta-* headers. Names
+// must be lowercase letters, digits, "-" or "_"; values may be any printable UTF-8 text.
+func ValidateMetadata(metadata map[string]string) error {
+	size := 0
+	for name, value := range metadata {
+		if name == "" {
+			return fmt.Errorf("%w: empty name", ErrInvalidMetadata)
+		}
+		for _, c := range name {
+			if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("%w: name %q may only contain lowercase letters, digits, '-' and '_'", ErrInvalidMetadata, name)
+			}
+		}
+		if reservedMetadata[name] {
+			return fmt.Errorf("%w: name %q is reserved", ErrInvalidMetadata, name)
+		}
+		if !utf8.ValidString(value) || strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			return fmt.Errorf("%w: value of %q must be printable UTF-8", ErrInvalidMetadata, name)
+		}
+		size += len(name) + len(value)
+	}
+	if size > MaxMetadataBytes {
+		return fmt.Errorf("%w: %d bytes exceeds the %d byte limit", ErrInvalidMetadata, size, MaxMetadataBytes)
+	}
+	return nil
+}
+
+// ValidateTags applies S3's object tagging rules.
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > MaxTags {
+		return fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidTags, MaxTags)
+	}
+	for key, value := range tags {
+		if n := utf8.RuneCountInString(key); n == 0 || n > MaxTagKeyLength {
+			return fmt.Errorf("%w: key %q must be 1 to %d characters", ErrInvalidTags, key, MaxTagKeyLength)
+		}
+		if utf8.RuneCountInString(value) > MaxTagValueLength {
+			return fmt.Errorf("%w: value of %q exceeds %d characters", ErrInvalidTags, key, MaxTagValueLength)
+		}
+		if strings.HasPrefix(strings.ToLower(key), "aws:") {
+			return fmt.Errorf("%w: key %q uses the reserved aws: prefix", ErrInvalidTags, key)
+		}
+		if key == TenantTag {
+			return fmt.Errorf("%w: key %q is reserved", ErrInvalidTags, key)
+		}
+		if !validTagText(key) || !validTagText(value) {
+			return fmt.Errorf("%w: %q may only contain letters, digits, spaces and + - = . _ : / @", ErrInvalidTags, key)
+		}
+	}
+	return nil
+}
+
+func validTagText(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, c := range s {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !unicode.IsSpace(c) && !strings.ContainsRune("+-=._:/@", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeTagging formats tags for the x-amz-tagging header, which takes URL query encoding.
+func encodeTagging(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = uriEncode(key, true) + "=" + uriEncode(tags[key], true)
+	}
+	return strings.Join(parts, "&")
+}
+
+// metadataSize is what S3 counts against its metadata limit: the names, without the x-amz-meta-
+// prefix, and values of every metadata header.
+func metadataSize(headers map[string]string) int {
+	size := 0
+	for name, value := range headers {
+		if after, ok := strings.CutPrefix(name, metadataPrefix); ok {
+			size += len(after) + len(value)
+		}
+	}
+	return size
+}
+
+type tagging struct {
+	TagSet []struct {
+		Key   string `xml:"Key"`
+		Value string `xml:"Value"`
+	} `xml:"TagSet>Tag"`
+}
+
+func (s *s3) GetObjectTagging(ctx context.Context, objectKey string) (map[string]string, error) {
+	attrs := []attribute.KeyValue{semconv.AWSS3Key(objectKey)}
+	resp, err := s.do(ctx, "GetObjectTagging", attrs, func(ctx context.Context) (*http.Request, error) {
+		return s.signRequest(ctx, http.MethodGet, objectKey, url.Values{"tagging": {""}}, nil, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var t tagging
+	if err := xml.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(t.TagSet))
+	for _, tag := range t.TagSet {
+		tags[tag.Key] = tag.Value
+	}
+	return tags, nil
+}
@@ -0,0 +1,182 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ETag        string
+	ContentType string
+	// ContentEncoding is the encoding of the stored content, e.g. "gzip" for compressed uploads.
+	ContentEncoding string
+	LastModified    time.Time
+	// Metadata holds the x-amz-meta-* headers without their prefix. It is only set by HeadObject;
+	// bucket listings do not include metadata.
+	Metadata   map[string]string
+	TagCount   int
+	Encryption EncryptionMode
+}
+
+// Tenant returns the tenant recorded when the object was uploaded.
+func (o ObjectInfo) Tenant() string {
+	return o.Metadata["tenant"]
+}
+
+// OriginalFileName returns the filename the object was uploaded with.
+func (o ObjectInfo) OriginalFileName() string {
+	return o.Metadata["original-filename"]
+}
+
+// UserMetadata returns the metadata supplied by the uploader, without the entries the API records
+// itself.
+func (o ObjectInfo) UserMetadata() map[string]string {
+	metadata := map[string]string{}
+	for name, value := range o.Metadata {
+		if !reservedMetadata[name] {
+			metadata[name] = value
+		}
+	}
+	return metadata
+}
+
+func (s *s3) HeadObject(ctx context.Context, objectKey string) (ObjectInfo, error) {
+	attrs := []attribute.KeyValue{semconv.AWSS3Key(objectKey)}
+	resp, err := s.do(ctx, "HeadObject", attrs, func(ctx context.Context) (*http.Request, error) {
+		return s.signRequest(ctx, http.MethodHead, objectKey, nil, nil, readHeaders(ctx))
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+	return objectInfo(objectKey, resp), nil
+}
+
+// GetObject streams an object's content. The caller must close the returned body.
+func (s *s3) GetObject(ctx context.Context, objectKey string) (io.ReadCloser, ObjectInfo, error) {
+	attrs := []attribute.KeyValue{semconv.AWSS3Key(objectKey)}
+	resp, err := s.do(ctx, "GetObject", attrs, func(ctx context.Context) (*http.Request, error) {
+		req, err := s.signRequest(ctx, http.MethodGet, objectKey, nil, nil, readHeaders(ctx))
+		if err != nil {
+			return nil, err
+		}
+		// Stops the transport from transparently decompressing gzip content, so the body is
+		// returned as stored along with its Content-Encoding.
+		req.Header.Set("Accept-Encoding", "identity")
+		return req, nil
+	})
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return resp.Body, objectInfo(objectKey, resp), nil
+}
+
+// readHeaders returns the headers needed to read an object, which are the SSE-C headers when ctx
+// carries a customer key.
+func readHeaders(ctx context.Context) map[string]string {
+	headers := map[string]string{}
+	if key := customerKey(ctx); key != nil {
+		customerKeyHeaders(headers, key)
+	}
+	return headers
+}
+
+func objectInfo(objectKey string, resp *http.Response) ObjectInfo {
+	info := ObjectInfo{
+		Key:             objectKey,
+		Size:            resp.ContentLength,
+		ETag:            resp.Header.Get("ETag"),
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
+		Metadata:        map[string]string{},
+	}
+	info.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	info.TagCount, _ = strconv.Atoi(resp.Header.Get(taggingCountHeader))
+	info.Encryption = encryptionMode(resp.Header)
+	decoder := new(mime.WordDecoder)
+	for name, values := range resp.Header {
+		lower := strings.ToLower(name)
+		if !strings.HasPrefix(lower, metadataPrefix) || len(values) == 0 {
+			continue
+		}
+		value, err := decoder.DecodeHeader(values[0])
+		if err != nil {
+			value = values[0]
+		}
+		info.Metadata[strings.TrimPrefix(lower, metadataPrefix)] = value
+	}
+	return info
+}
+
+func (s *s3) DeleteObject(ctx context.Context, objectKey string) error {
+	attrs := []attribute.KeyValue{semconv.AWSS3Key(objectKey)}
+	resp, err := s.do(ctx, "DeleteObject", attrs, func(ctx context.Context) (*http.Request, error) {
+		return s.signRequest(ctx, http.MethodDelete, objectKey, nil, nil, nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		ETag         string    `xml:"ETag"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+// ListObjects calls fn for every object under prefix, following ListObjectsV2 pagination. It
+// stops at the first error returned by fn.
+func (s *s3) ListObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, "ListObjectsV2", nil, func(ctx context.Context) (*http.Request, error) {
+			return s.signRequest(ctx, http.MethodGet, "", query, nil, nil)
+		})
+		if err != nil {
+			return err
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, c := range page.Contents {
+			info := ObjectInfo{Key: c.Key, Size: c.Size, ETag: c.ETag, LastModified: c.LastModified}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
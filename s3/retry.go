@@ -0,0 +1,193 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	retryCost   = 5
+	retryRefund = 1
+)
+
+// RetryPolicy controls how failed S3 requests are retried. Delays grow exponentially from
+// BaseDelay up to MaxDelay with full jitter. BudgetTokens caps how many retries the client may
+// issue while S3 keeps failing: every retry costs retryCost tokens and every success refunds
+// retryRefund, so a sustained outage quickly stops amplifying traffic.
+type RetryPolicy struct {
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	BudgetTokens int
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  3,
+	BaseDelay:    100 * time.Millisecond,
+	MaxDelay:     5 * time.Second,
+	BudgetTokens: 500,
+}
+
+type retryBudget struct {
+	mu       sync.Mutex
+	tokens   int
+	capacity int
+}
+
+func newRetryBudget(capacity int) *retryBudget {
+	return &retryBudget{tokens: capacity, capacity: capacity}
+}
+
+func (b *retryBudget) acquire() bool {
+	if b.capacity <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < retryCost {
+		return false
+	}
+	b.tokens -= retryCost
+	return true
+}
+
+func (b *retryBudget) refund() {
+	if b.capacity <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.capacity, b.tokens+retryRefund)
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay << min(attempt, 30)
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay <= 0) {
+		delay = p.MaxDelay
+	}
+	return rand.N(delay + 1)
+}
+
+func isRetryable(err error) bool {
+	var s3Err *Error
+	if errors.As(err, &s3Err) {
+		switch s3Err.Code {
+		case "SlowDown", "InternalError", "RequestTimeout", "ServiceUnavailable", "Throttling", "ThrottlingException":
+			return true
+		}
+		switch s3Err.StatusCode {
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return false
+	}
+	// Anything that is not an S3 error response is a transport failure.
+	return err != nil
+}
+
+func retryReason(err error) string {
+	var s3Err *Error
+	if errors.As(err, &s3Err) {
+		if s3Err.Code != "" {
+			return s3Err.Code
+		}
+		return strconv.Itoa(s3Err.StatusCode)
+	}
+	return "network_error"
+}
+
+// do sends the request built by newRequest, re-building and re-signing it for every attempt so
+// the signature date and the body reader are always fresh. Non-2xx responses are returned as *Error.
+func (s *s3) do(ctx context.Context, operation string, attrs []attribute.KeyValue, newRequest func(context.Context) (*http.Request, error)) (*http.Response, error) {
+	ctx, span := s.tracer.Start(ctx, "S3."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(s.operationAttributes(operation)...),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+
+	resp, err := s.retry(ctx, operation, newRequest)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return resp, err
+}
+
+func (s *s3) retry(ctx context.Context, operation string, newRequest func(context.Context) (*http.Request, error)) (*http.Response, error) {
+	maxAttempts := max(s.retryPolicy.MaxAttempts, 1)
+	span := trace.SpanFromContext(ctx)
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			if !isRetryable(lastErr) || !s.retryBudget.acquire() {
+				break
+			}
+			reason := retryReason(lastErr)
+			delay := s.retryPolicy.backoff(attempt - 1)
+			s.metrics.ObserveS3Retry(operation, reason)
+			span.AddEvent("retry", trace.WithAttributes(
+				attribute.String("retry.reason", reason),
+				attribute.Int64("retry.backoff_ms", delay.Milliseconds()),
+			))
+			if err := sleep(ctx, delay); err != nil {
+				return nil, err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		req, err := newRequest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req, attemptSpan := s.startAttempt(req, attempt)
+		start := time.Now()
+		resp, err := s.httpClient.Do(req)
+		endAttempt(attemptSpan, resp, err)
+		if err != nil {
+			s.metrics.ObserveS3Request(operation, 0, time.Since(start))
+			if ctx.Err() != nil {
+				// The caller went away or ran out of time; retrying cannot help.
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		s.metrics.ObserveS3Request(operation, resp.StatusCode, time.Since(start))
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			s.retryBudget.refund()
+			return resp, nil
+		}
+		lastErr = parseError(resp)
+		resp.Body.Close()
+	}
+	return nil, lastErr
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -2,63 +2,165 @@ package s3
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/haithamswe/multi-protocol-upload-api/metrics"
+	"github.com/haithamswe/multi-protocol-upload-api/objectkey"
 	"github.com/haithamswe/multi-protocol-upload-api/utils/hashutil"
 	"github.com/haithamswe/multi-protocol-upload-api/utils/timeutil"
 	"github.com/haithamswe/multi-protocol-upload-api/utils/uuidutil"
+	"io"
+	"maps"
+	"mime"
 	"net/http"
 	"net/url"
 	"sort"
 	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	metadataPrefix         = "x-amz-meta-"
+	originalFileNameHeader = metadataPrefix + "original-filename"
+	tenantHeader           = metadataPrefix + "tenant"
 )
 
 type s3 struct {
-	bucket    string
-	region    string
-	accessKey string
-	secretKey string
-	timeUtil  timeutil.TimeUtil
-	uuidUtil  uuidutil.UUIDUtil
+	bucket      string
+	region      string
+	accessKey   string
+	secretKey   string
+	timeUtil    timeutil.TimeUtil
+	uuidUtil    uuidutil.UUIDUtil
+	keyStrategy objectkey.Strategy
+	httpClient  *http.Client
+	retryPolicy RetryPolicy
+	retryBudget *retryBudget
+	metrics     metrics.Metrics
+	tracer      trace.Tracer
+	// reservedPrefix is kept for objects stored with UploadOptions.Reserved.
+	reservedPrefix string
+}
+
+type Option func(*s3)
+
+func WithKeyStrategy(keyStrategy objectkey.Strategy) Option {
+	return func(s *s3) {
+		s.keyStrategy = keyStrategy
+	}
+}
+
+var ErrReservedKey = errors.New("object key is reserved")
+
+// ErrKeyConflict is returned by uploads whose generated key is taken by another tenant's object,
+// or was replaced while the upload was in flight.
+var ErrKeyConflict = errors.New("object key is in use by another upload")
+
+// WithReservedPrefix keeps keys under prefix for uploads that set UploadOptions.Reserved. Other
+// uploads whose key falls under it, whatever key template or tenant produced it, fail with
+// ErrReservedKey.
+func WithReservedPrefix(prefix string) Option {
+	return func(s *s3) {
+		s.reservedPrefix = prefix
+	}
+}
+
+// WithHTTPClient shares one tuned client, and therefore one connection pool, across all requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(s *s3) {
+		s.httpClient = httpClient
+	}
+}
+
+func WithMetrics(m metrics.Metrics) Option {
+	return func(s *s3) {
+		s.metrics = m
+	}
+}
+
+func WithRetryPolicy(retryPolicy RetryPolicy) Option {
+	return func(s *s3) {
+		s.retryPolicy = retryPolicy
+	}
 }
 
 type S3 interface {
-	PresignUrl(objectKey string, expires int64) string
-	Upload(fileData []byte, fileName string) (string, error)
+	PresignUrl(ctx context.Context, objectKey string, expires int64) string
+	Upload(ctx context.Context, fileData []byte, fileName string, opts UploadOptions) (UploadResult, error)
+	HeadBucket(ctx context.Context) error
+	HeadObject(ctx context.Context, objectKey string) (ObjectInfo, error)
+	DeleteObject(ctx context.Context, objectKey string) error
+	ListObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+	GetObjectTagging(ctx context.Context, objectKey string) (map[string]string, error)
+	GetObject(ctx context.Context, objectKey string) (io.ReadCloser, ObjectInfo, error)
 }
 
-func (s s3) PresignUrl(objectKey string, expires int64) string {
+type UploadOptions struct {
+	ContentType string
+	// ContentEncoding is stored as the object's Content-Encoding, for content that is compressed.
+	ContentEncoding string
+	KeyPrefix       string
+	// Key replaces the key generated by the key strategy. KeyPrefix still applies. Unlike generated
+	// keys, it is not checked against objects of other tenants.
+	Key string
+	// Reserved allows the key to fall under the prefix given to WithReservedPrefix.
+	Reserved bool
+	Tenant   string
+	// Metadata is stored as x-amz-meta-* headers and Tags as S3 object tags. Both are validated
+	// with ValidateMetadata and ValidateTags.
+	Metadata map[string]string
+	Tags     map[string]string
+	// SystemMetadata is stored like Metadata, under names the API reserves for itself.
+	SystemMetadata map[string]string
+	// Checksums are digests supplied by the client. Upload fails with ErrBadDigest when fileData
+	// does not match them.
+	Checksums  Checksums
+	Encryption Encryption
+}
+
+type UploadResult struct {
+	Key  string
+	ETag string
+	// Checksums are computed from the uploaded data.
+	Checksums Checksums
+}
+
+func (s s3) PresignUrl(ctx context.Context, objectKey string, expires int64) string {
+	_, span := s.tracer.Start(ctx, "S3.Presign", trace.WithAttributes(semconv.AWSS3Bucket(s.bucket), semconv.AWSS3Key(objectKey)))
+	defer span.End()
+
 	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", s.bucket, s.region)
-	canonicalURI := "/" + objectKey
+	canonicalURI := canonicalURI(objectKey)
 
 	t := s.timeUtil.Now().UTC()
 	amzDate := t.Format("20060102T150405Z")
 	dateStamp := t.Format("20060102")
 
-	queryParams := map[string]string{
-		"X-Amz-Algorithm":      "AWS4-HMAC-SHA256",
-		"X-Amz-Credential":     fmt.Sprintf("%s/%s/%s/%s/aws4_request", s.accessKey, dateStamp, s.region, "s3"),
-		"X-Amz-Date":           amzDate,
-		"X-Amz-Expires":        fmt.Sprintf("%d", expires),
-		"X-Amz-SignedHeaders":  "host",
-		"X-Amz-Content-Sha256": "UNSIGNED-PAYLOAD",
-	}
-
-	var keys []string
-	for k := range queryParams {
-		keys = append(keys, k)
+	headers := map[string]string{"host": host}
+	if key := customerKey(ctx); key != nil {
+		// The URL only works for requests that send the same SSE-C headers.
+		customerKeyHeaders(headers, key)
 	}
-	sort.Strings(keys)
-	var canonicalQueryParts []string
-	for _, k := range keys {
-		canonicalQueryParts = append(canonicalQueryParts, fmt.Sprintf("%s=%s", url.QueryEscape(k), url.QueryEscape(queryParams[k])))
+	signedHeaders := strings.Join(sortedKeys(headers), ";")
+
+	queryParams := url.Values{
+		"X-Amz-Algorithm":      {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":     {fmt.Sprintf("%s/%s/%s/%s/aws4_request", s.accessKey, dateStamp, s.region, "s3")},
+		"X-Amz-Date":           {amzDate},
+		"X-Amz-Expires":        {fmt.Sprintf("%d", expires)},
+		"X-Amz-SignedHeaders":  {signedHeaders},
+		"X-Amz-Content-Sha256": {"UNSIGNED-PAYLOAD"},
 	}
-	canonicalQueryString := strings.Join(canonicalQueryParts, "&")
+	canonicalQueryString := canonicalQueryString(queryParams)
 
-	canonicalHeaders := fmt.Sprintf("host:%s\n", host)
-	signedHeaders := "host"
 	payloadHash := "UNSIGNED-PAYLOAD"
-	canonicalRequest := fmt.Sprintf("GET\n%s\n%s\n%s\n%s\n%s", canonicalURI, canonicalQueryString, canonicalHeaders, signedHeaders, payloadHash)
+	canonicalRequest := buildCanonicalRequest(http.MethodGet, canonicalURI, canonicalQueryString, headers, signedHeaders, payloadHash)
 	hashedCanonicalRequest := hashutil.HashSHA256([]byte(canonicalRequest))
 
 	credentialScope := fmt.Sprintf("%s/%s/%s/aws4_request", dateStamp, s.region, "s3")
@@ -69,41 +171,156 @@ func (s s3) PresignUrl(objectKey string, expires int64) string {
 
 	finalQueryString := canonicalQueryString + "&" + "X-Amz-Signature=" + signature
 
-	presignedURL := fmt.Sprintf("https://%s%s?%s", host, canonicalURI, finalQueryString)
-
-	return presignedURL
+	return objectURL(host, objectKey, finalQueryString).String()
 }
 
-func (s *s3) Upload(fileData []byte, fileName string) (string, error) {
-	if fileName == "" {
-		fileName = "default_filename"
+func (s *s3) Upload(ctx context.Context, fileData []byte, fileName string, opts UploadOptions) (UploadResult, error) {
+	checksums := ComputeChecksums(fileData)
+	if err := checksums.Verify(opts.Checksums); err != nil {
+		return UploadResult{}, err
 	}
-	objectKey := fmt.Sprintf("%s_%s", s.uuidUtil.Generate(), fileName)
 
-	req, err := s.signRequest(objectKey, fileData)
-	if err != nil {
-		return "", err
+	objectKey := opts.Key
+	if objectKey == "" {
+		objectKey = s.keyStrategy.Key(objectkey.Input{
+			FileName: fileName,
+			Tenant:   opts.Tenant,
+			Data:     fileData,
+		})
+	}
+	objectKey = opts.KeyPrefix + objectKey
+	if s.reservedPrefix != "" && !opts.Reserved && strings.HasPrefix(objectKey, s.reservedPrefix) {
+		return UploadResult{}, fmt.Errorf("%w: %s", ErrReservedKey, objectKey)
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	headers := map[string]string{}
+	if opts.ContentType != "" {
+		headers["content-type"] = opts.ContentType
+	}
+	if opts.ContentEncoding != "" {
+		headers["content-encoding"] = opts.ContentEncoding
+	}
+	if fileName != "" {
+		// S3 user metadata must be US-ASCII, so non-ASCII names are RFC 2047 encoded.
+		headers[originalFileNameHeader] = mime.QEncoding.Encode("utf-8", fileName)
+	}
+	if opts.Tenant != "" {
+		// Recorded so usage can be attributed to tenants when it is rebuilt from a bucket listing.
+		headers[tenantHeader] = mime.QEncoding.Encode("utf-8", opts.Tenant)
+	}
+	if err := ValidateMetadata(opts.Metadata); err != nil {
+		return UploadResult{}, err
+	}
+	for name, value := range opts.Metadata {
+		headers[metadataPrefix+name] = mime.QEncoding.Encode("utf-8", value)
+	}
+	for name, value := range opts.SystemMetadata {
+		headers[metadataPrefix+name] = mime.QEncoding.Encode("utf-8", value)
+	}
+	// The limit applies to the encoded headers, including the ones set above.
+	if size := metadataSize(headers); size > MaxMetadataBytes {
+		return UploadResult{}, fmt.Errorf("%w: %d bytes exceeds the %d byte limit", ErrInvalidMetadata, size, MaxMetadataBytes)
+	}
+	if err := ValidateTags(opts.Tags); err != nil {
+		return UploadResult{}, err
+	}
+	if err := opts.Encryption.Validate(); err != nil {
+		return UploadResult{}, err
+	}
+	tags := opts.Tags
+	if opts.Encryption.Mode == EncryptionCustomer && opts.Tenant != "" {
+		// Usage rebuilds cannot read the tenant metadata of SSE-C objects, but can read their tags.
+		tags = maps.Clone(tags)
+		if tags == nil {
+			tags = map[string]string{}
+		}
+		tags[TenantTag] = opts.Tenant
+		if len(tags) > MaxTags {
+			return UploadResult{}, fmt.Errorf("%w: SSE-C uploads allow at most %d tags", ErrInvalidTags, MaxTags-1)
+		}
+	}
+	if len(tags) > 0 {
+		headers[taggingHeader] = encodeTagging(tags)
+	}
+	opts.Encryption.headers(headers)
+	checksumHeaders(headers, checksums, opts.Checksums)
+	if opts.Key == "" && !objectkey.Unique(s.keyStrategy) {
+		// Generated keys can repeat, so the upload may replace an object, but only one of its own
+		// tenant.
+		if err := s.claimKey(ctx, objectKey, opts.Tenant, headers); err != nil {
+			return UploadResult{}, err
+		}
+	}
+
+	attrs := []attribute.KeyValue{semconv.AWSS3Key(objectKey), attribute.Int("upload.size", len(fileData))}
+	resp, err := s.do(ctx, "PutObject", attrs, func(ctx context.Context) (*http.Request, error) {
+		return s.signRequest(ctx, http.MethodPut, objectKey, nil, fileData, headers)
+	})
+	var s3Err *Error
+	if errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusPreconditionFailed {
+		return UploadResult{}, fmt.Errorf("%w: %s was replaced during the upload", ErrKeyConflict, objectKey)
+	}
 	if err != nil {
-		return "", err
+		return UploadResult{}, err
 	}
-	defer resp.Body.Close()
+	resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error from S3, status code: %d", resp.StatusCode)
+	return UploadResult{Key: objectKey, ETag: resp.Header.Get("ETag"), Checksums: checksums}, nil
+}
+
+// HeadBucket checks that the bucket exists and that the credentials may access it.
+// claimKey fails with ErrKeyConflict when objectKey holds an object of a tenant other than
+// tenant. Otherwise it adds the conditional header that makes the PUT fail should the object
+// change before it completes.
+func (s *s3) claimKey(ctx context.Context, objectKey, tenant string, headers map[string]string) error {
+	info, err := s.HeadObject(ctx, objectKey)
+	var s3Err *Error
+	switch {
+	case err == nil:
+		if info.Tenant() != tenant {
+			return fmt.Errorf("%w: %s belongs to another tenant", ErrKeyConflict, objectKey)
+		}
+		headers["if-match"] = info.ETag
+		return nil
+	case errors.As(err, &s3Err) && (s3Err.Code == "NoSuchKey" || s3Err.StatusCode == http.StatusNotFound):
+		headers["if-none-match"] = "*"
+		return nil
+	case errors.As(err, &s3Err) && s3Err.Code == "" && s3Err.StatusCode == http.StatusBadRequest:
+		// SSE-C objects cannot be read without their key, but their tenant is also kept as a tag.
+		// Tags carry no ETag, so the PUT is unconditional.
+		tags, err := s.GetObjectTagging(ctx, objectKey)
+		if err != nil {
+			return err
+		}
+		if tags[TenantTag] != tenant {
+			return fmt.Errorf("%w: %s belongs to another tenant", ErrKeyConflict, objectKey)
+		}
+		return nil
 	}
+	return err
+}
 
-	return objectKey, nil
+func (s *s3) HeadBucket(ctx context.Context) error {
+	resp, err := s.do(ctx, "HeadBucket", nil, func(ctx context.Context) (*http.Request, error) {
+		return s.signRequest(ctx, http.MethodHead, "", nil, nil, nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
 }
 
-func (s *s3) signRequest(objectKey string, payload []byte) (*http.Request, error) {
+func (s *s3) signRequest(ctx context.Context, method, objectKey string, query url.Values, payload []byte, extraHeaders map[string]string) (*http.Request, error) {
+	// Hashing the payload is the expensive part of signing large uploads.
+	_, span := s.tracer.Start(ctx, "S3.Sign")
+	defer span.End()
+
 	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", s.bucket, s.region)
-	endpoint := fmt.Sprintf("https://%s/%s", host, objectKey)
+	canonicalQueryString := canonicalQueryString(query)
+	endpoint := objectURL(host, objectKey, canonicalQueryString)
 
-	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(payload))
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), bytes.NewReader(payload))
 	if err != nil {
 		return nil, err
 	}
@@ -117,14 +334,17 @@ func (s *s3) signRequest(objectKey string, payload []byte) (*http.Request, error
 	hashedPayload := hashutil.HashSHA256(payload)
 	req.Header.Set("x-amz-content-sha256", hashedPayload)
 
-	canonicalURI := "/" + objectKey
-	canonicalQueryString := ""
+	canonicalURI := canonicalURI(objectKey)
 
 	headersForSigning := map[string]string{
 		"host":                 host,
 		"x-amz-content-sha256": hashedPayload,
 		"x-amz-date":           amzDate,
 	}
+	for k, v := range extraHeaders {
+		req.Header.Set(k, v)
+		headersForSigning[strings.ToLower(k)] = v
+	}
 	var headerKeys []string
 	for k := range headersForSigning {
 		headerKeys = append(headerKeys, strings.ToLower(k))
@@ -132,7 +352,7 @@ func (s *s3) signRequest(objectKey string, payload []byte) (*http.Request, error
 	sort.Strings(headerKeys)
 	signedHeaders := strings.Join(headerKeys, ";")
 
-	canonicalRequest := buildCanonicalRequest(canonicalURI, canonicalQueryString, headersForSigning, signedHeaders, hashedPayload)
+	canonicalRequest := buildCanonicalRequest(method, canonicalURI, canonicalQueryString, headersForSigning, signedHeaders, hashedPayload)
 	hashedCanonicalRequest := hashutil.HashSHA256([]byte(canonicalRequest))
 
 	credentialScope := fmt.Sprintf("%s/%s/%s/aws4_request", dateStamp, s.region, "s3")
@@ -150,14 +370,10 @@ func (s *s3) signRequest(objectKey string, payload []byte) (*http.Request, error
 }
 
 func (s s3) getSignatureKey(dateStamp string) []byte {
-	kDate := hashutil.HmacSHA256([]byte("AWS4"+s.secretKey), []byte(dateStamp))
-	kRegion := hashutil.HmacSHA256(kDate, []byte(s.region))
-	kService := hashutil.HmacSHA256(kRegion, []byte("s3"))
-	kSigning := hashutil.HmacSHA256(kService, []byte("aws4_request"))
-	return kSigning
+	return deriveSigningKey(s.secretKey, dateStamp, s.region, "s3")
 }
 
-func buildCanonicalRequest(canonicalURI, canonicalQueryString string, headers map[string]string, signedHeaders, hashedPayload string) string {
+func buildCanonicalRequest(method, canonicalURI, canonicalQueryString string, headers map[string]string, signedHeaders, hashedPayload string) string {
 	lowerHeaders := make(map[string]string)
 	var headerKeys []string
 
@@ -175,7 +391,7 @@ func buildCanonicalRequest(canonicalURI, canonicalQueryString string, headers ma
 	}
 
 	return fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%s",
-		http.MethodPut,
+		method,
 		canonicalURI,
 		canonicalQueryString,
 		canonicalHeaders,
@@ -184,13 +400,25 @@ func buildCanonicalRequest(canonicalURI, canonicalQueryString string, headers ma
 	)
 }
 
-func NewS3(bucket, region, accessKey, secretKey string, timeUtil timeutil.TimeUtil, uuidUtil uuidutil.UUIDUtil) S3 {
-	return &s3{
-		bucket:    bucket,
-		region:    region,
-		accessKey: accessKey,
-		secretKey: secretKey,
-		timeUtil:  timeUtil,
-		uuidUtil:  uuidUtil,
+func NewS3(bucket, region, accessKey, secretKey string, timeUtil timeutil.TimeUtil, uuidUtil uuidutil.UUIDUtil, opts ...Option) S3 {
+	s := &s3{
+		bucket:      bucket,
+		region:      region,
+		accessKey:   accessKey,
+		secretKey:   secretKey,
+		timeUtil:    timeUtil,
+		uuidUtil:    uuidUtil,
+		httpClient:  &http.Client{},
+		retryPolicy: DefaultRetryPolicy,
+		metrics:     metrics.NewNoopMetrics(),
+		tracer:      otel.Tracer(tracerName),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.retryBudget = newRetryBudget(s.retryPolicy.BudgetTokens)
+	if s.keyStrategy == nil {
+		s.keyStrategy, _ = objectkey.NewStrategy(objectkey.UUIDTemplate, timeUtil, uuidUtil)
 	}
+	return s
 }
@@ -3,8 +3,11 @@ package s3
 import (
 	"encoding/hex"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetSignatureKey(t *testing.T) {
@@ -78,10 +81,61 @@ func TestBuildCanonicalRequest(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := buildCanonicalRequest(tt.canonicalURI, tt.canonicalQueryString, tt.headers, tt.signedHeaders, tt.hashedPayload)
+			result := buildCanonicalRequest(http.MethodPut, tt.canonicalURI, tt.canonicalQueryString, tt.headers, tt.signedHeaders, tt.hashedPayload)
 			if result != tt.expected {
 				t.Errorf("Test %s failed:\nExpected:\n%q\nGot:\n%q", tt.name, tt.expected, result)
 			}
 		})
 	}
 }
+
+func TestRetryBudget(t *testing.T) {
+	budget := newRetryBudget(10)
+	if !budget.acquire() || !budget.acquire() {
+		t.Fatal("Expected budget to allow two retries")
+	}
+	if budget.acquire() {
+		t.Error("Expected budget to be exhausted")
+	}
+	for i := 0; i < retryCost; i++ {
+		budget.refund()
+	}
+	if !budget.acquire() {
+		t.Error("Expected refunds to allow another retry")
+	}
+
+	unlimited := newRetryBudget(0)
+	for i := 0; i < 100; i++ {
+		if !unlimited.acquire() {
+			t.Fatal("Expected a zero budget to be unlimited")
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt := 0; attempt < 40; attempt++ {
+		delay := policy.backoff(attempt)
+		ceiling := min(policy.BaseDelay<<min(attempt, 30), policy.MaxDelay)
+		if delay < 0 || delay > ceiling {
+			t.Errorf("attempt %d: expected delay in [0, %s], got %s", attempt, ceiling, delay)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{"X-Amz-Request-Id": {"HEADER-REQ"}},
+		Body:       io.NopCloser(strings.NewReader(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)),
+	}
+	err := parseError(resp)
+	if err.Code != "NoSuchKey" || err.Message != "The specified key does not exist." || err.RequestID != "HEADER-REQ" {
+		t.Errorf("Unexpected parsed error: %+v", err)
+	}
+
+	resp = &http.Response{StatusCode: http.StatusForbidden, Header: http.Header{}, Body: http.NoBody}
+	if parseError(resp).Error() != "error from S3, status code: 403" {
+		t.Errorf("Unexpected message for empty body: %s", parseError(resp).Error())
+	}
+}
@@ -1,19 +1,32 @@
 package s3_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
+	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/haithamswe/multi-protocol-upload-api/metrics"
 	"github.com/haithamswe/multi-protocol-upload-api/mocks"
+	"github.com/haithamswe/multi-protocol-upload-api/objectkey"
 	"github.com/haithamswe/multi-protocol-upload-api/s3"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestPresignUrl(t *testing.T) {
@@ -31,7 +44,7 @@ func TestPresignUrl(t *testing.T) {
 
 	objectKey := "test.txt"
 	expires := int64(3600)
-	presignedURL := s3Instance.PresignUrl(objectKey, expires)
+	presignedURL := s3Instance.PresignUrl(context.Background(), objectKey, expires)
 
 	parsedURL, err := url.Parse(presignedURL)
 	assert.NoError(t, err)
@@ -50,6 +63,23 @@ func TestPresignUrl(t *testing.T) {
 	mockTimeUtil.AssertExpectations(t)
 }
 
+func TestPresignUrl_EncodesObjectKey(t *testing.T) {
+	fixedTime := time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC)
+	mockTimeUtil := mocks.NewTimeUtil(t)
+	mockTimeUtil.On("Now").Return(fixedTime)
+
+	s3Instance := s3.NewS3("testbucket", "us-test-1", "TESTACCESSKEY", "TESTSECRETKEY", mockTimeUtil, mocks.NewUUIDUtil(t))
+
+	presignedURL := s3Instance.PresignUrl(context.Background(), "2025/my file+v2 ሴ.txt", 3600)
+
+	parsedURL, err := url.Parse(presignedURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "/2025/my%20file%2Bv2%20%E1%88%B4.txt", parsedURL.EscapedPath())
+	assert.Equal(t, "/2025/my file+v2 ሴ.txt", parsedURL.Path)
+	assert.Equal(t, "TESTACCESSKEY/20250224/us-test-1/s3/aws4_request", parsedURL.Query().Get("X-Amz-Credential"))
+	assert.Contains(t, parsedURL.RawQuery, "X-Amz-Credential=TESTACCESSKEY%2F20250224%2Fus-test-1%2Fs3%2Faws4_request")
+}
+
 func TestUpload(t *testing.T) {
 	fixedTime := time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC)
 	fixedUUID := "fixed-uuid"
@@ -66,30 +96,1000 @@ func TestUpload(t *testing.T) {
 	secretKey := "TESTSECRETKEY"
 	s3Instance := s3.NewS3(bucket, region, accessKey, secretKey, mockTimeUtil, mockUUIDUtil)
 
-	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	var receivedContentType, receivedSignedHeaders, receivedOriginalName string
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedContentType = r.Header.Get("Content-Type")
+		receivedSignedHeaders = r.Header.Get("Authorization")
+		receivedOriginalName = r.Header.Get("X-Amz-Meta-Original-Filename")
 		w.WriteHeader(http.StatusOK)
 		io.WriteString(w, "OK")
 	}))
-	defer ts.Close()
-
-	origTransport := http.DefaultTransport
-	defer func() { http.DefaultTransport = origTransport }()
-
-	http.DefaultTransport = &http.Transport{
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return net.Dial(network, ts.Listener.Addr().String())
-		},
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
 
 	fileContent := []byte("file content")
 	fileName := "filename.txt"
-	objectKey, err := s3Instance.Upload(fileContent, fileName)
+	result, err := s3Instance.Upload(context.Background(), fileContent, fileName, s3.UploadOptions{ContentType: "text/plain; charset=utf-8"})
 	assert.NoError(t, err)
 
 	expectedObjectKey := fixedUUID + "_" + fileName
-	assert.Equal(t, expectedObjectKey, objectKey)
+	assert.Equal(t, expectedObjectKey, result.Key)
+	assert.Equal(t, "text/plain; charset=utf-8", receivedContentType)
+	assert.Equal(t, fileName, receivedOriginalName)
+	assert.Contains(t, receivedSignedHeaders, "SignedHeaders=content-md5;content-type;host;x-amz-checksum-sha256;x-amz-content-sha256;x-amz-date;x-amz-meta-original-filename,")
 
 	mockTimeUtil.AssertExpectations(t)
 	mockUUIDUtil.AssertExpectations(t)
 }
+
+func TestUpload_KeyStrategy(t *testing.T) {
+	fixedTime := time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC)
+
+	mockTimeUtil := mocks.NewTimeUtil(t)
+	mockTimeUtil.On("Now").Return(fixedTime)
+
+	mockUUIDUtil := mocks.NewUUIDUtil(t)
+	mockUUIDUtil.On("Generate").Return("fixed-uuid")
+
+	strategy, err := objectkey.NewStrategy("{tenant}/{yyyy}/{mm}/{uuid}{ext}", mockTimeUtil, mockUUIDUtil)
+	assert.NoError(t, err)
+	s3Instance := s3.NewS3("testbucket", "us-test-1", "TESTACCESSKEY", "TESTSECRETKEY", mockTimeUtil, mockUUIDUtil, s3.WithKeyStrategy(strategy))
+
+	var receivedPath, receivedOriginalName string
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedPath = r.URL.Path
+		receivedOriginalName = r.Header.Get("X-Amz-Meta-Original-Filename")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	result, err := s3Instance.Upload(context.Background(), []byte("file content"), "../Résumé final.pdf", s3.UploadOptions{Tenant: "acme"})
+	assert.NoError(t, err)
+	assert.Equal(t, "acme/2025/02/fixed-uuid.pdf", result.Key)
+	assert.Equal(t, "/acme/2025/02/fixed-uuid.pdf", receivedPath)
+
+	decodedName, err := new(mime.WordDecoder).DecodeHeader(receivedOriginalName)
+	assert.NoError(t, err)
+	assert.Equal(t, "../Résumé final.pdf", decodedName)
+}
+
+func TestUpload_ExplicitKey(t *testing.T) {
+	s3Instance := newTestS3(t)
+
+	var receivedPath string
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedPath = r.URL.Path
+	}))
+
+	result, err := s3Instance.Upload(context.Background(), []byte("data"), "a.txt", s3.UploadOptions{KeyPrefix: "store/", Key: "blobs/abc"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "store/blobs/abc", result.Key)
+	assert.Equal(t, "/store/blobs/abc", receivedPath)
+}
+
+func TestUpload_ReservedPrefix(t *testing.T) {
+	mockTimeUtil := mocks.NewTimeUtil(t)
+	mockTimeUtil.On("Now").Return(time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC)).Maybe()
+	mockUUIDUtil := mocks.NewUUIDUtil(t)
+	mockUUIDUtil.On("Generate").Return("fixed-uuid")
+	strategy, err := objectkey.NewStrategy("{tenant}/{uuid}{ext}", mockTimeUtil, mockUUIDUtil)
+	assert.NoError(t, err)
+	s3Instance := s3.NewS3("testbucket", "us-test-1", "TESTACCESSKEY", "TESTSECRETKEY", mockTimeUtil, mockUUIDUtil,
+		s3.WithKeyStrategy(strategy), s3.WithReservedPrefix("blobs/"))
+
+	var receivedPaths []string
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedPaths = append(receivedPaths, r.URL.Path)
+	}))
+
+	// A tenant named after the prefix cannot write into it through the key template.
+	_, err = s3Instance.Upload(context.Background(), []byte("data"), "a.txt", s3.UploadOptions{Tenant: "blobs"})
+	assert.ErrorIs(t, err, s3.ErrReservedKey)
+	_, err = s3Instance.Upload(context.Background(), []byte("data"), "a.txt", s3.UploadOptions{KeyPrefix: "blobs/", Key: "abc"})
+	assert.ErrorIs(t, err, s3.ErrReservedKey)
+	assert.Empty(t, receivedPaths)
+
+	result, err := s3Instance.Upload(context.Background(), []byte("data"), "a.txt", s3.UploadOptions{Key: "blobs/acme/abc", Reserved: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "blobs/acme/abc", result.Key)
+	assert.Equal(t, []string{"/blobs/acme/abc"}, receivedPaths)
+}
+
+func TestUpload_ClaimsKey(t *testing.T) {
+	tests := []struct {
+		name              string
+		tenant            string
+		head              func(w http.ResponseWriter)
+		tags              string
+		putStatus         int
+		expectedCondition [2]string
+		expectedErr       error
+	}{
+		{
+			name:              "New key",
+			tenant:            "acme",
+			head:              func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) },
+			expectedCondition: [2]string{"If-None-Match", "*"},
+		},
+		{
+			name:   "Own object",
+			tenant: "acme",
+			head: func(w http.ResponseWriter) {
+				w.Header().Set("ETag", `"abc"`)
+				w.Header().Set("X-Amz-Meta-Tenant", "acme")
+			},
+			expectedCondition: [2]string{"If-Match", `"abc"`},
+		},
+		{
+			name:   "Object of another tenant",
+			tenant: "globex",
+			head: func(w http.ResponseWriter) {
+				w.Header().Set("ETag", `"abc"`)
+				w.Header().Set("X-Amz-Meta-Tenant", "acme")
+			},
+			expectedErr: s3.ErrKeyConflict,
+		},
+		{
+			name:        "SSE-C object of another tenant",
+			tenant:      "globex",
+			head:        func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadRequest) },
+			tags:        `<Tagging><TagSet><Tag><Key>upload-tenant</Key><Value>acme</Value></Tag></TagSet></Tagging>`,
+			expectedErr: s3.ErrKeyConflict,
+		},
+		{
+			name:        "Replaced during the upload",
+			tenant:      "acme",
+			head:        func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) },
+			putStatus:   http.StatusPreconditionFailed,
+			expectedErr: s3.ErrKeyConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTimeUtil := mocks.NewTimeUtil(t)
+			mockTimeUtil.On("Now").Return(time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC))
+			strategy, err := objectkey.NewStrategy("content-hash", mockTimeUtil, nil)
+			assert.NoError(t, err)
+			s3Instance := s3.NewS3("testbucket", "us-test-1", "TESTACCESSKEY", "TESTSECRETKEY", mockTimeUtil, mocks.NewUUIDUtil(t), s3.WithKeyStrategy(strategy))
+
+			var put *http.Request
+			useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodHead:
+					tt.head(w)
+				case r.URL.Query().Has("tagging"):
+					io.WriteString(w, tt.tags)
+				default:
+					put = r
+					if tt.putStatus != 0 {
+						w.WriteHeader(tt.putStatus)
+					}
+				}
+			}))
+
+			result, err := s3Instance.Upload(context.Background(), []byte("hello"), "hello.txt", s3.UploadOptions{Tenant: tt.tenant})
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.tenant+"/2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824.txt", result.Key)
+			assert.Equal(t, tt.expectedCondition[1], put.Header.Get(tt.expectedCondition[0]))
+		})
+	}
+}
+
+func TestUpload_Retries(t *testing.T) {
+	fixedTime := time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		responses        []int
+		errorCode        string
+		expectedAttempts int
+		expectedErr      bool
+	}{
+		{name: "Succeeds after SlowDown", responses: []int{503, 503, 200}, errorCode: "SlowDown", expectedAttempts: 3},
+		{name: "Succeeds after InternalError", responses: []int{500, 200}, errorCode: "InternalError", expectedAttempts: 2},
+		{name: "Gives up after max attempts", responses: []int{503, 503, 503, 503}, errorCode: "SlowDown", expectedAttempts: 3, expectedErr: true},
+		{name: "Does not retry AccessDenied", responses: []int{403, 200}, errorCode: "AccessDenied", expectedAttempts: 1, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTimeUtil := mocks.NewTimeUtil(t)
+			mockTimeUtil.On("Now").Return(fixedTime)
+			mockUUIDUtil := mocks.NewUUIDUtil(t)
+			mockUUIDUtil.On("Generate").Return("fixed-uuid")
+
+			m := metrics.NewPrometheusMetrics(10)
+			s3Instance := s3.NewS3("testbucket", "us-test-1", "TESTACCESSKEY", "TESTSECRETKEY", mockTimeUtil, mockUUIDUtil,
+				s3.WithRetryPolicy(s3.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, BudgetTokens: 100}),
+				s3.WithMetrics(m))
+
+			attempts := 0
+			var receivedBodies []string
+			useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				receivedBodies = append(receivedBodies, string(body))
+				status := tt.responses[attempts]
+				attempts++
+				if status == http.StatusOK {
+					w.WriteHeader(status)
+					return
+				}
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(status)
+				io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>`+tt.errorCode+`</Code><Message>Please reduce your request rate.</Message><RequestId>REQ123</RequestId><HostId>HOST456</HostId></Error>`)
+			}))
+
+			result, err := s3Instance.Upload(context.Background(), []byte("file content"), "test.txt", s3.UploadOptions{})
+
+			assert.Equal(t, tt.expectedAttempts, attempts)
+			rec := httptest.NewRecorder()
+			m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			assert.Contains(t, rec.Body.String(), fmt.Sprintf(`upload_api_s3_requests_total{operation="PutObject",status="%d"}`, tt.responses[0]))
+			if tt.expectedAttempts > 1 {
+				assert.Contains(t, rec.Body.String(), fmt.Sprintf(`upload_api_s3_retries_total{operation="PutObject",reason="%s"} %d`, tt.errorCode, tt.expectedAttempts-1))
+			}
+			for _, body := range receivedBodies {
+				assert.Equal(t, "file content", body)
+			}
+			if !tt.expectedErr {
+				assert.NoError(t, err)
+				assert.Equal(t, "fixed-uuid_test.txt", result.Key)
+				return
+			}
+			var s3Err *s3.Error
+			assert.ErrorAs(t, err, &s3Err)
+			assert.Equal(t, tt.responses[attempts-1], s3Err.StatusCode)
+			assert.Equal(t, tt.errorCode, s3Err.Code)
+			assert.Equal(t, "Please reduce your request rate.", s3Err.Message)
+			assert.Equal(t, "REQ123", s3Err.RequestID)
+			assert.Equal(t, "HOST456", s3Err.HostID)
+		})
+	}
+}
+
+func TestUpload_RetriesNetworkErrors(t *testing.T) {
+	mockTimeUtil := mocks.NewTimeUtil(t)
+	mockTimeUtil.On("Now").Return(time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC))
+	mockUUIDUtil := mocks.NewUUIDUtil(t)
+	mockUUIDUtil.On("Generate").Return("fixed-uuid")
+
+	s3Instance := s3.NewS3("testbucket", "us-test-1", "TESTACCESSKEY", "TESTSECRETKEY", mockTimeUtil, mockUUIDUtil,
+		s3.WithRetryPolicy(s3.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}))
+
+	attempts := 0
+	ts := useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.Config.SetKeepAlivesEnabled(false)
+
+	_, err := s3Instance.Upload(context.Background(), []byte("file content"), "test.txt", s3.UploadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestUpload_ContextCancellation(t *testing.T) {
+	// Hashing a large payload takes a while, so streaming cancellation is timed from the moment the
+	// server sees the request rather than from the start of the upload.
+	streaming := make(chan struct{}, 1)
+	tests := []struct {
+		name        string
+		handler     func(w http.ResponseWriter, r *http.Request)
+		payloadSize int
+		policy      s3.RetryPolicy
+		newContext  func() (context.Context, context.CancelFunc)
+		expectedErr error
+	}{
+		{
+			name: "Canceled while streaming the body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				// Drain the body at a trickle, like an S3 endpoint on a congested link, until the
+				// client gives up or the test server shuts down.
+				select {
+				case streaming <- struct{}{}:
+				default:
+				}
+				buf := make([]byte, 1024)
+				for stop := time.Now().Add(time.Second); time.Now().Before(stop); {
+					if _, err := r.Body.Read(buf); err != nil {
+						return
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			},
+			payloadSize: 32 << 20,
+			policy:      s3.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			newContext: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				go func() {
+					select {
+					case <-streaming:
+						time.Sleep(50 * time.Millisecond)
+						cancel()
+					case <-ctx.Done():
+					}
+				}()
+				return ctx, cancel
+			},
+			expectedErr: context.Canceled,
+		},
+		{
+			name: "Deadline while waiting for the response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				<-r.Context().Done()
+			},
+			payloadSize: 1024,
+			policy:      s3.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			newContext: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+			expectedErr: context.DeadlineExceeded,
+		},
+		{
+			name: "Canceled during retry backoff",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				io.WriteString(w, "<Error><Code>SlowDown</Code></Error>")
+			},
+			payloadSize: 1024,
+			policy:      s3.RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Second, MaxDelay: 10 * time.Second},
+			newContext: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(50*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			expectedErr: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTimeUtil := mocks.NewTimeUtil(t)
+			mockTimeUtil.On("Now").Return(time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC))
+			mockUUIDUtil := mocks.NewUUIDUtil(t)
+			mockUUIDUtil.On("Generate").Return("fixed-uuid")
+
+			s3Instance := s3.NewS3("testbucket", "us-test-1", "TESTACCESSKEY", "TESTSECRETKEY", mockTimeUtil, mockUUIDUtil,
+				s3.WithRetryPolicy(tt.policy))
+			useTestServer(t, http.HandlerFunc(tt.handler))
+
+			ctx, cancel := tt.newContext()
+			defer cancel()
+
+			start := time.Now()
+			_, err := s3Instance.Upload(ctx, make([]byte, tt.payloadSize), "test.bin", s3.UploadOptions{})
+
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Less(t, time.Since(start), 2*time.Second)
+		})
+	}
+}
+
+func TestHeadBucket(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		expectedErr bool
+	}{
+		{name: "Reachable", status: http.StatusOK},
+		{name: "Forbidden", status: http.StatusForbidden, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTimeUtil := mocks.NewTimeUtil(t)
+			mockTimeUtil.On("Now").Return(time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC))
+			s3Instance := s3.NewS3("testbucket", "us-test-1", "TESTACCESSKEY", "TESTSECRETKEY", mockTimeUtil, mocks.NewUUIDUtil(t))
+
+			var received *http.Request
+			useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r
+				w.Header().Set("x-amz-request-id", "REQ123")
+				w.WriteHeader(tt.status)
+			}))
+
+			err := s3Instance.HeadBucket(context.Background())
+
+			assert.Equal(t, http.MethodHead, received.Method)
+			assert.Equal(t, "testbucket.s3.us-test-1.amazonaws.com", received.Host)
+			assert.Equal(t, "/", received.URL.Path)
+			assert.Contains(t, received.Header.Get("Authorization"), "SignedHeaders=host;x-amz-content-sha256;x-amz-date")
+			if !tt.expectedErr {
+				assert.NoError(t, err)
+				return
+			}
+			var s3Err *s3.Error
+			assert.ErrorAs(t, err, &s3Err)
+			assert.Equal(t, http.StatusForbidden, s3Err.StatusCode)
+			assert.Equal(t, "REQ123", s3Err.RequestID)
+		})
+	}
+}
+
+func newTestS3(t *testing.T) s3.S3 {
+	mockTimeUtil := mocks.NewTimeUtil(t)
+	mockTimeUtil.On("Now").Return(time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC)).Maybe()
+	mockUUIDUtil := mocks.NewUUIDUtil(t)
+	mockUUIDUtil.On("Generate").Return("fixed-uuid").Maybe()
+	return s3.NewS3("testbucket", "us-test-1", "TESTACCESSKEY", "TESTSECRETKEY", mockTimeUtil, mockUUIDUtil)
+}
+
+func TestUpload_RecordsTenant(t *testing.T) {
+	s3Instance := newTestS3(t)
+
+	var receivedTenant, authorization string
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedTenant = r.Header.Get("X-Amz-Meta-Tenant")
+		authorization = r.Header.Get("Authorization")
+	}))
+
+	_, err := s3Instance.Upload(context.Background(), []byte("data"), "a.txt", s3.UploadOptions{Tenant: "acme"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", receivedTenant)
+	assert.Contains(t, authorization, ";x-amz-meta-tenant,")
+}
+
+func TestUpload_MetadataAndTags(t *testing.T) {
+	s3Instance := newTestS3(t)
+
+	var received *http.Request
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	}))
+
+	_, err := s3Instance.Upload(context.Background(), []byte("data"), "a.txt", s3.UploadOptions{
+		Metadata: map[string]string{"project": "apollo", "owner": "Zoë"},
+		Tags:     map[string]string{"team": "billing", "path": "a/b c"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "apollo", received.Header.Get("X-Amz-Meta-Project"))
+	assert.Equal(t, "=?utf-8?q?Zo=C3=AB?=", received.Header.Get("X-Amz-Meta-Owner"))
+	assert.Equal(t, "path=a%2Fb%20c&team=billing", received.Header.Get("X-Amz-Tagging"))
+	assert.Contains(t, received.Header.Get("Authorization"), ";x-amz-meta-owner;x-amz-meta-project;x-amz-tagging,")
+}
+
+func TestUpload_ContentEncoding(t *testing.T) {
+	s3Instance := newTestS3(t)
+
+	var received *http.Request
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	}))
+
+	_, err := s3Instance.Upload(context.Background(), []byte("data"), "a.log", s3.UploadOptions{
+		ContentEncoding: "zstd",
+		SystemMetadata:  map[string]string{"uncompressed-size": "4096"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "zstd", received.Header.Get("Content-Encoding"))
+	assert.Equal(t, "4096", received.Header.Get("X-Amz-Meta-Uncompressed-Size"))
+	assert.Contains(t, received.Header.Get("Authorization"), "SignedHeaders=content-encoding;")
+}
+
+func TestUpload_InvalidMetadata(t *testing.T) {
+	s3Instance := newTestS3(t)
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not be sent")
+	}))
+
+	// Each part is within the limit, but not together with the recorded filename.
+	_, err := s3Instance.Upload(context.Background(), []byte("data"), strings.Repeat("a", 100), s3.UploadOptions{
+		Metadata: map[string]string{"notes": strings.Repeat("n", s3.MaxMetadataBytes-10)},
+	})
+	assert.ErrorIs(t, err, s3.ErrInvalidMetadata)
+
+	_, err = s3Instance.Upload(context.Background(), []byte("data"), "a.txt", s3.UploadOptions{
+		Tags: map[string]string{"aws:createdBy": "me"},
+	})
+	assert.ErrorIs(t, err, s3.ErrInvalidTags)
+}
+
+func TestValidateMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		valid    bool
+	}{
+		{"valid", map[string]string{"project-id": "42", "owner_name": "Zoë Smith"}, true},
+		{"empty", nil, true},
+		{"uppercase name", map[string]string{"Project": "x"}, false},
+		{"invalid name", map[string]string{"pro ject": "x"}, false},
+		{"empty name", map[string]string{"": "x"}, false},
+		{"reserved name", map[string]string{"tenant": "other"}, false},
+		{"control character", map[string]string{"note": "a\r\nb"}, false},
+		{"invalid UTF-8", map[string]string{"note": "\xff"}, false},
+		{"too large", map[string]string{"note": strings.Repeat("x", s3.MaxMetadataBytes)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s3.ValidateMetadata(tt.metadata)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, s3.ErrInvalidMetadata)
+			}
+		})
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	tooMany := map[string]string{}
+	for i := 0; i <= s3.MaxTags; i++ {
+		tooMany[fmt.Sprintf("tag%d", i)] = "x"
+	}
+	tests := []struct {
+		name  string
+		tags  map[string]string
+		valid bool
+	}{
+		{"valid", map[string]string{"team": "billing", "path": "a/b c", "email": "a+b@example.com", "empty": ""}, true},
+		{"unicode letters", map[string]string{"équipe": "données"}, true},
+		{"too many", tooMany, false},
+		{"long key", map[string]string{strings.Repeat("k", s3.MaxTagKeyLength+1): "x"}, false},
+		{"long value", map[string]string{"k": strings.Repeat("v", s3.MaxTagValueLength+1)}, false},
+		{"reserved prefix", map[string]string{"AWS:owner": "x"}, false},
+		{"invalid character", map[string]string{"team": "a&b"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s3.ValidateTags(tt.tags)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, s3.ErrInvalidTags)
+			}
+		})
+	}
+}
+
+func TestGetObjectTagging(t *testing.T) {
+	s3Instance := newTestS3(t)
+
+	var received *http.Request
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Tagging xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><TagSet>
+<Tag><Key>team</Key><Value>billing</Value></Tag>
+<Tag><Key>draft</Key><Value></Value></Tag>
+</TagSet></Tagging>`))
+	}))
+
+	tags, err := s3Instance.GetObjectTagging(context.Background(), "report.pdf")
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodGet, received.Method)
+	assert.Equal(t, "tagging=", received.URL.RawQuery)
+	assert.Equal(t, map[string]string{"team": "billing", "draft": ""}, tags)
+}
+
+func TestComputeChecksums(t *testing.T) {
+	checksums := s3.ComputeChecksums([]byte("123456789"))
+
+	assert.Equal(t, "JfnnlDI7RTiF9RgfG2JNCw==", base64.StdEncoding.EncodeToString(checksums.MD5))
+	assert.Equal(t, "FeKw08M4keuw8e9gnsQZQgwg4yDOlMZfvIwzEkSOsiU=", base64.StdEncoding.EncodeToString(checksums.SHA256))
+	assert.Equal(t, []byte{0xe3, 0x06, 0x92, 0x83}, checksums.CRC32C)
+
+	assert.NoError(t, checksums.Verify(s3.Checksums{}))
+	assert.NoError(t, checksums.Verify(s3.Checksums{CRC32C: []byte{0xe3, 0x06, 0x92, 0x83}}))
+	err := checksums.Verify(s3.Checksums{MD5: make([]byte, 16)})
+	assert.ErrorIs(t, err, s3.ErrBadDigest)
+	assert.ErrorContains(t, err, "MD5")
+}
+
+func TestUpload_Checksums(t *testing.T) {
+	checksums := s3.ComputeChecksums([]byte("file content"))
+	tests := []struct {
+		name             string
+		expected         s3.Checksums
+		expectedHeader   string
+		unexpectedHeader string
+	}{
+		{name: "SHA-256 by default", expectedHeader: "X-Amz-Checksum-Sha256", unexpectedHeader: "X-Amz-Checksum-Crc32c"},
+		{name: "Client MD5", expected: s3.Checksums{MD5: checksums.MD5}, expectedHeader: "X-Amz-Checksum-Sha256", unexpectedHeader: "X-Amz-Checksum-Crc32c"},
+		{name: "Client CRC32C", expected: s3.Checksums{CRC32C: checksums.CRC32C}, expectedHeader: "X-Amz-Checksum-Crc32c", unexpectedHeader: "X-Amz-Checksum-Sha256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Instance := newTestS3(t)
+			var received *http.Request
+			useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r
+				w.Header().Set("ETag", `"d10b4c3ff123b26dc068d43a8bef2d23"`)
+			}))
+
+			result, err := s3Instance.Upload(context.Background(), []byte("file content"), "a.txt", s3.UploadOptions{Checksums: tt.expected})
+
+			assert.NoError(t, err)
+			assert.Equal(t, `"d10b4c3ff123b26dc068d43a8bef2d23"`, result.ETag)
+			assert.Equal(t, checksums, result.Checksums)
+			assert.Equal(t, "0QtMP/Ejsm3AaNQ6i+8tIw==", received.Header.Get("Content-MD5"))
+			assert.NotEmpty(t, received.Header.Get(tt.expectedHeader))
+			assert.Empty(t, received.Header.Get(tt.unexpectedHeader))
+			assert.Contains(t, received.Header.Get("Authorization"), "SignedHeaders=content-md5;")
+		})
+	}
+}
+
+func TestUpload_BadDigest(t *testing.T) {
+	s3Instance := newTestS3(t)
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not be sent")
+	}))
+
+	wrong := s3.ComputeChecksums([]byte("other content"))
+	_, err := s3Instance.Upload(context.Background(), []byte("file content"), "a.txt", s3.UploadOptions{
+		Checksums: s3.Checksums{SHA256: wrong.SHA256},
+	})
+
+	assert.ErrorIs(t, err, s3.ErrBadDigest)
+	assert.ErrorContains(t, err, "SHA-256")
+}
+
+func TestUpload_Encryption(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, s3.CustomerKeySize)
+	tests := []struct {
+		name          string
+		encryption    s3.Encryption
+		expected      map[string]string
+		signedHeaders string
+	}{
+		{
+			name:          "SSE-S3",
+			encryption:    s3.Encryption{Mode: s3.EncryptionS3},
+			expected:      map[string]string{"X-Amz-Server-Side-Encryption": "AES256"},
+			signedHeaders: ";x-amz-meta-tenant;x-amz-server-side-encryption,",
+		},
+		{
+			name:       "SSE-KMS",
+			encryption: s3.Encryption{Mode: s3.EncryptionKMS, KMSKeyID: "alias/uploads", KMSContext: map[string]string{"tenant": "acme", "app": "uploads"}},
+			expected: map[string]string{
+				"X-Amz-Server-Side-Encryption":                "aws:kms",
+				"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": "alias/uploads",
+				// {"app":"uploads","tenant":"acme"}
+				"X-Amz-Server-Side-Encryption-Context": "eyJhcHAiOiJ1cGxvYWRzIiwidGVuYW50IjoiYWNtZSJ9",
+			},
+			signedHeaders: ";x-amz-server-side-encryption;x-amz-server-side-encryption-aws-kms-key-id;x-amz-server-side-encryption-context,",
+		},
+		{
+			name:       "SSE-C",
+			encryption: s3.Encryption{Mode: s3.EncryptionCustomer, CustomerKey: key},
+			expected: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Algorithm": "AES256",
+				"X-Amz-Server-Side-Encryption-Customer-Key":       "BwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwc=",
+				"X-Amz-Server-Side-Encryption-Customer-Key-Md5":   "y4HAEFCYWuvAXWFTtA1Qpg==",
+				// The tenant cannot be read from the metadata of SSE-C objects without the key.
+				"X-Amz-Tagging": "upload-tenant=acme",
+			},
+			signedHeaders: ";x-amz-server-side-encryption-customer-algorithm;x-amz-server-side-encryption-customer-key;x-amz-server-side-encryption-customer-key-md5;x-amz-tagging,",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Instance := newTestS3(t)
+			var received *http.Request
+			useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r
+			}))
+
+			_, err := s3Instance.Upload(context.Background(), []byte("data"), "a.txt", s3.UploadOptions{Tenant: "acme", Encryption: tt.encryption})
+
+			assert.NoError(t, err)
+			for name, value := range tt.expected {
+				assert.Equal(t, value, received.Header.Get(name), name)
+			}
+			assert.Contains(t, received.Header.Get("Authorization"), tt.signedHeaders)
+		})
+	}
+}
+
+func TestUpload_InvalidEncryption(t *testing.T) {
+	s3Instance := newTestS3(t)
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not be sent")
+	}))
+
+	_, err := s3Instance.Upload(context.Background(), []byte("data"), "a.txt", s3.UploadOptions{Encryption: s3.Encryption{Mode: s3.EncryptionCustomer}})
+	assert.ErrorIs(t, err, s3.ErrInvalidEncryption)
+
+	_, err = s3Instance.Upload(context.Background(), []byte("data"), "a.txt", s3.UploadOptions{Tags: map[string]string{s3.TenantTag: "globex"}})
+	assert.ErrorIs(t, err, s3.ErrInvalidTags)
+}
+
+func TestHeadObject_CustomerKey(t *testing.T) {
+	s3Instance := newTestS3(t)
+	var received *http.Request
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.Header().Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+	}))
+
+	ctx := s3.WithCustomerKey(context.Background(), bytes.Repeat([]byte{7}, s3.CustomerKeySize))
+	info, err := s3Instance.HeadObject(ctx, "secret.pdf")
+
+	assert.NoError(t, err)
+	assert.Equal(t, s3.EncryptionCustomer, info.Encryption)
+	assert.Equal(t, "y4HAEFCYWuvAXWFTtA1Qpg==", received.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5"))
+	assert.Contains(t, received.Header.Get("Authorization"), ";x-amz-server-side-encryption-customer-key-md5,")
+}
+
+func TestPresignUrl_CustomerKey(t *testing.T) {
+	s3Instance := newTestS3(t)
+
+	ctx := s3.WithCustomerKey(context.Background(), bytes.Repeat([]byte{7}, s3.CustomerKeySize))
+	parsedURL, err := url.Parse(s3Instance.PresignUrl(ctx, "secret.pdf", 3600))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "host;x-amz-server-side-encryption-customer-algorithm;x-amz-server-side-encryption-customer-key;x-amz-server-side-encryption-customer-key-md5",
+		parsedURL.Query().Get("X-Amz-SignedHeaders"))
+	assert.NotContains(t, parsedURL.RawQuery, "BwcHBwcH", "the key must not appear in the URL")
+}
+
+func TestEncryptionPolicy(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, s3.CustomerKeySize)
+	kms := s3.Encryption{Mode: s3.EncryptionKMS, KMSKeyID: "alias/acme", KMSContext: map[string]string{"tenant": "acme"}}
+	perTenant := map[string]s3.Encryption{"acme": kms, "vault": {Mode: s3.EncryptionCustomer}}
+	tests := []struct {
+		name          string
+		tenant        string
+		allowOverride bool
+		requested     s3.Encryption
+		expected      s3.Encryption
+		wantErr       bool
+	}{
+		{name: "Default", tenant: "globex", expected: s3.Encryption{Mode: s3.EncryptionS3}},
+		{name: "Per tenant", tenant: "acme", expected: kms},
+		{
+			name:      "Request adds to the encryption context",
+			tenant:    "acme",
+			requested: s3.Encryption{KMSContext: map[string]string{"tenant": "globex", "project": "apollo"}},
+			expected:  s3.Encryption{Mode: s3.EncryptionKMS, KMSKeyID: "alias/acme", KMSContext: map[string]string{"tenant": "acme", "project": "apollo"}},
+		},
+		{name: "Mode is enforced", tenant: "acme", requested: s3.Encryption{Mode: s3.EncryptionS3}, wantErr: true},
+		{name: "KMS key is enforced", tenant: "acme", requested: s3.Encryption{Mode: s3.EncryptionKMS, KMSKeyID: "alias/other"}, wantErr: true},
+		{name: "Override", tenant: "acme", allowOverride: true, requested: s3.Encryption{Mode: s3.EncryptionS3}, expected: s3.Encryption{Mode: s3.EncryptionS3}},
+		{name: "SSE-C with a key", tenant: "vault", requested: s3.Encryption{Mode: s3.EncryptionCustomer, CustomerKey: key}, expected: s3.Encryption{Mode: s3.EncryptionCustomer, CustomerKey: key}},
+		{name: "SSE-C without a key", tenant: "vault", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := s3.NewEncryptionPolicy(s3.Encryption{Mode: s3.EncryptionS3}, perTenant, tt.allowOverride)
+
+			resolved, err := policy.Resolve(tt.tenant, tt.requested)
+
+			if tt.wantErr {
+				assert.ErrorIs(t, err, s3.ErrInvalidEncryption)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, resolved)
+		})
+	}
+}
+
+func TestHeadObject(t *testing.T) {
+	s3Instance := newTestS3(t)
+
+	var received *http.Request
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.Header().Set("Content-Length", "1234")
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("ETag", `"9b2cf535f27731c974343645a3985328"`)
+		w.Header().Set("Last-Modified", "Mon, 24 Feb 2025 15:04:05 GMT")
+		w.Header().Set("X-Amz-Meta-Tenant", "acme")
+		w.Header().Set("X-Amz-Meta-Original-Filename", mime.QEncoding.Encode("utf-8", "résumé.pdf"))
+		w.Header().Set("X-Amz-Meta-Project", "apollo")
+		w.Header().Set("X-Amz-Tagging-Count", "2")
+	}))
+
+	info, err := s3Instance.HeadObject(context.Background(), "dir/report.pdf")
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodHead, received.Method)
+	assert.Equal(t, "/dir/report.pdf", received.URL.Path)
+	assert.Equal(t, s3.ObjectInfo{
+		Key:          "dir/report.pdf",
+		Size:         1234,
+		ETag:         `"9b2cf535f27731c974343645a3985328"`,
+		ContentType:  "application/pdf",
+		LastModified: time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC),
+		Metadata:     map[string]string{"tenant": "acme", "original-filename": "résumé.pdf", "project": "apollo"},
+		TagCount:     2,
+	}, info)
+	assert.Equal(t, "acme", info.Tenant())
+	assert.Equal(t, "résumé.pdf", info.OriginalFileName())
+	assert.Equal(t, map[string]string{"project": "apollo"}, info.UserMetadata())
+}
+
+func TestHeadObject_NotFound(t *testing.T) {
+	s3Instance := newTestS3(t)
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	_, err := s3Instance.HeadObject(context.Background(), "missing")
+
+	var s3Err *s3.Error
+	assert.ErrorAs(t, err, &s3Err)
+	assert.Equal(t, http.StatusNotFound, s3Err.StatusCode)
+}
+
+func TestGetObject(t *testing.T) {
+	s3Instance := newTestS3(t)
+	var received *http.Request
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("X-Amz-Meta-Tenant", "acme")
+		w.Write([]byte("file content"))
+	}))
+
+	ctx := s3.WithCustomerKey(context.Background(), bytes.Repeat([]byte{7}, s3.CustomerKeySize))
+	body, info, err := s3Instance.GetObject(ctx, "dir/notes.txt")
+
+	assert.NoError(t, err)
+	defer body.Close()
+	content, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	// The body is returned as stored rather than decompressed by the transport.
+	assert.Equal(t, "file content", string(content))
+	assert.Equal(t, "gzip", info.ContentEncoding)
+	assert.Equal(t, http.MethodGet, received.Method)
+	assert.Equal(t, "/dir/notes.txt", received.URL.Path)
+	assert.Equal(t, "y4HAEFCYWuvAXWFTtA1Qpg==", received.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5"))
+	assert.Equal(t, int64(12), info.Size)
+	assert.Equal(t, "text/plain", info.ContentType)
+	assert.Equal(t, "acme", info.Tenant())
+}
+
+func TestDeleteObject(t *testing.T) {
+	s3Instance := newTestS3(t)
+
+	var received *http.Request
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	err := s3Instance.DeleteObject(context.Background(), "my file.txt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodDelete, received.Method)
+	assert.Equal(t, "/my%20file.txt", received.URL.EscapedPath())
+}
+
+func TestListObjects(t *testing.T) {
+	s3Instance := newTestS3(t)
+
+	var queries []url.Values
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		w.Header().Set("Content-Type", "application/xml")
+		if r.URL.Query().Get("continuation-token") == "" {
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <IsTruncated>true</IsTruncated>
+  <NextContinuationToken>1ueGcxLPRx1Tr/XYExHnhbYLgveDs2J/wm36Hy4vbOwM=</NextContinuationToken>
+  <Contents><Key>uploads/a.txt</Key><Size>10</Size><ETag>"a"</ETag><LastModified>2025-02-24T15:04:05.000Z</LastModified></Contents>
+</ListBucketResult>`)
+			return
+		}
+		io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <IsTruncated>false</IsTruncated>
+  <Contents><Key>uploads/b &amp; c.txt</Key><Size>20</Size><ETag>"b"</ETag><LastModified>2025-02-24T15:04:06.000Z</LastModified></Contents>
+</ListBucketResult>`)
+	}))
+
+	var listed []s3.ObjectInfo
+	err := s3Instance.ListObjects(context.Background(), "uploads/", func(info s3.ObjectInfo) error {
+		listed = append(listed, info)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	if assert.Len(t, queries, 2) {
+		assert.Equal(t, url.Values{"list-type": {"2"}, "prefix": {"uploads/"}}, queries[0])
+		assert.Equal(t, "1ueGcxLPRx1Tr/XYExHnhbYLgveDs2J/wm36Hy4vbOwM=", queries[1].Get("continuation-token"))
+	}
+	assert.Equal(t, []s3.ObjectInfo{
+		{Key: "uploads/a.txt", Size: 10, ETag: `"a"`, LastModified: time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC)},
+		{Key: "uploads/b & c.txt", Size: 20, ETag: `"b"`, LastModified: time.Date(2025, 2, 24, 15, 4, 6, 0, time.UTC)},
+	}, listed)
+}
+
+func TestUpload_Tracing(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	mockTimeUtil := mocks.NewTimeUtil(t)
+	mockTimeUtil.On("Now").Return(time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC))
+	mockUUIDUtil := mocks.NewUUIDUtil(t)
+	mockUUIDUtil.On("Generate").Return("fixed-uuid")
+	s3Instance := s3.NewS3("testbucket", "us-test-1", "TESTACCESSKEY", "TESTSECRETKEY", mockTimeUtil, mockUUIDUtil,
+		s3.WithRetryPolicy(s3.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+		s3.WithTracerProvider(tp))
+
+	var traceparents []string
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		if len(traceparents) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	_, err := s3Instance.Upload(ctx, []byte("file content"), "test.txt", s3.UploadOptions{})
+	parent.End()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	if !assert.Len(t, spans["S3.PutObject"], 1) {
+		return
+	}
+	if !assert.Len(t, spans["S3.Sign"], 2) {
+		return
+	}
+	if !assert.Len(t, spans["PUT"], 2) {
+		return
+	}
+
+	operation := spans["S3.PutObject"][0]
+	assert.Equal(t, parent.SpanContext().SpanID(), operation.Parent().SpanID())
+	assert.Equal(t, trace.SpanKindClient, operation.SpanKind())
+	assert.Len(t, operation.Events(), 1)
+	assert.Equal(t, "retry", operation.Events()[0].Name)
+
+	for i, attempt := range spans["PUT"] {
+		assert.Equal(t, operation.SpanContext().SpanID(), attempt.Parent().SpanID())
+		assert.Equal(t, operation.SpanContext().SpanID(), spans["S3.Sign"][i].Parent().SpanID())
+		expected := fmt.Sprintf("00-%s-%s-01", attempt.SpanContext().TraceID(), attempt.SpanContext().SpanID())
+		assert.Equal(t, expected, traceparents[i])
+	}
+	assert.Contains(t, spans["PUT"][1].Attributes(), attribute.Int("http.request.resend_count", 1))
+}
+
+// useTestServer routes every request made through http.DefaultTransport to a local TLS server
+// for the duration of the test.
+func useTestServer(t *testing.T, handler http.Handler) *httptest.Server {
+	ts := httptest.NewTLSServer(handler)
+	t.Cleanup(ts.Close)
+
+	origTransport := http.DefaultTransport
+	t.Cleanup(func() { http.DefaultTransport = origTransport })
+
+	http.DefaultTransport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial(network, ts.Listener.Addr().String())
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	return ts
+}
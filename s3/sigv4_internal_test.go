@@ -0,0 +1,254 @@
+package s3
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/utils/hashutil"
+)
+
+// Test vectors from the AWS Signature Version 4 test suite (aws-sig-v4-test-suite). They all use
+// the same credentials, date and scope and sign a request for the generic "service" service.
+const (
+	vectorSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	vectorAmzDate   = "20150830T123600Z"
+	vectorDateStamp = "20150830"
+	vectorRegion    = "us-east-1"
+	vectorService   = "service"
+	vectorHost      = "example.amazonaws.com"
+)
+
+func TestSigV4TestSuite(t *testing.T) {
+	tests := []struct {
+		name              string
+		method            string
+		path              string
+		query             url.Values
+		headers           map[string]string
+		body              string
+		expectedCanonical string
+		expectedSignature string
+	}{
+		{
+			name:   "get-vanilla",
+			method: http.MethodGet,
+			path:   "",
+			expectedCanonical: "GET\n/\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			expectedSignature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:              "get-vanilla-empty-query-key",
+			method:            http.MethodGet,
+			query:             url.Values{"Param1": {"value1"}},
+			expectedSignature: "a67d582fa61cc504c4bae71f336f98b97f1ea3c7a6bfe1b6e45aec72011b9aeb",
+		},
+		{
+			name:              "get-vanilla-query-order-key-case",
+			method:            http.MethodGet,
+			query:             url.Values{"Param2": {"value2"}, "Param1": {"value1"}},
+			expectedSignature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:   "get-vanilla-query-unreserved",
+			method: http.MethodGet,
+			query: url.Values{
+				"-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz": {"-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"},
+			},
+			expectedSignature: "9c3e54bfcdf0b19771a7f523ee5669cdf59bc7cc0884027167c21bb143a40197",
+		},
+		{
+			name:              "get-vanilla-utf8-query",
+			method:            http.MethodGet,
+			query:             url.Values{"ሴ": {"bar"}},
+			expectedSignature: "2cdec8eed098649ff3a119c94853b13c643bcf08f8b0a1d91e12c9027818dd04",
+		},
+		{
+			name:              "get-unreserved",
+			method:            http.MethodGet,
+			path:              "-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+			expectedSignature: "07ef7494c76fa4850883e2b006601f940f8a34d404d0cfa977f52a65bbf5f24f",
+		},
+		{
+			name:   "get-utf8",
+			method: http.MethodGet,
+			path:   "ሴ",
+			expectedCanonical: "GET\n/%E1%88%B4\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			expectedSignature: "8318018e0b0f223aa2bbf98705b62bb787dc9c0e678f255a891fd03141be5d85",
+		},
+		{
+			name:              "get-space",
+			method:            http.MethodGet,
+			path:              "example space/",
+			expectedSignature: "652487583200325589f1fba4c7e578f72c47cb61beeca81406b39ddec1366741",
+		},
+		{
+			name:              "post-vanilla",
+			method:            http.MethodPost,
+			expectedSignature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:              "post-vanilla-query",
+			method:            http.MethodPost,
+			query:             url.Values{"Param1": {"value1"}},
+			expectedSignature: "28038455d6de14eafc1f9222cf5aa6f1a96197d7deb8263271d420d138af7f11",
+		},
+		{
+			name:              "post-x-www-form-urlencoded",
+			method:            http.MethodPost,
+			headers:           map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			body:              "Param1=value1",
+			expectedSignature: "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{
+				"Host":       vectorHost,
+				"X-Amz-Date": vectorAmzDate,
+			}
+			for k, v := range tt.headers {
+				headers[k] = v
+			}
+			var signed []string
+			for k := range headers {
+				signed = append(signed, strings.ToLower(k))
+			}
+			sort.Strings(signed)
+			signedHeaders := strings.Join(signed, ";")
+
+			canonicalRequest := buildCanonicalRequest(tt.method, canonicalURI(tt.path), canonicalQueryString(tt.query),
+				headers, signedHeaders, hashutil.HashSHA256([]byte(tt.body)))
+			if tt.expectedCanonical != "" && canonicalRequest != tt.expectedCanonical {
+				t.Errorf("canonical request mismatch:\nExpected:\n%q\nGot:\n%q", tt.expectedCanonical, canonicalRequest)
+			}
+
+			credentialScope := fmt.Sprintf("%s/%s/%s/aws4_request", vectorDateStamp, vectorRegion, vectorService)
+			stringToSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%s", vectorAmzDate, credentialScope,
+				hashutil.HashSHA256([]byte(canonicalRequest)))
+			signingKey := deriveSigningKey(vectorSecretKey, vectorDateStamp, vectorRegion, vectorService)
+			signature := hex.EncodeToString(hashutil.HmacSHA256(signingKey, []byte(stringToSign)))
+
+			if signature != tt.expectedSignature {
+				t.Errorf("signature mismatch: expected %s, got %s", tt.expectedSignature, signature)
+			}
+		})
+	}
+}
+
+// Examples from the Amazon S3 "Signature Calculations for the Authorization Header" documentation.
+func TestSigV4S3Examples(t *testing.T) {
+	s := s3{
+		secretKey: "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY",
+		region:    "us-east-1",
+	}
+	const amzDate = "20130524T000000Z"
+
+	tests := []struct {
+		name              string
+		method            string
+		objectKey         string
+		headers           map[string]string
+		body              string
+		expectedURI       string
+		expectedSignature string
+	}{
+		{
+			name:      "GET object",
+			method:    http.MethodGet,
+			objectKey: "test.txt",
+			headers: map[string]string{
+				"range": "bytes=0-9",
+			},
+			expectedURI:       "/test.txt",
+			expectedSignature: "f0e8bdb87c964420e857bd35b5d6ed310bd44f0170aba48dd91039c6036bdb41",
+		},
+		{
+			name:      "PUT object",
+			method:    http.MethodPut,
+			objectKey: "test$file.text",
+			headers: map[string]string{
+				"date":                "Fri, 24 May 2013 00:00:00 GMT",
+				"x-amz-storage-class": "REDUCED_REDUNDANCY",
+			},
+			body:              "Welcome to Amazon S3.",
+			expectedURI:       "/test%24file.text",
+			expectedSignature: "98ad721746da40c64f1a55b78f14c238d841ea1380cd77a1b5971af0ece108bd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashedPayload := hashutil.HashSHA256([]byte(tt.body))
+			headers := map[string]string{
+				"host":                 "examplebucket.s3.amazonaws.com",
+				"x-amz-content-sha256": hashedPayload,
+				"x-amz-date":           amzDate,
+			}
+			for k, v := range tt.headers {
+				headers[k] = v
+			}
+			var signed []string
+			for k := range headers {
+				signed = append(signed, k)
+			}
+			sort.Strings(signed)
+
+			uri := canonicalURI(tt.objectKey)
+			if uri != tt.expectedURI {
+				t.Errorf("Expected canonical URI %s, got %s", tt.expectedURI, uri)
+			}
+			canonicalRequest := buildCanonicalRequest(tt.method, uri, "", headers, strings.Join(signed, ";"), hashedPayload)
+			stringToSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%s", amzDate, "20130524/us-east-1/s3/aws4_request",
+				hashutil.HashSHA256([]byte(canonicalRequest)))
+			signature := hex.EncodeToString(hashutil.HmacSHA256(s.getSignatureKey("20130524"), []byte(stringToSign)))
+
+			if signature != tt.expectedSignature {
+				t.Errorf("signature mismatch: expected %s, got %s", tt.expectedSignature, signature)
+			}
+		})
+	}
+}
+
+func TestURIEncode(t *testing.T) {
+	tests := []struct {
+		input       string
+		encodeSlash bool
+		expected    string
+	}{
+		{input: "photos/2025/a b.jpg", expected: "photos/2025/a%20b.jpg"},
+		{input: "photos/2025/a b.jpg", encodeSlash: true, expected: "photos%2F2025%2Fa%20b.jpg"},
+		{input: "a+b=c&d", expected: "a%2Bb%3Dc%26d"},
+		{input: "100%?#", expected: "100%25%3F%23"},
+		{input: "-._~", expected: "-._~"},
+		{input: "ሴ", expected: "%E1%88%B4"},
+		{input: "file*(1)!'.txt", expected: "file%2A%281%29%21%27.txt"},
+	}
+
+	for _, tt := range tests {
+		result := uriEncode(tt.input, tt.encodeSlash)
+		if result != tt.expected {
+			t.Errorf("uriEncode(%q, %v): expected %s, got %s", tt.input, tt.encodeSlash, tt.expected, result)
+		}
+	}
+}
+
+func TestObjectURL_PreservesSignedEncoding(t *testing.T) {
+	objectKey := "reports/Q1 summary+final #2?.pdf"
+	u := objectURL("bucket.s3.us-east-1.amazonaws.com", objectKey, "a=b")
+
+	expected := "https://bucket.s3.us-east-1.amazonaws.com/reports/Q1%20summary%2Bfinal%20%232%3F.pdf?a=b"
+	if u.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, u.String())
+	}
+	if u.EscapedPath() != canonicalURI(objectKey) {
+		t.Errorf("Expected escaped path %s to match canonical URI %s", u.EscapedPath(), canonicalURI(objectKey))
+	}
+}
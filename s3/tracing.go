@@ -0,0 +1,67 @@
+package s3
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/haithamswe/multi-protocol-upload-api/s3"
+
+// WithTracerProvider overrides the global tracer provider, mostly useful in tests.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *s3) {
+		s.tracer = tp.Tracer(tracerName)
+	}
+}
+
+func (s *s3) operationAttributes(operation string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.RPCSystemKey.String("aws-api"),
+		semconv.RPCService("S3"),
+		semconv.RPCMethod(operation),
+		semconv.CloudRegion(s.region),
+		semconv.AWSS3Bucket(s.bucket),
+	}
+}
+
+// startAttempt starts the client span for one HTTP attempt and injects its traceparent into the
+// request. The header is added after signing, so it does not invalidate the signature.
+func (s *s3) startAttempt(req *http.Request, attempt int) (*http.Request, trace.Span) {
+	// The query string of a presigned request carries credentials; never record it.
+	u := *req.URL
+	u.RawQuery = ""
+	ctx, span := s.tracer.Start(req.Context(), req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(u.String()),
+			semconv.ServerAddress(req.URL.Hostname()),
+		),
+	)
+	if attempt > 0 {
+		span.SetAttributes(semconv.HTTPRequestResendCount(attempt))
+	}
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, span
+}
+
+func endAttempt(span trace.Span, resp *http.Response, err error) {
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case resp.StatusCode >= 400:
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	default:
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	}
+	span.End()
+}
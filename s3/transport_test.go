@@ -0,0 +1,123 @@
+package s3_test
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/mocks"
+	"github.com/haithamswe/multi-protocol-upload-api/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCABundle(t *testing.T, ts *httptest.Server) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write CA bundle: %v", err)
+	}
+	return path
+}
+
+func TestNewHTTPClient_CABundle(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	cfg := s3.DefaultTransportConfig
+	cfg.CABundlePath = writeCABundle(t, ts)
+
+	client, err := s3.NewHTTPClient(cfg)
+	assert.NoError(t, err)
+	resp, err := client.Get(ts.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "HTTP/2.0", resp.Header.Get("X-Proto"))
+
+	cfg.EnableHTTP2 = false
+	client, err = s3.NewHTTPClient(cfg)
+	assert.NoError(t, err)
+	resp, err = client.Get(ts.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "HTTP/1.1", resp.Header.Get("X-Proto"))
+}
+
+func TestNewHTTPClient_UntrustedServer(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client, err := s3.NewHTTPClient(s3.DefaultTransportConfig)
+	assert.NoError(t, err)
+	_, err = client.Get(ts.URL)
+	assert.Error(t, err)
+}
+
+func TestNewHTTPClient_InvalidConfig(t *testing.T) {
+	cfg := s3.DefaultTransportConfig
+	cfg.CABundlePath = filepath.Join(t.TempDir(), "missing.pem")
+	_, err := s3.NewHTTPClient(cfg)
+	assert.Error(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0o600)
+	cfg.CABundlePath = empty
+	_, err = s3.NewHTTPClient(cfg)
+	assert.Error(t, err)
+
+	cfg = s3.DefaultTransportConfig
+	cfg.ProxyURL = "://bad"
+	_, err = s3.NewHTTPClient(cfg)
+	assert.Error(t, err)
+}
+
+func TestNewHTTPClient_ResponseHeaderTimeout(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+
+	cfg := s3.DefaultTransportConfig
+	cfg.CABundlePath = writeCABundle(t, ts)
+	cfg.ResponseHeaderTimeout = 50 * time.Millisecond
+
+	client, err := s3.NewHTTPClient(cfg)
+	assert.NoError(t, err)
+
+	start := time.Now()
+	_, err = client.Get(ts.URL)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 900*time.Millisecond)
+}
+
+func TestUpload_CanceledContextIsNotRetried(t *testing.T) {
+	mockTimeUtil := mocks.NewTimeUtil(t)
+	mockTimeUtil.On("Now").Return(time.Date(2025, 2, 24, 15, 4, 5, 0, time.UTC)).Maybe()
+	mockUUIDUtil := mocks.NewUUIDUtil(t)
+	mockUUIDUtil.On("Generate").Return("fixed-uuid")
+
+	s3Instance := s3.NewS3("testbucket", "us-test-1", "TESTACCESSKEY", "TESTSECRETKEY", mockTimeUtil, mockUUIDUtil,
+		s3.WithRetryPolicy(s3.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+
+	attempts := 0
+	useTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s3Instance.Upload(ctx, []byte("file content"), "test.txt", s3.UploadOptions{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, attempts)
+}
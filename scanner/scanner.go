@@ -0,0 +1,128 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const defaultChunkSize = 64 * 1024
+
+var ErrScanFailed = errors.New("malware scan failed")
+
+type Scanner interface {
+	// Scan gives up when ctx is done, so a slow scanner cannot outlive the request it serves.
+	Scan(ctx context.Context, data []byte) (Result, error)
+}
+
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// clamd speaks the clamd INSTREAM protocol: the payload is streamed as length-prefixed chunks
+// terminated by a zero-length chunk, and clamd answers with a single "stream: ..." line.
+type clamd struct {
+	network   string
+	address   string
+	timeout   time.Duration
+	chunkSize int
+}
+
+func (c clamd) Scan(ctx context.Context, data []byte) (Result, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Result{}, c.failed(ctx, err)
+	}
+	defer conn.Close()
+
+	if c.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	// The request's deadline or cancellation unblocks pending reads and writes as well.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := c.stream(conn, data); err != nil {
+		return Result{}, c.failed(ctx, err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return Result{}, c.failed(ctx, err)
+	}
+	return parseReply(reply)
+}
+
+// failed reports the context's error rather than the I/O timeout it caused, when there is one.
+func (c clamd) failed(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%w: %w", ErrScanFailed, ctxErr)
+	}
+	return fmt.Errorf("%w: %v", ErrScanFailed, err)
+}
+
+func (c clamd) stream(conn net.Conn, data []byte) error {
+	w := bufio.NewWriter(conn)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return err
+	}
+	var size [4]byte
+	for r := bytes.NewReader(data); r.Len() > 0; {
+		chunk := make([]byte, min(c.chunkSize, r.Len()))
+		r.Read(chunk)
+		binary.BigEndian.PutUint32(size[:], uint32(len(chunk)))
+		if _, err := w.Write(size[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func parseReply(reply string) (Result, error) {
+	reply = strings.TrimRight(reply, "\x00\n")
+	status := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case status == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("%w: clamd replied %q", ErrScanFailed, reply)
+	}
+}
+
+// NewClamd accepts addresses of the form "tcp://host:port" or "unix:///path/to/clamd.sock".
+// A bare "host:port" is treated as TCP.
+func NewClamd(address string, timeout time.Duration) (Scanner, error) {
+	network := "tcp"
+	if scheme, rest, ok := strings.Cut(address, "://"); ok {
+		network, address = scheme, rest
+	}
+	if network != "tcp" && network != "unix" {
+		return nil, fmt.Errorf("unsupported clamd network %q", network)
+	}
+	if address == "" {
+		return nil, errors.New("missing clamd address")
+	}
+	return &clamd{
+		network:   network,
+		address:   address,
+		timeout:   timeout,
+		chunkSize: defaultChunkSize,
+	}, nil
+}
@@ -0,0 +1,148 @@
+package scanner_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/scanner"
+	"github.com/stretchr/testify/assert"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd implements enough of the INSTREAM protocol to flag the EICAR test string.
+func fakeClamd(t *testing.T, network, address string) net.Listener {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				command, err := r.ReadString(0)
+				if err != nil || command != "zINSTREAM\x00" {
+					io.WriteString(conn, "UNKNOWN COMMAND\x00")
+					return
+				}
+				var payload bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&payload, r, int64(size)); err != nil {
+						return
+					}
+				}
+				if bytes.Contains(payload.Bytes(), []byte(eicar)) {
+					io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+					return
+				}
+				io.WriteString(conn, "stream: OK\x00")
+			}(conn)
+		}
+	}()
+	return listener
+}
+
+func TestClamd_TCP(t *testing.T) {
+	listener := fakeClamd(t, "tcp", "127.0.0.1:0")
+	clamd, err := scanner.NewClamd("tcp://"+listener.Addr().String(), time.Second)
+	assert.NoError(t, err)
+
+	result, err := clamd.Scan(context.Background(), []byte("harmless content"))
+	assert.NoError(t, err)
+	assert.False(t, result.Infected)
+
+	result, err = clamd.Scan(context.Background(), append(bytes.Repeat([]byte("a"), 200*1024), eicar...))
+	assert.NoError(t, err)
+	assert.True(t, result.Infected)
+	assert.Equal(t, "Eicar-Test-Signature", result.Signature)
+}
+
+func TestClamd_Unix(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "clamd.sock")
+	fakeClamd(t, "unix", socket)
+	clamd, err := scanner.NewClamd("unix://"+socket, time.Second)
+	assert.NoError(t, err)
+
+	result, err := clamd.Scan(context.Background(), []byte(eicar))
+	assert.NoError(t, err)
+	assert.True(t, result.Infected)
+}
+
+func TestClamd_Unavailable(t *testing.T) {
+	listener := fakeClamd(t, "tcp", "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	clamd, err := scanner.NewClamd(address, time.Second)
+	assert.NoError(t, err)
+
+	_, err = clamd.Scan(context.Background(), []byte("content"))
+	assert.ErrorIs(t, err, scanner.ErrScanFailed)
+}
+
+func TestClamd_ContextDone(t *testing.T) {
+	// A listener that never answers stands in for a hung clamd.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	clamd, err := scanner.NewClamd(listener.Addr().String(), time.Minute)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = clamd.Scan(ctx, []byte("content"))
+	assert.ErrorIs(t, err, scanner.ErrScanFailed)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = clamd.Scan(ctx, []byte("content"))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNewClamd_InvalidAddress(t *testing.T) {
+	_, err := scanner.NewClamd("udp://127.0.0.1:3310", time.Second)
+	assert.Error(t, err)
+
+	_, err = scanner.NewClamd("tcp://", time.Second)
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+type Config struct {
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout and WriteTimeout bound a whole request, so they must cover the slowest upload the
+	// service accepts.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// DrainDelay is how long the server keeps accepting requests after readiness starts failing,
+	// so load balancers notice before the listener closes.
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+}
+
+var DefaultConfig = Config{
+	ReadHeaderTimeout: 10 * time.Second,
+	ReadTimeout:       10 * time.Minute,
+	WriteTimeout:      10 * time.Minute,
+	IdleTimeout:       2 * time.Minute,
+	DrainDelay:        5 * time.Second,
+	ShutdownTimeout:   30 * time.Second,
+}
+
+func New(handler http.Handler, cfg Config) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// Serve serves on ln until ctx is done, then calls onDrain and keeps serving for drainDelay. It then
+// stops accepting connections and waits up to shutdownTimeout for in-flight requests to finish
+// before closing the remaining connections.
+func Serve(ctx context.Context, srv *http.Server, ln net.Listener, drainDelay, shutdownTimeout time.Duration, onDrain func()) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	if onDrain != nil {
+		onDrain()
+	}
+	if drainDelay > 0 {
+		timer := time.NewTimer(drainDelay)
+		select {
+		case err := <-errCh:
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// Uploads still running past the deadline are cut off.
+		err = errors.Join(err, srv.Close())
+	}
+	if serveErr := <-errCh; !errors.Is(serveErr, http.ErrServerClosed) {
+		err = errors.Join(err, serveErr)
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServe_DrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "uploaded")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	drained := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(ctx, server.New(handler, server.DefaultConfig), ln, 0, 5*time.Second, func() { close(drained) })
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			resCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		resCh <- result{string(body), err}
+	}()
+
+	<-started
+	cancel()
+	<-drained
+
+	// New connections are refused while the in-flight request keeps running.
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("Serve returned before the in-flight request finished: %v", err)
+	default:
+	}
+
+	close(release)
+	res := <-resCh
+	assert.NoError(t, res.err)
+	assert.Equal(t, "uploaded", res.body)
+	assert.NoError(t, <-done)
+}
+
+func TestServe_ShutdownDeadline(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(ctx, server.New(handler, server.DefaultConfig), ln, 0, 50*time.Millisecond, nil)
+	}()
+
+	clientErr := make(chan error, 1)
+	go func() {
+		_, err := http.Get("http://" + ln.Addr().String())
+		clientErr <- err
+	}()
+
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+	assert.Error(t, <-clientErr)
+}
+
+func TestServe_DrainDelay(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	drained := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(ctx, server.New(handler, server.DefaultConfig), ln, 200*time.Millisecond, time.Second, func() { close(drained) })
+	}()
+
+	cancel()
+	<-drained
+	// Requests are still served while load balancers notice readiness failing.
+	resp, err := http.Get("http://" + ln.Addr().String())
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Serve returned before the drain delay: %v", err)
+	default:
+	}
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,74 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/haithamswe/multi-protocol-upload-api/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup_FileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    tracing.ExporterFile,
+		FilePath:    path,
+		ServiceName: "upload-test",
+		SampleRatio: 1,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "upload")
+	span.End()
+	if !assert.NoError(t, shutdown(context.Background())) {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if !assert.Len(t, lines, 1) {
+		return
+	}
+
+	var exported struct {
+		Name     string
+		Resource []struct {
+			Key   string
+			Value struct{ Value any }
+		}
+	}
+	if !assert.NoError(t, json.Unmarshal([]byte(lines[0]), &exported)) {
+		return
+	}
+	assert.Equal(t, "upload", exported.Name)
+	assert.Contains(t, exported.Resource, struct {
+		Key   string
+		Value struct{ Value any }
+	}{Key: "service.name", Value: struct{ Value any }{Value: "upload-test"}})
+}
+
+func TestSetup_Errors(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), tracing.Config{Exporter: "zipkin"})
+	assert.ErrorContains(t, err, "unknown exporter")
+
+	_, err = tracing.Setup(context.Background(), tracing.Config{Exporter: tracing.ExporterFile})
+	assert.ErrorContains(t, err, "file path")
+}
+
+func TestSetup_None(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, shutdown(context.Background()))
+}
@@ -0,0 +1,101 @@
+package envutil
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func Int64(key string, defaultValue int64) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	return parsed, nil
+}
+
+func Float64(key string, defaultValue float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	return parsed, nil
+}
+
+// Seconds reads a whole number of seconds, e.g. S3_TIMEOUT_SECONDS=30.
+func Seconds(key string, defaultValue time.Duration) (time.Duration, error) {
+	seconds, err := Int64(key, int64(defaultValue/time.Second))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func Bool(key string, defaultValue bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	return parsed, nil
+}
+
+// Map parses a comma separated list of name=value pairs, e.g. "acme=1024,globex=2048".
+func Map(key string) (map[string]string, error) {
+	result := map[string]string{}
+	value := os.Getenv(key)
+	if value == "" {
+		return result, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid entry %q for %s", pair, key)
+		}
+		result[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	}
+	return result, nil
+}
+
+func Int64Map(key string) (map[string]int64, error) {
+	raw, err := Map(key)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]int64, len(raw))
+	for name, value := range raw {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s[%s]: %w", key, name, err)
+		}
+		result[name] = parsed
+	}
+	return result, nil
+}
+
+func List(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
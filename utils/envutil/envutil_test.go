@@ -0,0 +1,84 @@
+package envutil_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/haithamswe/multi-protocol-upload-api/utils/envutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInt64(t *testing.T) {
+	t.Setenv("TEST_INT", "")
+	value, err := envutil.Int64("TEST_INT", 42)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), value)
+
+	t.Setenv("TEST_INT", "1024")
+	value, err = envutil.Int64("TEST_INT", 42)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024), value)
+
+	t.Setenv("TEST_INT", "lots")
+	_, err = envutil.Int64("TEST_INT", 42)
+	assert.Error(t, err)
+}
+
+func TestFloat64(t *testing.T) {
+	t.Setenv("TEST_FLOAT", "")
+	value, err := envutil.Float64("TEST_FLOAT", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, value)
+
+	t.Setenv("TEST_FLOAT", "0.25")
+	value, err = envutil.Float64("TEST_FLOAT", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.25, value)
+
+	t.Setenv("TEST_FLOAT", "half")
+	_, err = envutil.Float64("TEST_FLOAT", 1)
+	assert.Error(t, err)
+}
+
+func TestSeconds(t *testing.T) {
+	t.Setenv("TEST_SECONDS", "")
+	value, err := envutil.Seconds("TEST_SECONDS", 5*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, value)
+
+	t.Setenv("TEST_SECONDS", "90")
+	value, err = envutil.Seconds("TEST_SECONDS", 5*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Second, value)
+}
+
+func TestBool(t *testing.T) {
+	t.Setenv("TEST_BOOL", "true")
+	value, err := envutil.Bool("TEST_BOOL", false)
+	assert.NoError(t, err)
+	assert.True(t, value)
+
+	t.Setenv("TEST_BOOL", "maybe")
+	_, err = envutil.Bool("TEST_BOOL", false)
+	assert.Error(t, err)
+}
+
+func TestInt64Map(t *testing.T) {
+	t.Setenv("TEST_MAP", "acme=1024, globex = 2048,")
+	value, err := envutil.Int64Map("TEST_MAP")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"acme": 1024, "globex": 2048}, value)
+
+	t.Setenv("TEST_MAP", "acme")
+	_, err = envutil.Int64Map("TEST_MAP")
+	assert.Error(t, err)
+
+	t.Setenv("TEST_MAP", "acme=big")
+	_, err = envutil.Int64Map("TEST_MAP")
+	assert.Error(t, err)
+}
+
+func TestList(t *testing.T) {
+	t.Setenv("TEST_LIST", " image/png,,image/jpeg ")
+	assert.Equal(t, []string{"image/png", "image/jpeg"}, envutil.List("TEST_LIST"))
+}